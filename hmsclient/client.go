@@ -153,6 +153,17 @@ func (c *MetastoreClient) GetDatabase(dbName string) (*Database, error) {
 
 // CreateDatabase creates database with the specified name, description, parameters and owner.
 func (c *MetastoreClient) CreateDatabase(db *Database) error {
+	return c.client.CreateDatabase(c.context, db.toThrift())
+}
+
+// AlterDatabase modifies existing database with data from the new database.
+// Database name can't be changed.
+func (c *MetastoreClient) AlterDatabase(dbName string, db *Database) error {
+	return c.client.AlterDatabase(c.context, dbName, db.toThrift())
+}
+
+// toThrift converts Database to the Thrift representation.
+func (db *Database) toThrift() *hive_metastore.Database {
 	database := &hive_metastore.Database{
 		Name:        db.Name,
 		Description: db.Description,
@@ -171,7 +182,7 @@ func (c *MetastoreClient) CreateDatabase(db *Database) error {
 	if db.OwnerType != 0 {
 		database.OwnerType = &db.OwnerType
 	}
-	return c.client.CreateDatabase(c.context, database)
+	return database
 }
 
 // DropDatabases removes the database specified by name
@@ -246,12 +257,55 @@ func (c *MetastoreClient) AddPartitions(newParts []*hive_metastore.Partition) er
 	return err
 }
 
+// AlterPartitions modifies multiple existing partitions of a table in a single call.
+func (c *MetastoreClient) AlterPartitions(dbName string, tableName string,
+	partitions []*hive_metastore.Partition) error {
+	return c.client.AlterPartitions(c.context, dbName, tableName, partitions)
+}
+
 // GetPartitions returns all (or up to maxCount partitions of a table.
 func (c *MetastoreClient) GetPartitions(dbName string, tableName string,
 	maxCount int) ([]*hive_metastore.Partition, error) {
 	return c.client.GetPartitions(c.context, dbName, tableName, int16(maxCount))
 }
 
+// GetPartitionsByFilter returns all (or up to maxCount) partitions of a table matching
+// the filter expression, for example ds > "2018-10-01". The filter is evaluated by HMS.
+func (c *MetastoreClient) GetPartitionsByFilter(dbName string, tableName string,
+	filter string, maxCount int) ([]*hive_metastore.Partition, error) {
+	return c.client.GetPartitionsByFilter(c.context, dbName, tableName, filter, int16(maxCount))
+}
+
+// GetPartitionNamesByFilter returns names of all (or up to maxCount) partitions of a
+// table matching the filter expression. Only partition values are transferred, so
+// partitions of large tables can be fetched in batches using GetPartitionsByNames.
+func (c *MetastoreClient) GetPartitionNamesByFilter(dbName string, tableName string,
+	filter string, maxCount int) ([]string, error) {
+	table, err := c.GetTable(dbName, tableName)
+	if err != nil {
+		return nil, err
+	}
+	request := hive_metastore.NewPartitionValuesRequest()
+	request.DbName = dbName
+	request.TblName = tableName
+	request.PartitionKeys = table.PartitionKeys
+	request.Filter = &filter
+	request.MaxParts = int64(maxCount)
+	response, err := c.client.GetPartitionValues(c.context, request)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(table.PartitionKeys))
+	for i, k := range table.PartitionKeys {
+		keys[i] = k.Name
+	}
+	names := make([]string, len(response.PartitionValues))
+	for i, row := range response.PartitionValues {
+		names[i] = MakePartName(keys, row.Row)
+	}
+	return names, nil
+}
+
 // DropPartitionByName drops partition specified by name.
 func (c *MetastoreClient) DropPartitionByName(dbName string,
 	tableName string, partName string, dropData bool) (bool, error) {
@@ -276,10 +330,31 @@ func (c *MetastoreClient) DropPartitions(dbName string,
 	return err
 }
 
+// DropPartitionsByNames drops multiple partitions within a single table.
+// Partitions are specified by names. Partition data is deleted if deleteData is true.
+func (c *MetastoreClient) DropPartitionsByNames(dbName string,
+	tableName string, partNames []string, deleteData bool) error {
+	dropRequest := hive_metastore.NewDropPartitionsRequest()
+	dropRequest.DbName = dbName
+	dropRequest.TblName = tableName
+	dropRequest.Parts = &hive_metastore.RequestPartsSpec{Names: partNames}
+	dropRequest.DeleteData = &deleteData
+	_, err := c.client.DropPartitionsReq(c.context, dropRequest)
+	return err
+}
+
 // GetCurrentNotificationId returns value of last notification ID
 func (c *MetastoreClient) GetCurrentNotificationId() (int64, error) {
 	r, err := c.client.GetCurrentNotificationEventId(c.context)
-	return r.EventId, err
+	if err != nil {
+		return 0, err
+	}
+	return r.EventId, nil
+}
+
+// GetMetastoreDbUUID returns unique ID of the metastore database
+func (c *MetastoreClient) GetMetastoreDbUUID() (string, error) {
+	return c.client.GetMetastoreDbUUID(c.context)
 }
 
 // AlterTable modifies existing table with data from the new table
@@ -0,0 +1,86 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ddl
+
+import "strings"
+
+const (
+	lazySimpleSerDe   = "org.apache.hadoop.hive.serde2.lazy.LazySimpleSerDe"
+	textInputFormat   = "org.apache.hadoop.mapred.TextInputFormat"
+	textOutputFormat  = "org.apache.hadoop.hive.ql.io.HiveIgnoreKeyTextOutputFormat"
+	storageHandlerKey = "storage_handler"
+)
+
+// StorageFormat describes file format which can be used with STORED AS clause.
+type StorageFormat struct {
+	Name         string
+	Serde        string
+	InputFormat  string
+	OutputFormat string
+}
+
+// storageFormats lists formats known to Hive. The order is important - when formats
+// share input and output formats, the first one wins during rendering.
+var storageFormats = []StorageFormat{
+	{"TEXTFILE", lazySimpleSerDe, textInputFormat, textOutputFormat},
+	{"SEQUENCEFILE", lazySimpleSerDe,
+		"org.apache.hadoop.mapred.SequenceFileInputFormat",
+		"org.apache.hadoop.hive.ql.io.HiveSequenceFileOutputFormat"},
+	{"RCFILE", "org.apache.hadoop.hive.serde2.columnar.LazyBinaryColumnarSerDe",
+		"org.apache.hadoop.hive.ql.io.RCFileInputFormat",
+		"org.apache.hadoop.hive.ql.io.RCFileOutputFormat"},
+	{"ORC", "org.apache.hadoop.hive.ql.io.orc.OrcSerde",
+		"org.apache.hadoop.hive.ql.io.orc.OrcInputFormat",
+		"org.apache.hadoop.hive.ql.io.orc.OrcOutputFormat"},
+	{"PARQUET", "org.apache.hadoop.hive.ql.io.parquet.serde.ParquetHiveSerDe",
+		"org.apache.hadoop.hive.ql.io.parquet.MapredParquetInputFormat",
+		"org.apache.hadoop.hive.ql.io.parquet.MapredParquetOutputFormat"},
+	{"AVRO", "org.apache.hadoop.hive.serde2.avro.AvroSerDe",
+		"org.apache.hadoop.hive.ql.io.avro.AvroContainerInputFormat",
+		"org.apache.hadoop.hive.ql.io.avro.AvroContainerOutputFormat"},
+	{"JSONFILE", "org.apache.hadoop.hive.serde2.JsonSerDe", textInputFormat, textOutputFormat},
+}
+
+// LookupStorageFormat returns storage format by its name (e.g. ORC or parquet).
+// Names are case-insensitive.
+func LookupStorageFormat(name string) (StorageFormat, bool) {
+	for _, f := range storageFormats {
+		if strings.EqualFold(f.Name, name) {
+			return f, true
+		}
+	}
+	return StorageFormat{}, false
+}
+
+// findStorageFormat returns storage format matching given input and output formats.
+// Formats with matching serde are preferred.
+func findStorageFormat(serde, inputFormat, outputFormat string) (StorageFormat, bool) {
+	var candidate *StorageFormat
+	for i, f := range storageFormats {
+		if f.InputFormat != inputFormat || f.OutputFormat != outputFormat {
+			continue
+		}
+		if f.Serde == serde {
+			return f, true
+		}
+		if candidate == nil {
+			candidate = &storageFormats[i]
+		}
+	}
+	if candidate == nil {
+		return StorageFormat{}, false
+	}
+	return *candidate, true
+}
@@ -0,0 +1,724 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ddl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+	"github.com/akolb1/gometastore/hmsclient/types"
+)
+
+// Serde parameters used by ROW FORMAT DELIMITED. Note that Hive spells
+// collection delimiter as "colelction.delim".
+const (
+	fieldDelimKey      = "field.delim"
+	serializationKey   = "serialization.format"
+	escapeDelimKey     = "escape.delim"
+	collectionDelimKey = "colelction.delim"
+	mapKeyDelimKey     = "mapkey.delim"
+	lineDelimKey       = "line.delim"
+	nullFormatKey      = "serialization.null.format"
+)
+
+// CreateTableStmt is a parsed CREATE TABLE statement.
+type CreateTableStmt struct {
+	// IfNotExists is true when statement has IF NOT EXISTS clause
+	IfNotExists bool
+	// Table is the builder for the table. Table.Db is empty if table name
+	// isn't qualified with a database name and there was no preceding USE statement.
+	Table *hmsclient.TableBuilder
+}
+
+// ParseCreateTable parses a single CREATE TABLE statement. The following subset
+// of HiveQL is supported:
+//
+//	CREATE [EXTERNAL] TABLE [IF NOT EXISTS] [db_name.]table_name
+//	  (col_name data_type [COMMENT 'col_comment'], ...)
+//	  [COMMENT 'table_comment']
+//	  [PARTITIONED BY (col_name data_type [COMMENT 'col_comment'], ...)]
+//	  [CLUSTERED BY (col_name, ...) [SORTED BY (col_name [ASC|DESC], ...)] INTO num_buckets BUCKETS]
+//	  [ROW FORMAT SERDE 'serde' [WITH SERDEPROPERTIES ('key'='value', ...)] |
+//	   ROW FORMAT DELIMITED [FIELDS TERMINATED BY 'c' [ESCAPED BY 'c']]
+//	     [COLLECTION ITEMS TERMINATED BY 'c'] [MAP KEYS TERMINATED BY 'c']
+//	     [LINES TERMINATED BY 'c'] [NULL DEFINED AS 'c']]
+//	  [STORED AS file_format | STORED AS INPUTFORMAT 'class' OUTPUTFORMAT 'class']
+//	  [LOCATION 'path']
+//	  [TBLPROPERTIES ('key'='value', ...)]
+func ParseCreateTable(stmt string) (*CreateTableStmt, error) {
+	stmts, err := ParseScript(stmt)
+	if err != nil {
+		return nil, err
+	}
+	if len(stmts) != 1 {
+		return nil, fmt.Errorf("expected a single CREATE TABLE statement, got %d", len(stmts))
+	}
+	return stmts[0], nil
+}
+
+// ParseScript parses a sequence of CREATE TABLE statements separated by semicolons.
+// USE db_name statements are supported as well and set the database for
+// subsequent unqualified table names. SQL comments are ignored.
+func ParseScript(script string) ([]*CreateTableStmt, error) {
+	p := &ddlParser{input: script}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	var result []*CreateTableStmt
+	currentDb := ""
+	for p.tok.kind != tokEOF {
+		if p.isPunct(";") {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		switch {
+		case p.isKeyword("use"):
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			db, err := p.identifier()
+			if err != nil {
+				return nil, err
+			}
+			currentDb = db
+		case p.isKeyword("create"):
+			stmt, err := p.parseCreateTable()
+			if err != nil {
+				return nil, err
+			}
+			if stmt.Table.Db == "" {
+				stmt.Table.Db = currentDb
+			}
+			result = append(result, stmt)
+		default:
+			return nil, p.errorf("unsupported statement starting with %q", p.tok.text)
+		}
+		if p.tok.kind != tokEOF && !p.isPunct(";") {
+			return nil, p.errorf("expected \";\", got %q", p.tok.text)
+		}
+	}
+	return result, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokQuotedIdent
+	tokString
+	tokNumber
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type ddlParser struct {
+	input string
+	pos   int
+	tok   token
+}
+
+// errorf returns error with the line and column of the current token
+func (p *ddlParser) errorf(format string, args ...interface{}) error {
+	return p.errorAt(p.tok.pos, format, args...)
+}
+
+func (p *ddlParser) errorAt(pos int, format string, args ...interface{}) error {
+	line := 1 + strings.Count(p.input[:pos], "\n")
+	column := pos - strings.LastIndex(p.input[:pos], "\n")
+	return fmt.Errorf("line %d:%d: %s", line, column, fmt.Sprintf(format, args...))
+}
+
+// skipSpace skips whitespace and SQL comments
+func (p *ddlParser) skipSpace() error {
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			p.pos++
+		case strings.HasPrefix(p.input[p.pos:], "--"):
+			end := strings.IndexByte(p.input[p.pos:], '\n')
+			if end < 0 {
+				p.pos = len(p.input)
+			} else {
+				p.pos += end + 1
+			}
+		case strings.HasPrefix(p.input[p.pos:], "/*"):
+			end := strings.Index(p.input[p.pos+2:], "*/")
+			if end < 0 {
+				return p.errorAt(p.pos, "unterminated comment")
+			}
+			p.pos += end + 4
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (p *ddlParser) next() error {
+	if err := p.skipSpace(); err != nil {
+		return err
+	}
+	start := p.pos
+	if p.pos >= len(p.input) {
+		p.tok = token{kind: tokEOF, text: "end of input", pos: start}
+		return nil
+	}
+	c := p.input[p.pos]
+	switch {
+	case c == '`':
+		end := start + 1
+		var b strings.Builder
+		for {
+			if end >= len(p.input) {
+				return p.errorAt(start, "unterminated quoted identifier")
+			}
+			if p.input[end] == '`' {
+				if end+1 < len(p.input) && p.input[end+1] == '`' {
+					b.WriteByte('`')
+					end += 2
+					continue
+				}
+				break
+			}
+			b.WriteByte(p.input[end])
+			end++
+		}
+		p.pos = end + 1
+		p.tok = token{kind: tokQuotedIdent, text: b.String(), pos: start}
+	case c == '\'' || c == '"':
+		s, end, err := unquote(p.input, start)
+		if err != nil {
+			return p.errorAt(start, "%v", err)
+		}
+		p.pos = end
+		p.tok = token{kind: tokString, text: s, pos: start}
+	case c >= '0' && c <= '9':
+		for p.pos < len(p.input) && p.input[p.pos] >= '0' && p.input[p.pos] <= '9' {
+			p.pos++
+		}
+		p.tok = token{kind: tokNumber, text: p.input[start:p.pos], pos: start}
+	case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		for p.pos < len(p.input) && isIdentChar(p.input[p.pos]) {
+			p.pos++
+		}
+		p.tok = token{kind: tokIdent, text: p.input[start:p.pos], pos: start}
+	case strings.IndexByte("(),.;=<>:", c) >= 0:
+		p.pos++
+		p.tok = token{kind: tokPunct, text: string(c), pos: start}
+	default:
+		return p.errorAt(start, "unexpected character %q", c)
+	}
+	return nil
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// unquote parses string literal starting at position start and returns its value
+// and position after the closing quote. Backslash escapes are interpreted the
+// same way as Hive does.
+func unquote(input string, start int) (string, int, error) {
+	quote := input[start]
+	var b strings.Builder
+	for i := start + 1; i < len(input); i++ {
+		c := input[i]
+		switch {
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\\' && i+1 < len(input):
+			i++
+			switch input[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '0':
+				b.WriteByte(0)
+			default:
+				b.WriteByte(input[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+func (p *ddlParser) isKeyword(kw string) bool {
+	return p.tok.kind == tokIdent && strings.EqualFold(p.tok.text, kw)
+}
+
+func (p *ddlParser) isPunct(punct string) bool {
+	return p.tok.kind == tokPunct && p.tok.text == punct
+}
+
+// expectKeywords consumes a sequence of keywords
+func (p *ddlParser) expectKeywords(keywords ...string) error {
+	for _, kw := range keywords {
+		if !p.isKeyword(kw) {
+			return p.errorf("expected %s, got %q", strings.ToUpper(kw), p.tok.text)
+		}
+		if err := p.next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *ddlParser) expect(punct string) error {
+	if !p.isPunct(punct) {
+		return p.errorf("expected %q, got %q", punct, p.tok.text)
+	}
+	return p.next()
+}
+
+// identifier consumes plain or quoted identifier
+func (p *ddlParser) identifier() (string, error) {
+	if p.tok.kind != tokIdent && p.tok.kind != tokQuotedIdent {
+		return "", p.errorf("expected identifier, got %q", p.tok.text)
+	}
+	name := p.tok.text
+	return name, p.next()
+}
+
+func (p *ddlParser) stringLiteral() (string, error) {
+	if p.tok.kind != tokString {
+		return "", p.errorf("expected string literal, got %q", p.tok.text)
+	}
+	s := p.tok.text
+	return s, p.next()
+}
+
+func (p *ddlParser) parseCreateTable() (*CreateTableStmt, error) {
+	if err := p.expectKeywords("create"); err != nil {
+		return nil, err
+	}
+	stmt := &CreateTableStmt{}
+	external := false
+	if p.isKeyword("temporary") {
+		return nil, p.errorf("temporary tables are not supported")
+	}
+	if p.isKeyword("external") {
+		external = true
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectKeywords("table"); err != nil {
+		return nil, err
+	}
+	if p.isKeyword("if") {
+		if err := p.expectKeywords("if", "not", "exists"); err != nil {
+			return nil, err
+		}
+		stmt.IfNotExists = true
+	}
+	dbName := ""
+	tableName, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+	if p.isPunct(".") {
+		if err = p.next(); err != nil {
+			return nil, err
+		}
+		dbName = tableName
+		if tableName, err = p.identifier(); err != nil {
+			return nil, err
+		}
+	}
+	tb := hmsclient.NewTableBuilder(dbName, tableName)
+	stmt.Table = tb
+	if external {
+		tb.AsExternal()
+	}
+	if p.isKeyword("like") || p.isKeyword("as") {
+		return nil, p.errorf("CREATE TABLE %s is not supported", strings.ToUpper(p.tok.text))
+	}
+	if p.isPunct("(") {
+		if tb.Columns, err = p.parseColumns(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Remaining clauses may appear in any order but only once
+	seen := make(map[string]bool)
+	for p.tok.kind == tokIdent {
+		clause := strings.ToUpper(p.tok.text)
+		if seen[clause] {
+			return nil, p.errorf("duplicate %s clause", clause)
+		}
+		seen[clause] = true
+		switch clause {
+		case "COMMENT":
+			if err = p.next(); err != nil {
+				return nil, err
+			}
+			comment, err := p.stringLiteral()
+			if err != nil {
+				return nil, err
+			}
+			tb.WithParameter(commentKey, comment)
+		case "PARTITIONED":
+			if err = p.expectKeywords("partitioned", "by"); err != nil {
+				return nil, err
+			}
+			if tb.PartitionKeys, err = p.parseColumns(); err != nil {
+				return nil, err
+			}
+		case "CLUSTERED":
+			err = p.parseClusteredBy(tb)
+		case "ROW":
+			err = p.parseRowFormat(tb)
+		case "STORED":
+			err = p.parseStoredAs(tb, seen["ROW"])
+		case "LOCATION":
+			if err = p.next(); err != nil {
+				return nil, err
+			}
+			if tb.Location, err = p.stringLiteral(); err != nil {
+				return nil, err
+			}
+		case "TBLPROPERTIES":
+			if err = p.next(); err != nil {
+				return nil, err
+			}
+			props, err := p.parseProperties()
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range props {
+				tb.WithParameter(k, v)
+			}
+		default:
+			return nil, p.errorf("unsupported clause %q", p.tok.text)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+// parseColumns parses (name type [COMMENT 'comment'], ...) list
+func (p *ddlParser) parseColumns() ([]hive_metastore.FieldSchema, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var columns []hive_metastore.FieldSchema
+	for {
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		typ, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		col := hive_metastore.FieldSchema{Name: name, Type: typ}
+		if p.isKeyword("comment") {
+			if err = p.next(); err != nil {
+				return nil, err
+			}
+			if col.Comment, err = p.stringLiteral(); err != nil {
+				return nil, err
+			}
+		}
+		columns = append(columns, col)
+		if p.isPunct(")") {
+			return columns, p.next()
+		}
+		if err = p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseType consumes column type and returns its canonical representation.
+// Type ends with comma, closing parenthesis or COMMENT keyword outside of
+// any brackets.
+func (p *ddlParser) parseType() (string, error) {
+	start := p.tok.pos
+	depth := 0
+	for {
+		switch {
+		case p.tok.kind == tokEOF:
+			return "", p.errorf("unexpected end of input in column type")
+		case p.isPunct("<"), p.isPunct("("):
+			depth++
+		case p.isPunct(">"), p.isPunct(")"):
+			if depth == 0 {
+				return p.typeAt(start)
+			}
+			depth--
+		case depth == 0 && (p.isPunct(",") || p.isKeyword("comment")):
+			return p.typeAt(start)
+		}
+		if err := p.next(); err != nil {
+			return "", err
+		}
+	}
+}
+
+// typeAt validates type text between start and the current token
+func (p *ddlParser) typeAt(start int) (string, error) {
+	text := strings.TrimSpace(p.input[start:p.tok.pos])
+	if text == "" {
+		return "", p.errorAt(start, "missing column type")
+	}
+	t, err := types.Parse(text)
+	if err != nil {
+		return "", p.errorAt(start, "%v", err)
+	}
+	return t.String(), nil
+}
+
+func (p *ddlParser) parseClusteredBy(tb *hmsclient.TableBuilder) error {
+	if err := p.expectKeywords("clustered", "by"); err != nil {
+		return err
+	}
+	columns, err := p.parseIdentifierList()
+	if err != nil {
+		return err
+	}
+	if p.isKeyword("sorted") {
+		if err = p.expectKeywords("sorted", "by"); err != nil {
+			return err
+		}
+		if err = p.expect("("); err != nil {
+			return err
+		}
+		var sortCols []hive_metastore.Order
+		for {
+			name, err := p.identifier()
+			if err != nil {
+				return err
+			}
+			order := hive_metastore.Order{Col: name, Order: 1}
+			if p.isKeyword("asc") || p.isKeyword("desc") {
+				if p.isKeyword("desc") {
+					order.Order = 0
+				}
+				if err = p.next(); err != nil {
+					return err
+				}
+			}
+			sortCols = append(sortCols, order)
+			if p.isPunct(")") {
+				break
+			}
+			if err = p.expect(","); err != nil {
+				return err
+			}
+		}
+		if err = p.next(); err != nil {
+			return err
+		}
+		tb.WithSortColumns(sortCols)
+	}
+	if err = p.expectKeywords("into"); err != nil {
+		return err
+	}
+	if p.tok.kind != tokNumber {
+		return p.errorf("expected number of buckets, got %q", p.tok.text)
+	}
+	numBuckets, err := strconv.Atoi(p.tok.text)
+	if err != nil || numBuckets <= 0 {
+		return p.errorf("invalid number of buckets %q", p.tok.text)
+	}
+	if err = p.next(); err != nil {
+		return err
+	}
+	tb.WithBuckets(numBuckets, columns)
+	return p.expectKeywords("buckets")
+}
+
+// parseIdentifierList parses (name, ...) list
+func (p *ddlParser) parseIdentifierList() ([]string, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var names []string
+	for {
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if p.isPunct(")") {
+			return names, p.next()
+		}
+		if err = p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseProperties parses ('key'='value', ...) list
+func (p *ddlParser) parseProperties() (map[string]string, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	props := make(map[string]string)
+	for {
+		key, err := p.stringLiteral()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect("="); err != nil {
+			return nil, err
+		}
+		value, err := p.stringLiteral()
+		if err != nil {
+			return nil, err
+		}
+		props[key] = value
+		if p.isPunct(")") {
+			return props, p.next()
+		}
+		if err = p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *ddlParser) parseRowFormat(tb *hmsclient.TableBuilder) error {
+	if err := p.expectKeywords("row", "format"); err != nil {
+		return err
+	}
+	if p.isKeyword("serde") {
+		if err := p.next(); err != nil {
+			return err
+		}
+		serde, err := p.stringLiteral()
+		if err != nil {
+			return err
+		}
+		tb.WithSerde(serde)
+		if p.isKeyword("with") {
+			if err = p.expectKeywords("with", "serdeproperties"); err != nil {
+				return err
+			}
+			props, err := p.parseProperties()
+			if err != nil {
+				return err
+			}
+			for k, v := range props {
+				tb.WithSerdeParameter(k, v)
+			}
+		}
+		return nil
+	}
+	if err := p.expectKeywords("delimited"); err != nil {
+		return err
+	}
+	tb.WithSerde(lazySimpleSerDe)
+	// delimiter sets the serde parameter from the string literal following the keywords
+	delimiter := func(key string, keywords ...string) error {
+		if err := p.expectKeywords(keywords...); err != nil {
+			return err
+		}
+		value, err := p.stringLiteral()
+		if err != nil {
+			return err
+		}
+		tb.WithSerdeParameter(key, value)
+		return nil
+	}
+	for {
+		var err error
+		switch {
+		case p.isKeyword("fields"):
+			if err = delimiter(fieldDelimKey, "fields", "terminated", "by"); err == nil {
+				tb.WithSerdeParameter(serializationKey, tb.SerdeParameters[fieldDelimKey])
+				if p.isKeyword("escaped") {
+					err = delimiter(escapeDelimKey, "escaped", "by")
+				}
+			}
+		case p.isKeyword("collection"):
+			err = delimiter(collectionDelimKey, "collection", "items", "terminated", "by")
+		case p.isKeyword("map"):
+			err = delimiter(mapKeyDelimKey, "map", "keys", "terminated", "by")
+		case p.isKeyword("lines"):
+			err = delimiter(lineDelimKey, "lines", "terminated", "by")
+		case p.isKeyword("null"):
+			err = delimiter(nullFormatKey, "null", "defined", "as")
+		default:
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// parseStoredAs parses STORED AS clause. If the table has explicit ROW FORMAT,
+// its serde is preserved.
+func (p *ddlParser) parseStoredAs(tb *hmsclient.TableBuilder, hasRowFormat bool) error {
+	if err := p.expectKeywords("stored"); err != nil {
+		return err
+	}
+	if p.isKeyword("by") {
+		return p.errorf("STORED BY is not supported")
+	}
+	if err := p.expectKeywords("as"); err != nil {
+		return err
+	}
+	if p.isKeyword("inputformat") {
+		if err := p.next(); err != nil {
+			return err
+		}
+		inputFormat, err := p.stringLiteral()
+		if err != nil {
+			return err
+		}
+		if err = p.expectKeywords("outputformat"); err != nil {
+			return err
+		}
+		outputFormat, err := p.stringLiteral()
+		if err != nil {
+			return err
+		}
+		tb.WithInputFormat(inputFormat).WithOutputFormat(outputFormat)
+		return nil
+	}
+	if p.tok.kind != tokIdent {
+		return p.errorf("expected file format, got %q", p.tok.text)
+	}
+	format, ok := LookupStorageFormat(p.tok.text)
+	if !ok {
+		return p.errorf("unknown file format %q", p.tok.text)
+	}
+	tb.WithInputFormat(format.InputFormat).WithOutputFormat(format.OutputFormat)
+	if !hasRowFormat {
+		tb.WithSerde(format.Serde)
+	}
+	return p.next()
+}
@@ -0,0 +1,152 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ddl_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/akolb1/gometastore/hmsclient/ddl"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+)
+
+func TestParseCreateTable(t *testing.T) {
+	stmt, err := ddl.ParseCreateTable(`
+-- Orders table
+CREATE EXTERNAL TABLE IF NOT EXISTS sales.orders (
+  id BIGINT COMMENT 'order id',
+  price DECIMAL(10, 2),
+  tags ARRAY<STRING>,
+  info STRUCT<a:INT, b:MAP<STRING,INT>> COMMENT 'extra info'
+)
+COMMENT 'All orders'
+PARTITIONED BY (ds STRING COMMENT 'date', hr INT)
+CLUSTERED BY (id) SORTED BY (id DESC) INTO 8 BUCKETS
+ROW FORMAT DELIMITED FIELDS TERMINATED BY ',' LINES TERMINATED BY '\n'
+STORED AS TEXTFILE
+LOCATION 'hdfs://nn:8020/data/orders'
+TBLPROPERTIES ('owner.team'='finance', 'skip.header.line.count'='1');
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stmt.IfNotExists {
+		t.Error("IF NOT EXISTS is not detected")
+	}
+	tb := stmt.Table
+	if tb.Db != "sales" || tb.Name != "orders" {
+		t.Errorf("invalid table name %s.%s", tb.Db, tb.Name)
+	}
+	expectedColumns := []hive_metastore.FieldSchema{
+		{Name: "id", Type: "bigint", Comment: "order id"},
+		{Name: "price", Type: "decimal(10,2)"},
+		{Name: "tags", Type: "array<string>"},
+		{Name: "info", Type: "struct<a:int,b:map<string,int>>", Comment: "extra info"},
+	}
+	if !reflect.DeepEqual(tb.Columns, expectedColumns) {
+		t.Errorf("invalid columns %v", tb.Columns)
+	}
+	expectedKeys := []hive_metastore.FieldSchema{
+		{Name: "ds", Type: "string", Comment: "date"},
+		{Name: "hr", Type: "int"},
+	}
+	if !reflect.DeepEqual(tb.PartitionKeys, expectedKeys) {
+		t.Errorf("invalid partition keys %v", tb.PartitionKeys)
+	}
+	if tb.NumBuckets != 8 || !reflect.DeepEqual(tb.BucketColumns, []string{"id"}) ||
+		!reflect.DeepEqual(tb.SortColumns, []hive_metastore.Order{{Col: "id", Order: 0}}) {
+		t.Errorf("invalid bucketing %d %v %v", tb.NumBuckets, tb.BucketColumns, tb.SortColumns)
+	}
+	expectedSerdeParams := map[string]string{
+		"field.delim":          ",",
+		"serialization.format": ",",
+		"line.delim":           "\n",
+	}
+	if !reflect.DeepEqual(tb.SerdeParameters, expectedSerdeParams) {
+		t.Errorf("invalid serde parameters %v", tb.SerdeParameters)
+	}
+	expectedParams := map[string]string{
+		"EXTERNAL":               "true",
+		"comment":                "All orders",
+		"owner.team":             "finance",
+		"skip.header.line.count": "1",
+	}
+	if !reflect.DeepEqual(tb.Parameters, expectedParams) {
+		t.Errorf("invalid parameters %v", tb.Parameters)
+	}
+	if tb.Location != "hdfs://nn:8020/data/orders" {
+		t.Errorf("invalid location %s", tb.Location)
+	}
+}
+
+// Rendered DDL should parse back to the same table
+func TestParseRenderRoundTrip(t *testing.T) {
+	table := testTable()
+	stmt, err := ddl.ParseCreateTable(ddl.CreateTable(table))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := stmt.Table.Build()
+	if got, expected := ddl.CreateTable(parsed), ddl.CreateTable(table); got != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
+
+func TestParseScript(t *testing.T) {
+	stmts, err := ddl.ParseScript(`
+USE staging;
+CREATE TABLE a (x int) STORED AS ORC;
+/* second table */
+CREATE TABLE other.b (y string) ROW FORMAT SERDE 'com.example.Serde'
+  WITH SERDEPROPERTIES ('k'='v') STORED AS PARQUET
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stmts) != 2 {
+		t.Fatalf("expected 2 statements, got %d", len(stmts))
+	}
+	a, b := stmts[0].Table, stmts[1].Table
+	if a.Db != "staging" || a.Serde != "org.apache.hadoop.hive.ql.io.orc.OrcSerde" {
+		t.Errorf("invalid table a: %s %s", a.Db, a.Serde)
+	}
+	parquet, _ := ddl.LookupStorageFormat("parquet")
+	if b.Db != "other" || b.Serde != "com.example.Serde" || b.InputFormat != parquet.InputFormat ||
+		b.SerdeParameters["k"] != "v" {
+		t.Errorf("invalid table b: %s %s %s %v", b.Db, b.Serde, b.InputFormat, b.SerdeParameters)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		stmt string
+		err  string
+	}{
+		{"CREATE TABLE t (x int", "line 1:22: unexpected end of input in column type"},
+		{"CREATE TABLE t (x strct<a:int>)", "line 1:19: invalid type \"strct<a:int>\": unknown type"},
+		{"CREATE TABLE t (x int)\nSTORED AS FOO", "line 2:11: unknown file format \"FOO\""},
+		{"CREATE TABLE t (x int) LOCATION '/a' LOCATION '/b'", "duplicate LOCATION clause"},
+		{"CREATE TEMPORARY TABLE t (x int)", "temporary tables are not supported"},
+		{"DROP TABLE t", "unsupported statement"},
+		{"CREATE TABLE t (x int) CLUSTERED BY (x) INTO 0 BUCKETS", "invalid number of buckets"},
+	}
+	for _, test := range tests {
+		_, err := ddl.ParseScript(test.stmt)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: expected error %q, got %v", test.stmt, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package ddl converts HMS objects to HiveQL DDL statements.
+
+The output mirrors SHOW CREATE TABLE output produced by Hive, so it can be
+reviewed by humans and executed with beeline to re-create the objects.
+
+Example:
+
+	table, _ := client.GetTable("default", "customers")
+	fmt.Print(ddl.CreateTable(table))
+*/
+package ddl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+)
+
+const (
+	externalKey          = "EXTERNAL"
+	commentKey           = "comment"
+	materializedViewType = "MATERIALIZED_VIEW"
+)
+
+// CreateDatabase returns CREATE DATABASE statement for the given database. If the database
+// has an owner, ALTER DATABASE SET OWNER statement is added as well.
+func CreateDatabase(db *hmsclient.Database) string {
+	var b strings.Builder
+	b.WriteString("CREATE DATABASE " + quoteIdent(db.Name))
+	if db.Description != "" {
+		b.WriteString("\nCOMMENT " + quoteString(db.Description))
+	}
+	if db.Location != "" {
+		b.WriteString("\nLOCATION\n  " + quoteString(db.Location))
+	}
+	if len(db.Parameters) != 0 {
+		b.WriteString("\nWITH DBPROPERTIES (\n" + renderProperties(db.Parameters, nil) + ")")
+	}
+	b.WriteString(";\n")
+	if db.Owner != "" {
+		principal := "USER"
+		if db.OwnerType == hive_metastore.PrincipalType_ROLE {
+			principal = "ROLE"
+		}
+		fmt.Fprintf(&b, "ALTER DATABASE %s SET OWNER %s %s;\n",
+			quoteIdent(db.Name), principal, quoteIdent(db.Owner))
+	}
+	return b.String()
+}
+
+// CreateTable returns CREATE TABLE or CREATE VIEW statement for the given table.
+func CreateTable(table *hive_metastore.Table) string {
+	if table.TableType == hmsclient.TableTypeView.String() ||
+		table.TableType == materializedViewType {
+		return createView(table)
+	}
+	var b strings.Builder
+	b.WriteString("CREATE ")
+	if table.Temporary {
+		b.WriteString("TEMPORARY ")
+	}
+	if isExternal(table) {
+		b.WriteString("EXTERNAL ")
+	}
+	b.WriteString("TABLE " + tableName(table))
+	sd := table.Sd
+	if sd == nil {
+		sd = &hive_metastore.StorageDescriptor{}
+	}
+	if len(sd.Cols) != 0 {
+		b.WriteString("(\n" + renderColumns(sd.Cols) + ")")
+	}
+	if comment := table.Parameters[commentKey]; comment != "" {
+		b.WriteString("\nCOMMENT " + quoteString(comment))
+	}
+	if len(table.PartitionKeys) != 0 {
+		b.WriteString("\nPARTITIONED BY (\n" + renderColumns(table.PartitionKeys) + ")")
+	}
+	if sd.NumBuckets > 0 && len(sd.BucketCols) != 0 {
+		b.WriteString("\nCLUSTERED BY (\n  " + quoteIdents(sd.BucketCols) + ")")
+		if len(sd.SortCols) != 0 {
+			sortCols := make([]string, len(sd.SortCols))
+			for i, o := range sd.SortCols {
+				direction := "ASC"
+				if o.Order == 0 {
+					direction = "DESC"
+				}
+				sortCols[i] = quoteIdent(o.Col) + " " + direction
+			}
+			b.WriteString("\nSORTED BY (\n  " + strings.Join(sortCols, ",\n  ") + ")")
+		}
+		fmt.Fprintf(&b, "\nINTO %d BUCKETS", sd.NumBuckets)
+	}
+	b.WriteString(renderStorage(table))
+	if sd.Location != "" {
+		b.WriteString("\nLOCATION\n  " + quoteString(sd.Location))
+	}
+	skip := map[string]bool{externalKey: true, commentKey: true, storageHandlerKey: true}
+	if props := renderProperties(table.Parameters, skip); props != "" {
+		b.WriteString("\nTBLPROPERTIES (\n" + props + ")")
+	}
+	b.WriteString(";\n")
+	return b.String()
+}
+
+// AddPartitions returns ALTER TABLE ADD PARTITION statements for the given partitions
+// of the table, one statement per partition.
+func AddPartitions(table *hive_metastore.Table, partitions []*hive_metastore.Partition) string {
+	var b strings.Builder
+	for _, p := range partitions {
+		spec := make([]string, len(p.Values))
+		for i, v := range p.Values {
+			name := fmt.Sprintf("_c%d", i)
+			if i < len(table.PartitionKeys) {
+				name = table.PartitionKeys[i].Name
+			}
+			spec[i] = quoteIdent(name) + "=" + quoteString(v)
+		}
+		fmt.Fprintf(&b, "ALTER TABLE %s ADD IF NOT EXISTS PARTITION (%s)",
+			tableName(table), strings.Join(spec, ", "))
+		if p.Sd != nil && p.Sd.Location != "" {
+			b.WriteString(" LOCATION " + quoteString(p.Sd.Location))
+		}
+		b.WriteString(";\n")
+	}
+	return b.String()
+}
+
+func createView(table *hive_metastore.Table) string {
+	var b strings.Builder
+	if table.TableType == materializedViewType {
+		b.WriteString("CREATE MATERIALIZED VIEW ")
+	} else {
+		b.WriteString("CREATE VIEW ")
+	}
+	b.WriteString(tableName(table))
+	if comment := table.Parameters[commentKey]; comment != "" {
+		b.WriteString("\nCOMMENT " + quoteString(comment))
+	}
+	if props := renderProperties(table.Parameters, map[string]bool{commentKey: true}); props != "" {
+		b.WriteString("\nTBLPROPERTIES (\n" + props + ")")
+	}
+	text := table.ViewExpandedText
+	if text == "" {
+		text = table.ViewOriginalText
+	}
+	b.WriteString(" AS\n" + strings.TrimSuffix(strings.TrimSpace(text), ";") + ";\n")
+	return b.String()
+}
+
+// renderStorage returns ROW FORMAT and STORED AS clauses
+func renderStorage(table *hive_metastore.Table) string {
+	sd := table.Sd
+	if sd == nil {
+		return ""
+	}
+	serde := ""
+	var serdeParams map[string]string
+	if sd.SerdeInfo != nil {
+		serde = sd.SerdeInfo.SerializationLib
+		serdeParams = sd.SerdeInfo.Parameters
+	}
+	var b strings.Builder
+	serdeProperties := ""
+	if len(serdeParams) != 0 {
+		serdeProperties = "\nWITH SERDEPROPERTIES (\n" + renderProperties(serdeParams, nil) + ")"
+	}
+	if handler := table.Parameters[storageHandlerKey]; handler != "" {
+		b.WriteString("\nSTORED BY\n  " + quoteString(handler) + serdeProperties)
+		return b.String()
+	}
+	format, known := findStorageFormat(serde, sd.InputFormat, sd.OutputFormat)
+	if serde != "" && (!known || serde != format.Serde || serdeProperties != "") {
+		b.WriteString("\nROW FORMAT SERDE\n  " + quoteString(serde) + serdeProperties)
+	}
+	if known {
+		b.WriteString("\nSTORED AS " + format.Name)
+	} else if sd.InputFormat != "" || sd.OutputFormat != "" {
+		b.WriteString("\nSTORED AS INPUTFORMAT\n  " + quoteString(sd.InputFormat) +
+			"\nOUTPUTFORMAT\n  " + quoteString(sd.OutputFormat))
+	}
+	return b.String()
+}
+
+func isExternal(table *hive_metastore.Table) bool {
+	return table.TableType == hmsclient.TableTypeExternal.String() ||
+		strings.EqualFold(table.Parameters[externalKey], "true")
+}
+
+func tableName(table *hive_metastore.Table) string {
+	if table.DbName == "" {
+		return quoteIdent(table.TableName)
+	}
+	return quoteIdent(table.DbName) + "." + quoteIdent(table.TableName)
+}
+
+func renderColumns(cols []*hive_metastore.FieldSchema) string {
+	lines := make([]string, len(cols))
+	for i, c := range cols {
+		typ := c.Type
+		if typ == "" {
+			typ = "string"
+		}
+		lines[i] = "  " + quoteIdent(c.Name) + " " + typ
+		if c.Comment != "" {
+			lines[i] += " COMMENT " + quoteString(c.Comment)
+		}
+	}
+	return strings.Join(lines, ",\n")
+}
+
+// renderProperties returns 'key'='value' list sorted by key, one property per line.
+// Keys in the skip set are not included.
+func renderProperties(params map[string]string, skip map[string]bool) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		if !skip[k] {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	sort.Strings(keys)
+	lines := make([]string, len(keys))
+	for i, k := range keys {
+		lines[i] = "  " + quoteString(k) + "=" + quoteString(params[k])
+	}
+	return strings.Join(lines, ",\n")
+}
+
+func quoteIdent(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+func quoteIdents(names []string) string {
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = quoteIdent(n)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+var stringEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\t", `\t`)
+
+func quoteString(s string) string {
+	return "'" + stringEscaper.Replace(s) + "'"
+}
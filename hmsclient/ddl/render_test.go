@@ -0,0 +1,151 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ddl_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/ddl"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+)
+
+func testTable() *hive_metastore.Table {
+	orc, _ := ddl.LookupStorageFormat("orc")
+	return &hive_metastore.Table{
+		DbName:    "sales",
+		TableName: "orders",
+		TableType: hmsclient.TableTypeExternal.String(),
+		Parameters: map[string]string{
+			"EXTERNAL":     "TRUE",
+			"comment":      "All orders",
+			"orc.compress": "ZLIB",
+		},
+		PartitionKeys: []*hive_metastore.FieldSchema{{Name: "ds", Type: "string"}},
+		Sd: &hive_metastore.StorageDescriptor{
+			Cols: []*hive_metastore.FieldSchema{
+				{Name: "id", Type: "bigint", Comment: "order id"},
+				{Name: "note", Type: "string", Comment: "it's free text"},
+			},
+			Location:     "hdfs://nn:8020/data/orders",
+			InputFormat:  orc.InputFormat,
+			OutputFormat: orc.OutputFormat,
+			SerdeInfo:    &hive_metastore.SerDeInfo{SerializationLib: orc.Serde},
+			NumBuckets:   4,
+			BucketCols:   []string{"id"},
+			SortCols:     []*hive_metastore.Order{{Col: "id", Order: 1}},
+		},
+	}
+}
+
+func TestCreateTable(t *testing.T) {
+	expected := "CREATE EXTERNAL TABLE `sales`.`orders`(\n" +
+		"  `id` bigint COMMENT 'order id',\n" +
+		"  `note` string COMMENT 'it\\'s free text')\n" +
+		"COMMENT 'All orders'\n" +
+		"PARTITIONED BY (\n" +
+		"  `ds` string)\n" +
+		"CLUSTERED BY (\n" +
+		"  `id`)\n" +
+		"SORTED BY (\n" +
+		"  `id` ASC)\n" +
+		"INTO 4 BUCKETS\n" +
+		"STORED AS ORC\n" +
+		"LOCATION\n" +
+		"  'hdfs://nn:8020/data/orders'\n" +
+		"TBLPROPERTIES (\n" +
+		"  'orc.compress'='ZLIB');\n"
+	if got := ddl.CreateTable(testTable()); got != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
+
+func TestCreateTableCustomFormat(t *testing.T) {
+	table := &hive_metastore.Table{
+		DbName:    "default",
+		TableName: "logs",
+		TableType: hmsclient.TableTypeManaged.String(),
+		Sd: &hive_metastore.StorageDescriptor{
+			Cols:         []*hive_metastore.FieldSchema{{Name: "line"}},
+			InputFormat:  "com.example.LogInputFormat",
+			OutputFormat: "com.example.LogOutputFormat",
+			SerdeInfo: &hive_metastore.SerDeInfo{
+				SerializationLib: "com.example.LogSerde",
+				Parameters:       map[string]string{"field.delim": "\t"},
+			},
+		},
+	}
+	expected := "CREATE TABLE `default`.`logs`(\n" +
+		"  `line` string)\n" +
+		"ROW FORMAT SERDE\n" +
+		"  'com.example.LogSerde'\n" +
+		"WITH SERDEPROPERTIES (\n" +
+		"  'field.delim'='\\t')\n" +
+		"STORED AS INPUTFORMAT\n" +
+		"  'com.example.LogInputFormat'\n" +
+		"OUTPUTFORMAT\n" +
+		"  'com.example.LogOutputFormat';\n"
+	if got := ddl.CreateTable(table); got != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
+
+func TestCreateView(t *testing.T) {
+	view := &hive_metastore.Table{
+		DbName:           "sales",
+		TableName:        "big_orders",
+		TableType:        hmsclient.TableTypeView.String(),
+		ViewOriginalText: "select * from orders where id > 100",
+		ViewExpandedText: "select `orders`.`id` from `sales`.`orders` where `orders`.`id` > 100",
+	}
+	expected := "CREATE VIEW `sales`.`big_orders` AS\n" +
+		"select `orders`.`id` from `sales`.`orders` where `orders`.`id` > 100;\n"
+	if got := ddl.CreateTable(view); got != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
+
+func TestAddPartitions(t *testing.T) {
+	table := testTable()
+	partitions := []*hive_metastore.Partition{
+		{Values: []string{"2018-10-01"}, Sd: &hive_metastore.StorageDescriptor{Location: "/data/orders/ds=2018-10-01"}},
+		{Values: []string{"2018-10-02"}},
+	}
+	expected := "ALTER TABLE `sales`.`orders` ADD IF NOT EXISTS PARTITION (`ds`='2018-10-01') " +
+		"LOCATION '/data/orders/ds=2018-10-01';\n" +
+		"ALTER TABLE `sales`.`orders` ADD IF NOT EXISTS PARTITION (`ds`='2018-10-02');\n"
+	if got := ddl.AddPartitions(table, partitions); got != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
+
+func ExampleCreateDatabase() {
+	fmt.Print(ddl.CreateDatabase(&hmsclient.Database{
+		Name:        "sales",
+		Description: "Sales data",
+		Location:    "hdfs://nn:8020/warehouse/sales.db",
+		Owner:       "admin",
+		Parameters:  map[string]string{"team": "finance"},
+	}))
+	// Output:
+	// CREATE DATABASE `sales`
+	// COMMENT 'Sales data'
+	// LOCATION
+	//   'hdfs://nn:8020/warehouse/sales.db'
+	// WITH DBPROPERTIES (
+	//   'team'='finance');
+	// ALTER DATABASE `sales` SET OWNER USER `admin`;
+}
@@ -16,9 +16,9 @@ package hmsclient
 
 import (
 	"fmt"
-	"strings"
 
 	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+	"github.com/akolb1/gometastore/hmsclient/types"
 )
 
 const (
@@ -29,17 +29,21 @@ const (
 
 // TableBuilder provides builder pattern for table objects
 type TableBuilder struct {
-	Db            string
-	Name          string
-	Type          TableType
-	Serde         string
-	Owner         string
-	InputFormat   string
-	OutputFormat  string
-	Location      string
-	Columns       []hive_metastore.FieldSchema
-	PartitionKeys []hive_metastore.FieldSchema
-	Parameters    map[string]string
+	Db              string
+	Name            string
+	Type            TableType
+	Serde           string
+	SerdeParameters map[string]string
+	Owner           string
+	InputFormat     string
+	OutputFormat    string
+	Location        string
+	Columns         []hive_metastore.FieldSchema
+	PartitionKeys   []hive_metastore.FieldSchema
+	BucketColumns   []string
+	SortColumns     []hive_metastore.Order
+	NumBuckets      int
+	Parameters      map[string]string
 }
 
 type PartitionBuilder struct {
@@ -65,6 +69,19 @@ func convertSchema(columns []hive_metastore.FieldSchema) []*hive_metastore.Field
 	return cols
 }
 
+// convertOrder converts list of Order to list of pointers to Order
+func convertOrder(columns []hive_metastore.Order) []*hive_metastore.Order {
+	if len(columns) == 0 {
+		return nil
+	}
+	cols := make([]*hive_metastore.Order, len(columns))
+	for i := range columns {
+		col := columns[i]
+		cols[i] = &col
+	}
+	return cols
+}
+
 // Build HMS Table object.
 func (tb *TableBuilder) Build() *hive_metastore.Table {
 	return &hive_metastore.Table{
@@ -79,14 +96,46 @@ func (tb *TableBuilder) Build() *hive_metastore.Table {
 			OutputFormat: tb.OutputFormat,
 			Location:     tb.Location,
 			Cols:         convertSchema(tb.Columns),
+			NumBuckets:   int32(tb.NumBuckets),
+			BucketCols:   tb.BucketColumns,
+			SortCols:     convertOrder(tb.SortColumns),
 			SerdeInfo: &hive_metastore.SerDeInfo{
 				Name:             tb.Name,
 				SerializationLib: tb.Serde,
+				Parameters:       tb.SerdeParameters,
 			},
 		},
 	}
 }
 
+// Validate checks that types of all columns and partition keys are valid Hive types.
+// Partition keys should have primitive types. Empty type is interpreted as string.
+func (tb *TableBuilder) Validate() error {
+	for _, col := range tb.Columns {
+		if _, err := parseColumnType(col); err != nil {
+			return fmt.Errorf("column %s: %v", col.Name, err)
+		}
+	}
+	for _, key := range tb.PartitionKeys {
+		t, err := parseColumnType(key)
+		if err != nil {
+			return fmt.Errorf("partition key %s: %v", key.Name, err)
+		}
+		if !types.IsPrimitive(t) {
+			return fmt.Errorf("partition key %s: type %s is not primitive", key.Name, t)
+		}
+	}
+	return nil
+}
+
+// parseColumnType returns parsed type of the column, treating empty type as string.
+func parseColumnType(col hive_metastore.FieldSchema) (types.Type, error) {
+	if col.Type == "" {
+		return &types.Primitive{Name: types.String}, nil
+	}
+	return types.Parse(col.Type)
+}
+
 func NewTableBuilder(db string, tableName string) *TableBuilder {
 	return &TableBuilder{
 		Db:           db,
@@ -133,6 +182,28 @@ func (tb *TableBuilder) WithSerde(serde string) *TableBuilder {
 	return tb
 }
 
+// WithSerdeParameter adds serde parameter
+func (tb *TableBuilder) WithSerdeParameter(name string, value string) *TableBuilder {
+	if tb.SerdeParameters == nil {
+		tb.SerdeParameters = make(map[string]string)
+	}
+	tb.SerdeParameters[name] = value
+	return tb
+}
+
+// WithBuckets specifies number of buckets and bucketing columns
+func (tb *TableBuilder) WithBuckets(numBuckets int, columns []string) *TableBuilder {
+	tb.NumBuckets = numBuckets
+	tb.BucketColumns = columns
+	return tb
+}
+
+// WithSortColumns specifies sort order within buckets
+func (tb *TableBuilder) WithSortColumns(columns []hive_metastore.Order) *TableBuilder {
+	tb.SortColumns = columns
+	return tb
+}
+
 // WithInputFormat specifies table input format
 func (tb *TableBuilder) WithInputFormat(format string) *TableBuilder {
 	tb.InputFormat = format
@@ -175,12 +246,12 @@ func (p *PartitionBuilder) Build() *hive_metastore.Partition {
 	if p.Location != "" {
 		sd.Location = p.Location
 	} else {
-		// Construct name=value list for each partition
-		partNames := make([]string, len(partitionKeys))
+		// Partition location is table location followed by escaped partition name
+		keys := make([]string, len(partitionKeys))
 		for i, p := range partitionKeys {
-			partNames[i] = p.Name + "=" + values[i]
+			keys[i] = p.Name
 		}
-		sd.Location = sd.Location + "/" + strings.Join(partNames, "/")
+		sd.Location = sd.Location + "/" + MakePartName(keys, values)
 	}
 	return &hive_metastore.Partition{
 		Values:     values,
@@ -191,6 +262,10 @@ func (p *PartitionBuilder) Build() *hive_metastore.Partition {
 	}
 }
 
+// NewPartitionBuilder creates builder for partition with the given string values.
+// Values are used as given, like HMS does, so values of existing partitions
+// are preserved. Use NewTypedPartitionBuilder to validate values against types
+// of partition keys.
 func NewPartitionBuilder(table *hive_metastore.Table, values []string) (*PartitionBuilder, error) {
 	if len(table.PartitionKeys) != len(values) {
 		return nil, fmt.Errorf("number of provided partition values %d does not match partition"+
@@ -200,6 +275,43 @@ func NewPartitionBuilder(table *hive_metastore.Table, values []string) (*Partiti
 	return &PartitionBuilder{Table: table, Values: values}, nil
 }
 
+// NewTypedPartitionBuilder creates builder for partition with the given typed values.
+// Values are converted to strings according to types of partition keys and rejected
+// if they don't fit the type, see types.FormatValue for supported Go types.
+// For example, time.Time is formatted as 2018-10-01 for date keys, while string
+// "2018-10-1" is rejected. Nil value is converted to DefaultPartitionName.
+func NewTypedPartitionBuilder(table *hive_metastore.Table, values ...interface{}) (*PartitionBuilder, error) {
+	if len(table.PartitionKeys) != len(values) {
+		return nil, fmt.Errorf("number of provided partition values %d does not match partition"+
+			" schema which has %d columns",
+			len(values), len(table.PartitionKeys))
+	}
+	stringValues := make([]string, len(values))
+	for i, key := range table.PartitionKeys {
+		value, err := formatPartitionValue(key, values[i])
+		if err != nil {
+			return nil, fmt.Errorf("partition key %s: %v", key.Name, err)
+		}
+		stringValues[i] = value
+	}
+	return &PartitionBuilder{Table: table, Values: stringValues}, nil
+}
+
+// formatPartitionValue converts value of the partition key to string
+func formatPartitionValue(key *hive_metastore.FieldSchema, value interface{}) (string, error) {
+	if value == nil || value == DefaultPartitionName {
+		return DefaultPartitionName, nil
+	}
+	t, err := parseColumnType(*key)
+	if err != nil {
+		return "", err
+	}
+	if !types.IsPrimitive(t) {
+		return "", fmt.Errorf("type %s is not primitive", t)
+	}
+	return types.FormatValue(t, value)
+}
+
 func (pb *PartitionBuilder) WithLocation(location string) *PartitionBuilder {
 	pb.Location = location
 	return pb
@@ -219,7 +331,7 @@ func (pb *PartitionBuilder) WithParameter(key string, value string) *PartitionBu
 }
 
 // MakePartition creates Partition object from ordered list of partition values.
-// Only string values are currently supported.
+// Values are used as given, see MakeTypedPartition for validated values.
 // Parameters:
 //   table  - Hive table for which partition is added
 //   values - List of partition values which should match partition schema
@@ -235,3 +347,18 @@ func MakePartition(table *hive_metastore.Table,
 			Build(), nil
 	}
 }
+
+// MakeTypedPartition creates Partition object from ordered list of typed partition
+// values which are converted to strings according to types of partition keys.
+func MakeTypedPartition(table *hive_metastore.Table,
+	values []interface{}, parameters map[string]string,
+	location string) (*hive_metastore.Partition, error) {
+	pb, err := NewTypedPartitionBuilder(table, values...)
+	if err != nil {
+		return nil, err
+	}
+	return pb.
+		WithLocation(location).
+		WithParameters(parameters).
+		Build(), nil
+}
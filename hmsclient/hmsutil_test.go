@@ -0,0 +1,112 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hmsclient_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+)
+
+func TestTableBuilder_Validate(t *testing.T) {
+	tests := []struct {
+		columns  []hive_metastore.FieldSchema
+		partKeys []hive_metastore.FieldSchema
+		err      string
+	}{
+		{
+			columns: []hive_metastore.FieldSchema{
+				{Name: "id", Type: "bigint"},
+				{Name: "name"},
+				{Name: "info", Type: "struct<a:int,b:array<string>>"},
+			},
+			partKeys: []hive_metastore.FieldSchema{{Name: "ds", Type: "date"}},
+		},
+		{
+			columns: []hive_metastore.FieldSchema{{Name: "info", Type: "struct<a:int,b:array<string>"}},
+			err:     "column info: invalid type",
+		},
+		{
+			partKeys: []hive_metastore.FieldSchema{{Name: "ds", Type: "array<string>"}},
+			err:      "partition key ds: type array<string> is not primitive",
+		},
+	}
+	for i, test := range tests {
+		err := hmsclient.NewTableBuilder("db", "table").
+			WithColumns(test.columns).
+			WithPartitionKeys(test.partKeys).
+			Validate()
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%d: unexpected error: %v", i, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%d: expected error %q, got %v", i, test.err, err)
+		}
+	}
+}
+
+func TestTypedPartitionBuilder(t *testing.T) {
+	table := hmsclient.NewTableBuilder("db", "table").
+		WithPartitionKeys([]hive_metastore.FieldSchema{
+			{Name: "ds", Type: "date"},
+			{Name: "hr", Type: "tinyint"},
+			{Name: "region"},
+		}).
+		WithLocation("/warehouse/table").
+		Build()
+	ds := time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)
+	pb, err := hmsclient.NewTypedPartitionBuilder(table, ds, 7, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	partition := pb.Build()
+	if expected := []string{"2024-01-05", "7", hmsclient.DefaultPartitionName}; !reflect.DeepEqual(partition.Values, expected) {
+		t.Errorf("expected values %v, got %v", expected, partition.Values)
+	}
+	if expected := "/warehouse/table/ds=2024-01-05/hr=7/region=" + hmsclient.DefaultPartitionName; partition.Sd.Location != expected {
+		t.Errorf("expected location %s, got %s", expected, partition.Sd.Location)
+	}
+
+	tests := []struct {
+		values []interface{}
+		err    string
+	}{
+		{[]interface{}{"2024-1-5", 7, "us"}, "partition key ds: value \"2024-1-5\" is not a valid date"},
+		{[]interface{}{ds, 300, "us"}, "partition key hr: value 300 is out of range of tinyint"},
+		{[]interface{}{ds, 7, 1}, "partition key region: value 1 of Go type int can't be used for type string"},
+		{[]interface{}{ds, 7}, "number of provided partition values 2 does not match"},
+	}
+	for _, test := range tests {
+		_, err := hmsclient.NewTypedPartitionBuilder(table, test.values...)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%v: expected error %q, got %v", test.values, test.err, err)
+		}
+	}
+	// String values are used as given
+	p, err := hmsclient.MakePartition(table, []string{"2024-1-5", "007", "us"}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"2024-1-5", "007", "us"}; !reflect.DeepEqual(p.Values, expected) {
+		t.Errorf("expected values %v, got %v", expected, p.Values)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hmsclient
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultPartitionName is the partition value Hive uses for NULL and empty values
+const DefaultPartitionName = "__HIVE_DEFAULT_PARTITION__"
+
+// escapedChars are characters escaped in partition names, the same as in
+// Hive FileUtils.escapePathName on non-Windows systems.
+var escapedChars [128]bool
+
+func init() {
+	for c := 0; c < ' '; c++ {
+		escapedChars[c] = true
+	}
+	for _, c := range "\"#%'*/:=?\\\x7f{[]^" {
+		escapedChars[c] = true
+	}
+}
+
+// EscapePathName escapes characters which can't appear in partition names
+// as %XX. Empty string is converted to DefaultPartitionName.
+func EscapePathName(s string) string {
+	if s == "" {
+		return DefaultPartitionName
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 128 && escapedChars[c] {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// UnescapePathName reverses EscapePathName. Percent signs which are not
+// followed by two hex digits are kept as is.
+func UnescapePathName(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) {
+			if hi, lo := unhex(s[i+1]), unhex(s[i+2]); hi >= 0 && lo >= 0 {
+				b.WriteByte(byte(hi<<4 | lo))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func unhex(c byte) int {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c - '0')
+	case 'a' <= c && c <= 'f':
+		return int(c - 'a' + 10)
+	case 'A' <= c && c <= 'F':
+		return int(c - 'A' + 10)
+	}
+	return -1
+}
+
+// MakePartName returns partition name in the key1=val1/key2=val2 form with keys
+// converted to lower case and both keys and values escaped, the same way as Hive
+// does. The number of values should match the number of keys.
+func MakePartName(keys []string, values []string) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = EscapePathName(strings.ToLower(k)) + "=" + EscapePathName(values[i])
+	}
+	return strings.Join(parts, "/")
+}
+
+// ParsePartName splits partition name in the key1=val1/key2=val2 form into
+// unescaped keys and values.
+func ParsePartName(name string) (keys []string, values []string, err error) {
+	for _, part := range strings.Split(name, "/") {
+		i := strings.Index(part, "=")
+		if i <= 0 || i == len(part)-1 {
+			return nil, nil, fmt.Errorf("invalid partition name %q", name)
+		}
+		keys = append(keys, UnescapePathName(part[:i]))
+		values = append(values, UnescapePathName(part[i+1:]))
+	}
+	return keys, values, nil
+}
+
+// PartNameToSpec converts partition name in the key1=val1/key2=val2 form
+// to the map of unescaped keys to values.
+func PartNameToSpec(name string) (map[string]string, error) {
+	keys, values, err := ParsePartName(name)
+	if err != nil {
+		return nil, err
+	}
+	spec := make(map[string]string, len(keys))
+	for i, k := range keys {
+		spec[k] = values[i]
+	}
+	return spec, nil
+}
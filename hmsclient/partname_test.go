@@ -0,0 +1,95 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hmsclient_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+)
+
+func TestMakePartName(t *testing.T) {
+	tests := []struct {
+		keys   []string
+		values []string
+		name   string
+	}{
+		{[]string{"ds"}, []string{"2018-10-01"}, "ds=2018-10-01"},
+		{[]string{"DS", "hr"}, []string{"2018-10-01", "12"}, "ds=2018-10-01/hr=12"},
+		{[]string{"path"}, []string{"a/b=c"}, "path=a%2Fb%3Dc"},
+		{[]string{"ts"}, []string{"2018-10-01 12:00:00"}, "ts=2018-10-01 12%3A00%3A00"},
+		{[]string{"pct"}, []string{"100%"}, "pct=100%25"},
+		{[]string{"q"}, []string{`"x'y#*?\{[]^`}, "q=%22x%27y%23%2A%3F%5C%7B%5B%5D%5E"},
+		{[]string{"ctl"}, []string{"a\tb\x7f"}, "ctl=a%09b%7F"},
+		{[]string{"text"}, []string{"a,b c<>|é"}, "text=a,b c<>|é"},
+		{[]string{"empty"}, []string{""}, "empty=" + hmsclient.DefaultPartitionName},
+		{[]string{"a=b"}, []string{"1"}, "a%3Db=1"},
+	}
+	for _, test := range tests {
+		name := hmsclient.MakePartName(test.keys, test.values)
+		if name != test.name {
+			t.Errorf("MakePartName(%q, %q): expected %q, got %q", test.keys, test.values, test.name, name)
+			continue
+		}
+		if test.values[0] == "" {
+			continue
+		}
+		keys, values, err := hmsclient.ParsePartName(name)
+		if err != nil {
+			t.Errorf("ParsePartName(%q): %v", name, err)
+			continue
+		}
+		for i, k := range test.keys {
+			if keys[i] != strings.ToLower(k) {
+				t.Errorf("ParsePartName(%q): expected key %q, got %q", name, strings.ToLower(k), keys[i])
+			}
+		}
+		if !reflect.DeepEqual(values, test.values) {
+			t.Errorf("ParsePartName(%q): expected %q, got %q", name, test.values, values)
+		}
+	}
+}
+
+func TestParsePartName(t *testing.T) {
+	spec, err := hmsclient.PartNameToSpec("ds=2018-10-01/path=a%2Fb/bad=100%/lower=%7e%zz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"ds": "2018-10-01", "path": "a/b", "bad": "100%", "lower": "~%zz"}
+	if !reflect.DeepEqual(spec, expected) {
+		t.Errorf("expected %v, got %v", expected, spec)
+	}
+	for _, name := range []string{"", "ds", "=1", "ds=", "ds=1//hr=2", "ds=1/hr"} {
+		if _, _, err := hmsclient.ParsePartName(name); err == nil {
+			t.Errorf("expected error for %q", name)
+		}
+	}
+}
+
+func TestPartitionBuilderLocation(t *testing.T) {
+	table := &hive_metastore.Table{DbName: "db", TableName: "t",
+		PartitionKeys: []*hive_metastore.FieldSchema{{Name: "ds"}, {Name: "path"}},
+		Sd:            &hive_metastore.StorageDescriptor{Location: "hdfs://nn/warehouse/t"}}
+	partition, err := hmsclient.MakePartition(table, []string{"2018-10-01", "a/b"}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location := partition.Sd.Location; location != "hdfs://nn/warehouse/t/ds=2018-10-01/path=a%2Fb" {
+		t.Errorf("unexpected location %s", location)
+	}
+}
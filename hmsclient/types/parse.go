@@ -0,0 +1,446 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Error describes a problem with a type string.
+type Error struct {
+	Input string // Type string being parsed
+	Pos   int    // Byte offset of the problem within Input
+	Msg   string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid type %q: %s at position %d", e.Input, e.Msg, e.Pos)
+}
+
+// primitives maps all accepted primitive type names (including aliases) to canonical names.
+var primitives = map[string]string{
+	Void:              Void,
+	Boolean:           Boolean,
+	TinyInt:           TinyInt,
+	SmallInt:          SmallInt,
+	Int:               Int,
+	"integer":         Int,
+	BigInt:            BigInt,
+	Float:             Float,
+	Double:            Double,
+	String:            String,
+	Binary:            Binary,
+	Date:              Date,
+	Timestamp:         Timestamp,
+	IntervalYearMonth: IntervalYearMonth,
+	IntervalDayTime:   IntervalDayTime,
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokPunct
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	pos   int
+	quote bool // identifier was quoted with backticks
+}
+
+type parser struct {
+	input string
+	pos   int
+	tok   token
+}
+
+// Parse parses Hive type string and returns the corresponding Type.
+// Type names are case-insensitive, aliases like integer or dec are converted
+// to their canonical form.
+func Parse(s string) (Type, error) {
+	p := &parser{input: s}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == tokEOF {
+		return nil, p.errorf("empty type")
+	}
+	t, err := p.parseType()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %q after type", p.tok.text)
+	}
+	return t, nil
+}
+
+// MustParse is like Parse but panics if the type string is invalid.
+func MustParse(s string) Type {
+	t, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &Error{Input: p.input, Pos: p.tok.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// next advances to the next token
+func (p *parser) next() error {
+	for p.pos < len(p.input) && isSpace(p.input[p.pos]) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.input) {
+		p.tok = token{kind: tokEOF, pos: start, text: "end of input"}
+		return nil
+	}
+	c := p.input[p.pos]
+	switch {
+	case c == '`':
+		var b strings.Builder
+		p.pos++
+		for {
+			if p.pos >= len(p.input) {
+				return &Error{Input: p.input, Pos: start, Msg: "unterminated quoted name"}
+			}
+			if p.input[p.pos] == '`' {
+				// Double backtick is an escaped backtick
+				if p.pos+1 < len(p.input) && p.input[p.pos+1] == '`' {
+					b.WriteByte('`')
+					p.pos += 2
+					continue
+				}
+				p.pos++
+				break
+			}
+			b.WriteByte(p.input[p.pos])
+			p.pos++
+		}
+		p.tok = token{kind: tokIdent, text: b.String(), pos: start, quote: true}
+	case c == '\'' || c == '"':
+		var b strings.Builder
+		p.pos++
+		for {
+			if p.pos >= len(p.input) {
+				return &Error{Input: p.input, Pos: start, Msg: "unterminated string"}
+			}
+			ch := p.input[p.pos]
+			if ch == '\\' && p.pos+1 < len(p.input) {
+				b.WriteByte(p.input[p.pos+1])
+				p.pos += 2
+				continue
+			}
+			p.pos++
+			if ch == c {
+				break
+			}
+			b.WriteByte(ch)
+		}
+		p.tok = token{kind: tokString, text: b.String(), pos: start}
+	case c >= '0' && c <= '9':
+		for p.pos < len(p.input) && p.input[p.pos] >= '0' && p.input[p.pos] <= '9' {
+			p.pos++
+		}
+		p.tok = token{kind: tokNumber, text: p.input[start:p.pos], pos: start}
+	case isIdentRune(rune(c), true):
+		for p.pos < len(p.input) && isIdentRune(rune(p.input[p.pos]), false) {
+			p.pos++
+		}
+		p.tok = token{kind: tokIdent, text: p.input[start:p.pos], pos: start}
+	case strings.IndexByte("<>(),:", c) >= 0:
+		p.pos++
+		p.tok = token{kind: tokPunct, text: string(c), pos: start}
+	default:
+		return &Error{Input: p.input, Pos: start, Msg: fmt.Sprintf("unexpected character %q", c)}
+	}
+	return nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// isKeyword returns true if current token is an unquoted identifier equal to kw
+func (p *parser) isKeyword(kw string) bool {
+	return p.tok.kind == tokIdent && !p.tok.quote && strings.EqualFold(p.tok.text, kw)
+}
+
+func (p *parser) expectKeyword(kw string) error {
+	if !p.isKeyword(kw) {
+		return p.errorf("expected %q, got %q", kw, p.tok.text)
+	}
+	return p.next()
+}
+
+func (p *parser) expect(punct string) error {
+	if p.tok.kind != tokPunct || p.tok.text != punct {
+		return p.errorf("expected %q, got %q", punct, p.tok.text)
+	}
+	return p.next()
+}
+
+func (p *parser) isPunct(punct string) bool {
+	return p.tok.kind == tokPunct && p.tok.text == punct
+}
+
+// number parses a non-negative integer
+func (p *parser) number() (int, error) {
+	if p.tok.kind != tokNumber {
+		return 0, p.errorf("expected number, got %q", p.tok.text)
+	}
+	n, err := strconv.Atoi(p.tok.text)
+	if err != nil {
+		return 0, p.errorf("invalid number %q", p.tok.text)
+	}
+	return n, p.next()
+}
+
+func (p *parser) parseType() (Type, error) {
+	if p.tok.kind != tokIdent || p.tok.quote {
+		return nil, p.errorf("expected type name, got %q", p.tok.text)
+	}
+	start := p.tok
+	name := strings.ToLower(p.tok.text)
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	switch name {
+	case "array":
+		return p.parseArray()
+	case "map":
+		return p.parseMap()
+	case "struct":
+		return p.parseStruct()
+	case "uniontype":
+		return p.parseUnion()
+	case "decimal", "dec", "numeric":
+		return p.parseDecimal()
+	case "char", "varchar":
+		return p.parseChar(name)
+	case Timestamp:
+		if p.isKeyword("with") {
+			for _, kw := range []string{"with", "local", "time", "zone"} {
+				if err := p.expectKeyword(kw); err != nil {
+					return nil, err
+				}
+			}
+			return &Primitive{Name: TimestampLocalTZ}, nil
+		}
+	case Double:
+		if p.isKeyword("precision") {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	canonical, ok := primitives[name]
+	if !ok {
+		return nil, &Error{Input: p.input, Pos: start.pos,
+			Msg: fmt.Sprintf("unknown type %q", start.text)}
+	}
+	return &Primitive{Name: canonical}, nil
+}
+
+func (p *parser) parseArray() (Type, error) {
+	if err := p.expect("<"); err != nil {
+		return nil, err
+	}
+	elem, err := p.parseType()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.expect(">"); err != nil {
+		return nil, err
+	}
+	return &Array{Elem: elem}, nil
+}
+
+func (p *parser) parseMap() (Type, error) {
+	if err := p.expect("<"); err != nil {
+		return nil, err
+	}
+	keyTok := p.tok
+	key, err := p.parseType()
+	if err != nil {
+		return nil, err
+	}
+	if !IsPrimitive(key) {
+		return nil, &Error{Input: p.input, Pos: keyTok.pos,
+			Msg: fmt.Sprintf("map key must be a primitive type, got %s", key)}
+	}
+	if err = p.expect(","); err != nil {
+		return nil, err
+	}
+	value, err := p.parseType()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.expect(">"); err != nil {
+		return nil, err
+	}
+	return &Map{Key: key, Value: value}, nil
+}
+
+func (p *parser) parseStruct() (Type, error) {
+	if err := p.expect("<"); err != nil {
+		return nil, err
+	}
+	result := &Struct{}
+	seen := make(map[string]bool)
+	for {
+		if p.tok.kind != tokIdent {
+			return nil, p.errorf("expected field name, got %q", p.tok.text)
+		}
+		nameTok := p.tok
+		if seen[strings.ToLower(nameTok.text)] {
+			return nil, p.errorf("duplicate field name %q", nameTok.text)
+		}
+		seen[strings.ToLower(nameTok.text)] = true
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		t, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		field := Field{Name: nameTok.text, Type: t}
+		if p.isKeyword("comment") {
+			if err = p.next(); err != nil {
+				return nil, err
+			}
+			if p.tok.kind != tokString {
+				return nil, p.errorf("expected comment string, got %q", p.tok.text)
+			}
+			field.Comment = p.tok.text
+			if err = p.next(); err != nil {
+				return nil, err
+			}
+		}
+		result.Fields = append(result.Fields, field)
+		if p.isPunct(">") {
+			return result, p.next()
+		}
+		if err = p.expect(","); err != nil {
+			return nil, p.errorf("expected \",\" or \">\", got %q", p.tok.text)
+		}
+	}
+}
+
+func (p *parser) parseUnion() (Type, error) {
+	if err := p.expect("<"); err != nil {
+		return nil, err
+	}
+	result := &Union{}
+	for {
+		t, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		result.Types = append(result.Types, t)
+		if p.isPunct(">") {
+			return result, p.next()
+		}
+		if !p.isPunct(",") {
+			return nil, p.errorf("expected \",\" or \">\", got %q", p.tok.text)
+		}
+		if err = p.next(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseDecimal() (Type, error) {
+	result := &Decimal{Precision: DefaultDecimalPrecision, Scale: DefaultDecimalScale}
+	if !p.isPunct("(") {
+		return result, nil
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	precTok := p.tok
+	precision, err := p.number()
+	if err != nil {
+		return nil, err
+	}
+	if precision < 1 || precision > MaxDecimalPrecision {
+		return nil, &Error{Input: p.input, Pos: precTok.pos,
+			Msg: fmt.Sprintf("decimal precision %d is out of range [1, %d]",
+				precision, MaxDecimalPrecision)}
+	}
+	result.Precision = precision
+	if p.isPunct(",") {
+		if err = p.next(); err != nil {
+			return nil, err
+		}
+		scaleTok := p.tok
+		scale, err := p.number()
+		if err != nil {
+			return nil, err
+		}
+		if scale > precision {
+			return nil, &Error{Input: p.input, Pos: scaleTok.pos,
+				Msg: fmt.Sprintf("decimal scale %d is greater than precision %d",
+					scale, precision)}
+		}
+		result.Scale = scale
+	}
+	if err = p.expect(")"); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (p *parser) parseChar(name string) (Type, error) {
+	if !p.isPunct("(") {
+		return nil, p.errorf("%s type requires length", name)
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	lenTok := p.tok
+	length, err := p.number()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.expect(")"); err != nil {
+		return nil, err
+	}
+	maxLength := MaxCharLength
+	if name == "varchar" {
+		maxLength = MaxVarcharLength
+	}
+	if length < 1 || length > maxLength {
+		return nil, &Error{Input: p.input, Pos: lenTok.pos,
+			Msg: fmt.Sprintf("%s length %d is out of range [1, %d]", name, length, maxLength)}
+	}
+	if name == "varchar" {
+		return &Varchar{Length: length}, nil
+	}
+	return &Char{Length: length}, nil
+}
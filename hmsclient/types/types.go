@@ -0,0 +1,215 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package types provides a model for Hive column types.
+
+HMS stores column types as plain strings in FieldSchema.Type, for example
+
+  int
+  decimal(10,2)
+  map<string,array<struct<a:int,b:string>>>
+
+Parse converts such string into a Type tree which can be inspected and
+converted back to the canonical Hive representation with String().
+
+Example:
+
+  t, err := types.Parse("struct<a:int,b:array<string>>")
+  if err != nil {
+    log.Fatal(err)
+  }
+  s := t.(*types.Struct)
+  fmt.Println(s.Fields[1].Type) // array<string>
+*/
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Names of Hive primitive types
+const (
+	Void              = "void"
+	Boolean           = "boolean"
+	TinyInt           = "tinyint"
+	SmallInt          = "smallint"
+	Int               = "int"
+	BigInt            = "bigint"
+	Float             = "float"
+	Double            = "double"
+	String            = "string"
+	Binary            = "binary"
+	Date              = "date"
+	Timestamp         = "timestamp"
+	TimestampLocalTZ  = "timestamp with local time zone"
+	IntervalYearMonth = "interval_year_month"
+	IntervalDayTime   = "interval_day_time"
+)
+
+// Limits enforced by Hive for parameterized types
+const (
+	DefaultDecimalPrecision = 10
+	DefaultDecimalScale     = 0
+	MaxDecimalPrecision     = 38
+	MaxCharLength           = 255
+	MaxVarcharLength        = 65535
+)
+
+// Type is a parsed Hive type. String() returns canonical Hive type string.
+type Type interface {
+	String() string
+	// hiveType is only used to restrict implementations to this package
+	hiveType()
+}
+
+// Primitive is a simple non-parameterized type like int or string.
+type Primitive struct {
+	Name string
+}
+
+// Decimal is decimal(precision,scale) type.
+type Decimal struct {
+	Precision int
+	Scale     int
+}
+
+// Char is fixed-length char(n) type.
+type Char struct {
+	Length int
+}
+
+// Varchar is variable-length varchar(n) type.
+type Varchar struct {
+	Length int
+}
+
+// Array is array<elem> type.
+type Array struct {
+	Elem Type
+}
+
+// Map is map<key,value> type. Key is always a primitive type.
+type Map struct {
+	Key   Type
+	Value Type
+}
+
+// Field is a single named member of a struct.
+type Field struct {
+	Name    string
+	Type    Type
+	Comment string
+}
+
+// Struct is struct<name:type,...> type.
+type Struct struct {
+	Fields []Field
+}
+
+// Union is uniontype<type,...> type.
+type Union struct {
+	Types []Type
+}
+
+func (*Primitive) hiveType() {}
+func (*Decimal) hiveType()   {}
+func (*Char) hiveType()      {}
+func (*Varchar) hiveType()   {}
+func (*Array) hiveType()     {}
+func (*Map) hiveType()       {}
+func (*Struct) hiveType()    {}
+func (*Union) hiveType()     {}
+
+func (t *Primitive) String() string {
+	return t.Name
+}
+
+func (t *Decimal) String() string {
+	return fmt.Sprintf("decimal(%d,%d)", t.Precision, t.Scale)
+}
+
+func (t *Char) String() string {
+	return fmt.Sprintf("char(%d)", t.Length)
+}
+
+func (t *Varchar) String() string {
+	return fmt.Sprintf("varchar(%d)", t.Length)
+}
+
+func (t *Array) String() string {
+	return "array<" + t.Elem.String() + ">"
+}
+
+func (t *Map) String() string {
+	return "map<" + t.Key.String() + "," + t.Value.String() + ">"
+}
+
+// String returns struct type representation. Field comments are not included, just
+// like in type names produced by Hive.
+func (t *Struct) String() string {
+	fields := make([]string, len(t.Fields))
+	for i, f := range t.Fields {
+		fields[i] = quoteName(f.Name) + ":" + f.Type.String()
+	}
+	return "struct<" + strings.Join(fields, ",") + ">"
+}
+
+func (t *Union) String() string {
+	members := make([]string, len(t.Types))
+	for i, m := range t.Types {
+		members[i] = m.String()
+	}
+	return "uniontype<" + strings.Join(members, ",") + ">"
+}
+
+// IsPrimitive returns true for all types that are not complex (array, map, struct or union).
+func IsPrimitive(t Type) bool {
+	switch t.(type) {
+	case *Primitive, *Decimal, *Char, *Varchar:
+		return true
+	}
+	return false
+}
+
+// quoteName surrounds field name with backticks if it isn't a plain identifier.
+func quoteName(name string) string {
+	if isIdentifier(name) {
+		return name
+	}
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if !isIdentRune(r, i == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func isIdentRune(r rune, first bool) bool {
+	switch {
+	case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		return true
+	case r >= '0' && r <= '9':
+		return !first
+	}
+	return false
+}
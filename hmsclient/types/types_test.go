@@ -0,0 +1,137 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/akolb1/gometastore/hmsclient/types"
+)
+
+func TestParseCanonical(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"int", "int"},
+		{"INT", "int"},
+		{"integer", "int"},
+		{"double precision", "double"},
+		{"timestamp with local time zone", "timestamp with local time zone"},
+		{"decimal", "decimal(10,0)"},
+		{"decimal(5)", "decimal(5,0)"},
+		{"DECIMAL(38, 10)", "decimal(38,10)"},
+		{"numeric(12,2)", "decimal(12,2)"},
+		{"char(10)", "char(10)"},
+		{"varchar(65535)", "varchar(65535)"},
+		{"array<string>", "array<string>"},
+		{"array<array<int>>", "array<array<int>>"},
+		{"map<string, array<bigint>>", "map<string,array<bigint>>"},
+		{"struct<a:int,b:array<string>>", "struct<a:int,b:array<string>>"},
+		{"struct<a:int COMMENT 'the a', b : string>", "struct<a:int,b:string>"},
+		{"struct<`my field`:int>", "struct<`my field`:int>"},
+		{"uniontype<int,string,struct<x:double>>", "uniontype<int,string,struct<x:double>>"},
+	}
+	for _, test := range tests {
+		typ, err := types.Parse(test.input)
+		if err != nil {
+			t.Errorf("failed to parse %q: %v", test.input, err)
+			continue
+		}
+		if typ.String() != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.input, test.expected, typ.String())
+		}
+		// Canonical representation should parse to the same thing
+		again, err := types.Parse(typ.String())
+		if err != nil {
+			t.Errorf("failed to parse canonical %q: %v", typ.String(), err)
+		} else if again.String() != typ.String() {
+			t.Errorf("round trip of %q gave %q", typ.String(), again.String())
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+		pos   int
+	}{
+		{"", "empty type", 0},
+		{"foo", "unknown type", 0},
+		{"array<int", "expected \">\"", 9},
+		{"array<int>>", "unexpected \">\" after type", 10},
+		{"map<array<int>,string>", "map key must be a primitive type", 4},
+		{"struct<a:int,a:string>", "duplicate field name", 13},
+		{"struct<a int>", "expected \":\"", 9},
+		{"decimal(39,2)", "out of range", 8},
+		{"decimal(10,11)", "greater than precision", 11},
+		{"varchar", "requires length", 7},
+		{"char(256)", "out of range", 5},
+		{"uniontype<int;string>", "unexpected character", 13},
+		{"struct<a:strin>", "unknown type \"strin\"", 9},
+	}
+	for _, test := range tests {
+		_, err := types.Parse(test.input)
+		if err == nil {
+			t.Errorf("%q: expected error", test.input)
+			continue
+		}
+		typeErr, ok := err.(*types.Error)
+		if !ok {
+			t.Errorf("%q: unexpected error type %T", test.input, err)
+			continue
+		}
+		if !strings.Contains(typeErr.Msg, test.msg) {
+			t.Errorf("%q: expected error containing %q, got %q", test.input, test.msg, typeErr.Msg)
+		}
+		if typeErr.Pos != test.pos {
+			t.Errorf("%q: expected error at %d, got %d", test.input, test.pos, typeErr.Pos)
+		}
+	}
+}
+
+func TestParseStructure(t *testing.T) {
+	typ := types.MustParse("map<string,struct<id:bigint,price:decimal(8,2)>>")
+	m, ok := typ.(*types.Map)
+	if !ok {
+		t.Fatalf("expected map, got %T", typ)
+	}
+	if m.Key.(*types.Primitive).Name != types.String {
+		t.Errorf("invalid key type %s", m.Key)
+	}
+	s := m.Value.(*types.Struct)
+	if len(s.Fields) != 2 || s.Fields[0].Name != "id" || s.Fields[1].Name != "price" {
+		t.Fatalf("invalid fields %v", s.Fields)
+	}
+	if d := s.Fields[1].Type.(*types.Decimal); d.Precision != 8 || d.Scale != 2 {
+		t.Errorf("invalid decimal %s", d)
+	}
+	if types.IsPrimitive(typ) || !types.IsPrimitive(s.Fields[1].Type) {
+		t.Error("invalid IsPrimitive result")
+	}
+}
+
+func ExampleParse() {
+	t, _ := types.Parse("STRUCT<a:INT, b:ARRAY<VARCHAR(10)>>")
+	fmt.Println(t)
+	_, err := types.Parse("array<int")
+	fmt.Println(err)
+	// Output:
+	// struct<a:int,b:array<varchar(10)>>
+	// invalid type "array<int": expected ">", got "end of input" at position 9
+}
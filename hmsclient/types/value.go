@@ -0,0 +1,269 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Layouts of date and timestamp values in Hive string representation
+const (
+	DateLayout      = "2006-01-02"
+	TimestampLayout = "2006-01-02 15:04:05.999999999"
+)
+
+// Ranges of Hive integer types
+var integerBits = map[string]int{
+	TinyInt:  8,
+	SmallInt: 16,
+	Int:      32,
+	BigInt:   64,
+}
+
+// FormatValue converts Go value to the canonical Hive string representation of
+// the primitive type t and checks that the value fits the type.
+//
+// Supported values are strings, integers, floats, booleans, *big.Rat for decimals
+// and time.Time for dates and timestamps. Strings are validated and should already
+// be in the canonical form, so for example "2018-1-5" is rejected for dates.
+// Strings are accepted as is for types which aren't validated, like binary or
+// intervals.
+func FormatValue(t Type, value interface{}) (string, error) {
+	if s, ok := value.(string); ok {
+		return formatString(t, s)
+	}
+	switch t := t.(type) {
+	case *Primitive:
+		switch t.Name {
+		case TinyInt, SmallInt, Int, BigInt:
+			n, ok := toInt64(value)
+			if !ok {
+				return "", mismatch(t, value)
+			}
+			return formatInteger(t.Name, n)
+		case Float, Double:
+			var f float64
+			switch v := value.(type) {
+			case float32:
+				f = float64(v)
+			case float64:
+				f = v
+			default:
+				n, ok := toInt64(value)
+				if !ok {
+					return "", mismatch(t, value)
+				}
+				f = float64(n)
+			}
+			return formatFloat(t.Name, f)
+		case Boolean:
+			if b, ok := value.(bool); ok {
+				return strconv.FormatBool(b), nil
+			}
+		case Date:
+			if tm, ok := value.(time.Time); ok {
+				return tm.Format(DateLayout), nil
+			}
+		case Timestamp:
+			if tm, ok := value.(time.Time); ok {
+				return tm.Format(TimestampLayout), nil
+			}
+		}
+	case *Decimal:
+		var r *big.Rat
+		switch v := value.(type) {
+		case *big.Rat:
+			r = v
+		case float32, float64:
+			r = new(big.Rat)
+			if _, ok := r.SetString(fmt.Sprint(v)); !ok {
+				return "", fmt.Errorf("value %v doesn't fit type %s", v, t)
+			}
+		default:
+			n, ok := toInt64(value)
+			if !ok {
+				return "", mismatch(t, value)
+			}
+			r = new(big.Rat).SetInt64(n)
+		}
+		return formatDecimal(t, r)
+	}
+	return "", mismatch(t, value)
+}
+
+func mismatch(t Type, value interface{}) error {
+	return fmt.Errorf("value %v of Go type %T can't be used for type %s", value, value, t)
+}
+
+// formatString validates string representation of the value of type t
+func formatString(t Type, s string) (string, error) {
+	canonical := s
+	var err error
+	switch t := t.(type) {
+	case *Primitive:
+		switch t.Name {
+		case TinyInt, SmallInt, Int, BigInt:
+			n, e := strconv.ParseInt(s, 10, 64)
+			if e != nil {
+				return "", fmt.Errorf("value %q is not a valid %s", s, t)
+			}
+			canonical, err = formatInteger(t.Name, n)
+		case Float, Double:
+			f, e := strconv.ParseFloat(s, 64)
+			if e != nil {
+				return "", fmt.Errorf("value %q is not a valid %s", s, t)
+			}
+			canonical, err = formatFloat(t.Name, f)
+		case Boolean:
+			b, e := strconv.ParseBool(s)
+			if e != nil {
+				return "", fmt.Errorf("value %q is not a valid %s", s, t)
+			}
+			canonical = strconv.FormatBool(b)
+		case Date:
+			tm, e := time.Parse(DateLayout, s)
+			if e != nil {
+				return "", fmt.Errorf("value %q is not a valid %s, expected %s", s, t, DateLayout)
+			}
+			canonical = tm.Format(DateLayout)
+		case Timestamp:
+			tm, e := time.Parse(TimestampLayout, s)
+			if e != nil {
+				return "", fmt.Errorf("value %q is not a valid %s, expected %s", s, t, TimestampLayout)
+			}
+			canonical = tm.Format(TimestampLayout)
+		}
+	case *Decimal:
+		r, ok := new(big.Rat).SetString(s)
+		if !ok || strings.ContainsAny(s, "/eE") {
+			return "", fmt.Errorf("value %q is not a valid %s", s, t)
+		}
+		canonical, err = formatDecimal(t, r)
+	case *Char:
+		if utf8.RuneCountInString(s) > t.Length {
+			return "", fmt.Errorf("value %q is longer than %s", s, t)
+		}
+	case *Varchar:
+		if utf8.RuneCountInString(s) > t.Length {
+			return "", fmt.Errorf("value %q is longer than %s", s, t)
+		}
+	default:
+		return "", fmt.Errorf("values of type %s are not supported", t)
+	}
+	if err != nil {
+		return "", err
+	}
+	if canonical != s {
+		return "", fmt.Errorf("value %q of type %s is not in canonical form %q", s, t, canonical)
+	}
+	return s, nil
+}
+
+// toInt64 converts any Go integer to int64
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), v <= math.MaxInt64
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	}
+	return 0, false
+}
+
+func formatInteger(name string, n int64) (string, error) {
+	bits := integerBits[name]
+	if bits < 64 && (n < -1<<uint(bits-1) || n >= 1<<uint(bits-1)) {
+		return "", fmt.Errorf("value %d is out of range of %s", n, name)
+	}
+	return strconv.FormatInt(n, 10), nil
+}
+
+func formatFloat(name string, f float64) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("value %v is not a valid %s", f, name)
+	}
+	bits := 64
+	if name == Float {
+		if math.Abs(f) > math.MaxFloat32 {
+			return "", fmt.Errorf("value %v is out of range of %s", f, name)
+		}
+		bits = 32
+	}
+	return javaFloat(f, bits), nil
+}
+
+// javaFloat formats the shortest representation of f the same way as Java
+// Double.toString and Float.toString, which Hive uses: there is always a digit after
+// the decimal point, and values below 1e-3 or from 1e7 use scientific notation
+// like 1.0E7.
+func javaFloat(f float64, bits int) string {
+	if abs := math.Abs(f); abs == 0 || (abs >= 1e-3 && abs < 1e7) {
+		s := strconv.FormatFloat(f, 'f', -1, bits)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return s
+	}
+	// FormatFloat returns mantissa and exponent like 1.5E+07
+	s := strconv.FormatFloat(f, 'E', -1, bits)
+	i := strings.IndexByte(s, 'E')
+	mantissa, exponent := s[:i], s[i+1:]
+	if !strings.Contains(mantissa, ".") {
+		mantissa += ".0"
+	}
+	exp, _ := strconv.Atoi(exponent)
+	return mantissa + "E" + strconv.Itoa(exp)
+}
+
+// formatDecimal formats decimal without trailing zeros, the same way as Hive.
+// Values which need more digits than the type allows are rejected rather than rounded.
+func formatDecimal(t *Decimal, r *big.Rat) (string, error) {
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10),
+		big.NewInt(int64(t.Scale)), nil)))
+	if !scaled.IsInt() {
+		return "", fmt.Errorf("value %s has more than %d digits after decimal point for %s",
+			r.FloatString(t.Scale+1), t.Scale, t)
+	}
+	if digits := len(new(big.Int).Abs(scaled.Num()).String()); digits > t.Precision {
+		return "", fmt.Errorf("value %s has too many digits for %s", r.FloatString(t.Scale), t)
+	}
+	s := r.FloatString(t.Scale)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s, nil
+}
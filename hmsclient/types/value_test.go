@@ -0,0 +1,109 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types_test
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/akolb1/gometastore/hmsclient/types"
+)
+
+func TestFormatValue(t *testing.T) {
+	ts := time.Date(2018, 1, 5, 12, 30, 0, 500000000, time.UTC)
+	tests := []struct {
+		typ      string
+		value    interface{}
+		expected string
+	}{
+		{"string", "any value", "any value"},
+		{"varchar(5)", "héllo", "héllo"},
+		{"int", 42, "42"},
+		{"int", "-42", "-42"},
+		{"tinyint", int8(-128), "-128"},
+		{"bigint", uint64(1) << 62, "4611686018427387904"},
+		{"double", 1.5, "1.5"},
+		{"float", float32(0.1), "0.1"},
+		{"double", 3, "3.0"},
+		{"double", "1.0", "1.0"},
+		{"double", -2.0, "-2.0"},
+		{"double", 0.0, "0.0"},
+		{"double", 1e7, "1.0E7"},
+		{"double", "1.5E-5", "1.5E-5"},
+		{"double", 0.001, "0.001"},
+		{"double", 9999999.0, "9999999.0"},
+		{"float", float32(1), "1.0"},
+		{"float", float32(3e10), "3.0E10"},
+		{"boolean", true, "true"},
+		{"boolean", "false", "false"},
+		{"date", ts, "2018-01-05"},
+		{"date", "2018-01-05", "2018-01-05"},
+		{"timestamp", ts, "2018-01-05 12:30:00.5"},
+		{"timestamp", "2018-01-05 12:30:00", "2018-01-05 12:30:00"},
+		{"decimal(10,2)", big.NewRat(15, 10), "1.5"},
+		{"decimal(10,2)", "-12.25", "-12.25"},
+		{"decimal(5,0)", 12345, "12345"},
+		{"decimal(4,2)", 0.25, "0.25"},
+		{"interval_day_time", "1 00:00:00", "1 00:00:00"},
+	}
+	for _, test := range tests {
+		s, err := types.FormatValue(types.MustParse(test.typ), test.value)
+		if err != nil {
+			t.Errorf("%s %v: %v", test.typ, test.value, err)
+		} else if s != test.expected {
+			t.Errorf("%s %v: expected %q, got %q", test.typ, test.value, test.expected, s)
+		}
+	}
+}
+
+func TestFormatValueErrors(t *testing.T) {
+	tests := []struct {
+		typ   string
+		value interface{}
+	}{
+		{"date", "2018-1-5"},
+		{"date", "2018-02-30"},
+		{"date", 20180105},
+		{"timestamp", "2018-01-05T12:30:00"},
+		{"int", "007"},
+		{"int", "1.0"},
+		{"int", int64(1) << 31},
+		{"tinyint", 128},
+		{"bigint", uint64(1) << 63},
+		{"int", 1.5},
+		{"double", "1.50"},
+		{"double", "1"},
+		{"double", "10000000.0"},
+		{"double", "1.5e-5"},
+		{"float", 1e39},
+		{"boolean", "TRUE"},
+		{"boolean", 1},
+		{"decimal(4,2)", "123.4"},
+		{"decimal(4,2)", "1.234"},
+		{"decimal(4,2)", "1.50"},
+		{"decimal(10,2)", "1e3"},
+		{"decimal(10,2)", big.NewRat(1, 3)},
+		{"char(3)", "abcd"},
+		{"string", 42},
+		{"string", time.Now()},
+		{"array<int>", "1"},
+	}
+	for _, test := range tests {
+		if s, err := types.FormatValue(types.MustParse(test.typ), test.value); err == nil {
+			t.Errorf("%s %v: expected error, got %q", test.typ, test.value, s)
+		}
+	}
+}
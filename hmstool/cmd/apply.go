@@ -0,0 +1,609 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/ddl"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+	"github.com/akolb1/gometastore/hmsclient/types"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	optDryRun = "dry-run"
+	optPrune  = "prune"
+	optYes    = "yes"
+
+	actionCreate = "create"
+	actionUpdate = "update"
+	actionDrop   = "drop"
+
+	kindDatabase = "database"
+	kindTable    = "table"
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "apply desired catalog state",
+	Run:   applyCatalog,
+	Long: `Apply desired state of databases and tables described in YAML or JSON file.
+
+The tool compares the desired state with HMS, prints the plan and, after
+confirmation, creates missing databases and tables and updates existing ones.
+Only attributes and parameters listed in the file are managed, other parameters
+are preserved. Objects without owner are created with the current user as owner,
+owners of existing objects are only changed when specified.
+With --prune flag tables which are not listed in the file are dropped from
+databases listed in the file. Table data is not deleted.
+
+Partition keys of existing tables can't be changed.
+
+Example catalog:
+
+    databases:
+      - name: sales
+        description: Sales data
+        owner: finance
+        parameters:
+          team: finance
+        tables:
+          - name: orders
+            type: external
+            comment: All orders
+            storedAs: orc
+            location: hdfs://nn:8020/data/orders
+            columns:
+              - {name: id, type: bigint, comment: order id}
+              - {name: price, type: "decimal(10,2)"}
+            partitionKeys:
+              - {name: ds, type: string}
+            parameters:
+              orc.compress: ZLIB
+
+Examples:
+
+    hmstool apply -f catalog.yaml --dry-run
+    hmstool apply -f catalog.yaml --prune --yes
+`,
+}
+
+// catalogSpec is the desired state of the metastore
+type catalogSpec struct {
+	Databases []*databaseSpec `json:"databases" yaml:"databases"`
+}
+
+type databaseSpec struct {
+	Name        string            `json:"name" yaml:"name"`
+	Description string            `json:"description,omitempty" yaml:"description,omitempty"`
+	Owner       string            `json:"owner,omitempty" yaml:"owner,omitempty"`
+	Location    string            `json:"location,omitempty" yaml:"location,omitempty"`
+	Parameters  map[string]string `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	Tables      []*tableSpec      `json:"tables,omitempty" yaml:"tables,omitempty"`
+}
+
+type tableSpec struct {
+	Name          string            `json:"name" yaml:"name"`
+	Type          string            `json:"type,omitempty" yaml:"type,omitempty"`
+	Owner         string            `json:"owner,omitempty" yaml:"owner,omitempty"`
+	Comment       string            `json:"comment,omitempty" yaml:"comment,omitempty"`
+	Columns       []columnSpec      `json:"columns" yaml:"columns"`
+	PartitionKeys []columnSpec      `json:"partitionKeys,omitempty" yaml:"partitionKeys,omitempty"`
+	StoredAs      string            `json:"storedAs,omitempty" yaml:"storedAs,omitempty"`
+	Location      string            `json:"location,omitempty" yaml:"location,omitempty"`
+	Parameters    map[string]string `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+}
+
+type columnSpec struct {
+	Name    string `json:"name" yaml:"name"`
+	Type    string `json:"type,omitempty" yaml:"type,omitempty"`
+	Comment string `json:"comment,omitempty" yaml:"comment,omitempty"`
+}
+
+// planChange is a single change to the metastore
+type planChange struct {
+	Action  string
+	Kind    string
+	Name    string
+	Details []string
+	apply   func(client *hmsclient.MetastoreClient) error
+}
+
+// catalogReader provides access to the live metastore state needed for planning.
+type catalogReader interface {
+	GetDatabase(dbName string) (*hmsclient.Database, error)
+	GetAllTables(dbName string) ([]string, error)
+	GetTable(dbName string, tableName string) (*hive_metastore.Table, error)
+}
+
+func applyCatalog(cmd *cobra.Command, _ []string) {
+	fileName, _ := cmd.Flags().GetString(optFile)
+	if fileName == "" {
+		log.Fatal("missing catalog file")
+	}
+	catalog, err := readCatalog(fileName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	client, err := getClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+
+	prune, _ := cmd.Flags().GetBool(optPrune)
+	plan, err := makePlan(client, catalog, getOwner(), prune)
+	if err != nil {
+		log.Fatal(err)
+	}
+	printPlan(plan)
+	if len(plan) == 0 {
+		return
+	}
+	if dryRun, _ := cmd.Flags().GetBool(optDryRun); dryRun {
+		return
+	}
+	if yes, _ := cmd.Flags().GetBool(optYes); !yes && !confirm("Apply these changes?") {
+		fmt.Println("Apply cancelled")
+		return
+	}
+	for _, c := range plan {
+		log.Println("Applying", c.Action, c.Kind, c.Name)
+		if err = c.apply(client); err != nil {
+			log.Fatalf("failed to %s %s %s: %v", c.Action, c.Kind, c.Name, err)
+		}
+	}
+}
+
+// readCatalog reads catalog from JSON or YAML file. Format is determined by the
+// file extension, YAML is assumed by default.
+func readCatalog(fileName string) (*catalogSpec, error) {
+	raw, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %v", fileName, err)
+	}
+	catalog := new(catalogSpec)
+	if strings.EqualFold(filepath.Ext(fileName), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(catalog)
+	} else {
+		err = yaml.UnmarshalStrict(raw, catalog)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse file %s: %v", fileName, err)
+	}
+	return catalog, nil
+}
+
+// confirm asks user for confirmation and returns true if user agreed.
+func confirm(prompt string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N]: ", prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func printPlan(plan []*planChange) {
+	if len(plan) == 0 {
+		fmt.Println("No changes. Metastore matches the catalog.")
+		return
+	}
+	counts := make(map[string]int)
+	symbols := map[string]string{actionCreate: "+", actionUpdate: "~", actionDrop: "-"}
+	for _, c := range plan {
+		counts[c.Action]++
+		fmt.Printf("%s %s %s\n", symbols[c.Action], c.Kind, c.Name)
+		for _, d := range c.Details {
+			fmt.Printf("    %s\n", d)
+		}
+	}
+	fmt.Printf("\nPlan: %d to create, %d to update, %d to drop.\n",
+		counts[actionCreate], counts[actionUpdate], counts[actionDrop])
+}
+
+// makePlan computes list of changes needed to bring metastore to the catalog state.
+// Database changes go first, followed by table changes and drops.
+func makePlan(reader catalogReader, catalog *catalogSpec,
+	defaultOwner string, prune bool) ([]*planChange, error) {
+	var plan, drops []*planChange
+	for _, dbSpec := range catalog.Databases {
+		if dbSpec.Name == "" {
+			return nil, fmt.Errorf("database without name in catalog")
+		}
+		db := dbSpec.database(defaultOwner)
+		liveDb, err := reader.GetDatabase(db.Name)
+		dbExists := true
+		if err != nil {
+			if _, ok := err.(*hive_metastore.NoSuchObjectException); !ok {
+				return nil, fmt.Errorf("failed to get database %s: %v", db.Name, err)
+			}
+			dbExists = false
+		}
+		if !dbExists {
+			plan = append(plan, &planChange{
+				Action: actionCreate,
+				Kind:   kindDatabase,
+				Name:   db.Name,
+				apply: func(client *hmsclient.MetastoreClient) error {
+					return client.CreateDatabase(db)
+				},
+			})
+		} else if details := diffDatabase(liveDb, dbSpec); len(details) != 0 {
+			updated := *liveDb
+			if dbSpec.Description != "" {
+				updated.Description = dbSpec.Description
+			}
+			if dbSpec.Owner != "" {
+				updated.Owner = dbSpec.Owner
+			}
+			updated.Parameters = mergeParameters(liveDb.Parameters, db.Parameters)
+			plan = append(plan, &planChange{
+				Action:  actionUpdate,
+				Kind:    kindDatabase,
+				Name:    db.Name,
+				Details: details,
+				apply: func(client *hmsclient.MetastoreClient) error {
+					return client.AlterDatabase(updated.Name, &updated)
+				},
+			})
+		}
+
+		managed := make(map[string]bool)
+		for _, tSpec := range dbSpec.Tables {
+			owner := tSpec.Owner
+			if owner == "" {
+				owner = db.Owner
+			}
+			tb, err := tSpec.builder(db.Name, owner)
+			if err != nil {
+				return nil, err
+			}
+			managed[strings.ToLower(tb.Name)] = true
+			fullName := db.Name + "." + tb.Name
+			var liveTable *hive_metastore.Table
+			if dbExists {
+				liveTable, err = reader.GetTable(db.Name, tb.Name)
+				if err != nil {
+					if _, ok := err.(*hive_metastore.NoSuchObjectException); !ok {
+						return nil, fmt.Errorf("failed to get table %s: %v", fullName, err)
+					}
+					liveTable = nil
+				}
+			}
+			if liveTable == nil {
+				table := tb.Build()
+				plan = append(plan, &planChange{
+					Action: actionCreate,
+					Kind:   kindTable,
+					Name:   fullName,
+					apply: func(client *hmsclient.MetastoreClient) error {
+						return client.CreateTable(table)
+					},
+				})
+				continue
+			}
+			updated, details, err := diffTable(liveTable, tSpec, tb.Build())
+			if err != nil {
+				return nil, fmt.Errorf("can't update table %s: %v", fullName, err)
+			}
+			if len(details) == 0 {
+				continue
+			}
+			plan = append(plan, &planChange{
+				Action:  actionUpdate,
+				Kind:    kindTable,
+				Name:    fullName,
+				Details: details,
+				apply: func(client *hmsclient.MetastoreClient) error {
+					return client.AlterTable(updated.DbName, updated.TableName, updated)
+				},
+			})
+		}
+
+		if !prune || !dbExists {
+			continue
+		}
+		tableNames, err := reader.GetAllTables(db.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get tables for %s: %v", db.Name, err)
+		}
+		sort.Strings(tableNames)
+		for _, name := range tableNames {
+			if managed[strings.ToLower(name)] {
+				continue
+			}
+			dbName, tableName := db.Name, name
+			drops = append(drops, &planChange{
+				Action: actionDrop,
+				Kind:   kindTable,
+				Name:   dbName + "." + tableName,
+				apply: func(client *hmsclient.MetastoreClient) error {
+					return client.DropTable(dbName, tableName, false)
+				},
+			})
+		}
+	}
+	return append(plan, drops...), nil
+}
+
+// database converts database spec to Database
+func (spec *databaseSpec) database(defaultOwner string) *hmsclient.Database {
+	owner := spec.Owner
+	if owner == "" {
+		owner = defaultOwner
+	}
+	return &hmsclient.Database{
+		Name:        spec.Name,
+		Description: spec.Description,
+		Owner:       owner,
+		Location:    spec.Location,
+		Parameters:  spec.Parameters,
+	}
+}
+
+// builder converts table spec to table builder, validating column types.
+func (spec *tableSpec) builder(dbName string, owner string) (*hmsclient.TableBuilder, error) {
+	fullName := dbName + "." + spec.Name
+	if spec.Name == "" {
+		return nil, fmt.Errorf("table without name in database %s", dbName)
+	}
+	tb := hmsclient.NewTableBuilder(dbName, spec.Name).
+		WithOwner(owner).
+		WithColumns(spec.columns(spec.Columns)).
+		WithPartitionKeys(spec.columns(spec.PartitionKeys)).
+		WithLocation(spec.Location)
+	for k, v := range spec.Parameters {
+		tb.WithParameter(k, v)
+	}
+	if spec.Comment != "" {
+		tb.WithParameter("comment", spec.Comment)
+	}
+	switch strings.ToLower(spec.Type) {
+	case "", "managed":
+	case "external":
+		tb.Type = hmsclient.TableTypeExternal
+		tb.AsExternal()
+	default:
+		return nil, fmt.Errorf("table %s: invalid table type %q, should be managed or external",
+			fullName, spec.Type)
+	}
+	if spec.StoredAs != "" {
+		format, ok := ddl.LookupStorageFormat(spec.StoredAs)
+		if !ok {
+			return nil, fmt.Errorf("table %s: unknown storage format %q", fullName, spec.StoredAs)
+		}
+		tb.WithSerde(format.Serde).
+			WithInputFormat(format.InputFormat).
+			WithOutputFormat(format.OutputFormat)
+	}
+	if err := tb.Validate(); err != nil {
+		return nil, fmt.Errorf("table %s: %v", fullName, err)
+	}
+	return tb, nil
+}
+
+func (spec *tableSpec) columns(columns []columnSpec) []hive_metastore.FieldSchema {
+	result := make([]hive_metastore.FieldSchema, len(columns))
+	for i, c := range columns {
+		typ := c.Type
+		if typ == "" {
+			typ = stringType
+		}
+		result[i] = hive_metastore.FieldSchema{Name: c.Name, Type: typ, Comment: c.Comment}
+	}
+	return result
+}
+
+// diffDatabase returns list of differences between live database and its spec.
+// Only attributes specified in the spec are compared.
+func diffDatabase(live *hmsclient.Database, desired *databaseSpec) []string {
+	var details []string
+	if desired.Description != "" && live.Description != desired.Description {
+		details = append(details, fmt.Sprintf("description: %q -> %q",
+			live.Description, desired.Description))
+	}
+	if desired.Owner != "" && live.Owner != desired.Owner {
+		details = append(details, fmt.Sprintf("owner: %q -> %q", live.Owner, desired.Owner))
+	}
+	if desired.Location != "" && live.Location != desired.Location {
+		details = append(details, fmt.Sprintf("location: %q (can't be changed, ignored)",
+			desired.Location))
+	}
+	return append(details, diffParameters(live.Parameters, desired.Parameters)...)
+}
+
+// diffTable compares live table with the desired one and returns updated live table
+// together with the list of differences. Only attributes specified in the spec are compared,
+// the default owner used for new tables is ignored.
+func diffTable(live *hive_metastore.Table, spec *tableSpec,
+	desired *hive_metastore.Table) (*hive_metastore.Table, []string, error) {
+	if !sameSchema(live.PartitionKeys, desired.PartitionKeys) {
+		return nil, nil, fmt.Errorf("partition keys can't be changed from %s to %s",
+			schemaString(live.PartitionKeys), schemaString(desired.PartitionKeys))
+	}
+	updated := *live
+	var sd hive_metastore.StorageDescriptor
+	if live.Sd != nil {
+		sd = *live.Sd
+	}
+	liveSd := sd
+	updated.Sd = &sd
+	var details []string
+
+	details = append(details, diffColumns(liveSd.Cols, desired.Sd.Cols)...)
+	if len(details) != 0 {
+		sd.Cols = desired.Sd.Cols
+	}
+	if spec.Owner != "" && live.Owner != spec.Owner {
+		details = append(details, fmt.Sprintf("owner: %q -> %q", live.Owner, spec.Owner))
+		updated.Owner = spec.Owner
+	}
+	if spec.Location != "" && liveSd.Location != spec.Location {
+		details = append(details, fmt.Sprintf("location: %q -> %q", liveSd.Location, spec.Location))
+		sd.Location = spec.Location
+	}
+	if spec.StoredAs != "" && (liveSd.InputFormat != desired.Sd.InputFormat ||
+		liveSd.OutputFormat != desired.Sd.OutputFormat ||
+		liveSd.SerdeInfo.GetSerializationLib() != desired.Sd.SerdeInfo.SerializationLib) {
+		details = append(details, fmt.Sprintf("storage format: -> %s", strings.ToUpper(spec.StoredAs)))
+		sd.InputFormat = desired.Sd.InputFormat
+		sd.OutputFormat = desired.Sd.OutputFormat
+		serde := hive_metastore.SerDeInfo{Name: live.TableName}
+		if liveSd.SerdeInfo != nil {
+			serde = *liveSd.SerdeInfo
+		}
+		serde.SerializationLib = desired.Sd.SerdeInfo.SerializationLib
+		sd.SerdeInfo = &serde
+	}
+	isExternal := strings.EqualFold(desired.Parameters[externalTable], trueValue)
+	wasExternal := live.TableType == hmsclient.TableTypeExternal.String()
+	if spec.Type != "" && isExternal != wasExternal {
+		from, to := hmsclient.TableTypeManaged.String(), hmsclient.TableTypeExternal.String()
+		if wasExternal {
+			from, to = to, from
+		}
+		details = append(details, fmt.Sprintf("type: %s -> %s", from, to))
+		updated.TableType = to
+	}
+	if paramDetails := diffParameters(live.Parameters, desired.Parameters); len(paramDetails) != 0 {
+		details = append(details, paramDetails...)
+		updated.Parameters = mergeParameters(live.Parameters, desired.Parameters)
+	}
+	if spec.Type != "" && !isExternal && wasExternal {
+		delete(updated.Parameters, externalTable)
+	}
+	return &updated, details, nil
+}
+
+// diffColumns returns human-readable differences between two column lists.
+func diffColumns(live []*hive_metastore.FieldSchema, desired []*hive_metastore.FieldSchema) []string {
+	var details []string
+	liveCols := make(map[string]*hive_metastore.FieldSchema)
+	for _, c := range live {
+		liveCols[strings.ToLower(c.Name)] = c
+	}
+	desiredCols := make(map[string]bool)
+	for _, c := range desired {
+		desiredCols[strings.ToLower(c.Name)] = true
+		l, ok := liveCols[strings.ToLower(c.Name)]
+		switch {
+		case !ok:
+			details = append(details, fmt.Sprintf("column %s: added (%s)", c.Name, c.Type))
+		case !sameType(l.Type, c.Type):
+			details = append(details, fmt.Sprintf("column %s: type %s -> %s", c.Name, l.Type, c.Type))
+		case l.Comment != c.Comment:
+			details = append(details, fmt.Sprintf("column %s: comment %q -> %q",
+				c.Name, l.Comment, c.Comment))
+		}
+	}
+	for _, c := range live {
+		if !desiredCols[strings.ToLower(c.Name)] {
+			details = append(details, fmt.Sprintf("column %s: removed", c.Name))
+		}
+	}
+	if len(details) == 0 && !sameSchema(live, desired) {
+		details = append(details, "columns: reordered")
+	}
+	return details
+}
+
+// diffParameters returns differences for parameters present in the desired set.
+// Parameters only present in live set are ignored.
+func diffParameters(live map[string]string, desired map[string]string) []string {
+	keys := make([]string, 0, len(desired))
+	for k := range desired {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var details []string
+	for _, k := range keys {
+		liveValue, ok := live[k]
+		switch {
+		case !ok:
+			details = append(details, fmt.Sprintf("parameter %s: added %q", k, desired[k]))
+		case k == externalTable && strings.EqualFold(liveValue, desired[k]):
+		case liveValue != desired[k]:
+			details = append(details, fmt.Sprintf("parameter %s: %q -> %q", k, liveValue, desired[k]))
+		}
+	}
+	return details
+}
+
+// mergeParameters returns new map with live parameters overwritten by desired ones.
+func mergeParameters(live map[string]string, desired map[string]string) map[string]string {
+	result := make(map[string]string, len(live)+len(desired))
+	for k, v := range live {
+		result[k] = v
+	}
+	for k, v := range desired {
+		result[k] = v
+	}
+	return result
+}
+
+// sameType compares two type strings ignoring case and formatting differences.
+func sameType(a string, b string) bool {
+	ta, err1 := types.Parse(a)
+	tb, err2 := types.Parse(b)
+	if err1 != nil || err2 != nil {
+		return strings.EqualFold(a, b)
+	}
+	return ta.String() == tb.String()
+}
+
+// sameSchema returns true if both schemas have the same column names and types in the same order.
+func sameSchema(a []*hive_metastore.FieldSchema, b []*hive_metastore.FieldSchema) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i].Name, b[i].Name) || !sameType(a[i].Type, b[i].Type) {
+			return false
+		}
+	}
+	return true
+}
+
+func schemaString(schema []*hive_metastore.FieldSchema) string {
+	fields := make([]string, len(schema))
+	for i, f := range schema {
+		fields[i] = f.Name + "=" + f.Type
+	}
+	return "(" + strings.Join(fields, ",") + ")"
+}
+
+// ensure that MetastoreClient can be used for planning
+var _ catalogReader = (*hmsclient.MetastoreClient)(nil)
+
+func init() {
+	applyCmd.Flags().StringP(optFile, "f", "", "catalog file in YAML or JSON format")
+	applyCmd.Flags().Bool(optDryRun, false, "only show the plan")
+	applyCmd.Flags().Bool(optPrune, false, "drop tables which are not in the catalog")
+	applyCmd.Flags().BoolP(optYes, "y", false, "do not ask for confirmation")
+	rootCmd.AddCommand(applyCmd)
+}
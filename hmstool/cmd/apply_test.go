@@ -0,0 +1,194 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+)
+
+// fakeCatalog implements catalogReader on top of in-memory objects
+type fakeCatalog struct {
+	databases  map[string]*hmsclient.Database
+	tables     map[string]map[string]*hive_metastore.Table
+	partitions map[string][]*hive_metastore.Partition // keyed by db.table
+}
+
+func (f *fakeCatalog) GetDatabase(dbName string) (*hmsclient.Database, error) {
+	if db, ok := f.databases[dbName]; ok {
+		return db, nil
+	}
+	return nil, &hive_metastore.NoSuchObjectException{}
+}
+
+func (f *fakeCatalog) GetAllTables(dbName string) ([]string, error) {
+	var names []string
+	for name := range f.tables[dbName] {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (f *fakeCatalog) GetTable(dbName string, tableName string) (*hive_metastore.Table, error) {
+	if t, ok := f.tables[dbName][tableName]; ok {
+		return t, nil
+	}
+	return nil, &hive_metastore.NoSuchObjectException{}
+}
+
+func testCatalog() *catalogSpec {
+	return &catalogSpec{Databases: []*databaseSpec{{
+		Name:        "sales",
+		Description: "Sales data",
+		Parameters:  map[string]string{"team": "finance"},
+		Tables: []*tableSpec{{
+			Name:          "orders",
+			Type:          "external",
+			Columns:       []columnSpec{{Name: "id", Type: "BIGINT"}, {Name: "price", Type: "decimal(10, 2)"}},
+			PartitionKeys: []columnSpec{{Name: "ds"}},
+			StoredAs:      "orc",
+		}},
+	}}}
+}
+
+func planSummary(plan []*planChange) []string {
+	var result []string
+	for _, c := range plan {
+		result = append(result, c.Action+" "+c.Kind+" "+c.Name)
+	}
+	return result
+}
+
+func TestMakePlanCreate(t *testing.T) {
+	plan, err := makePlan(&fakeCatalog{}, testCatalog(), "admin", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"create database sales", "create table sales.orders"}
+	if got := planSummary(plan); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestMakePlanUpdate(t *testing.T) {
+	catalog := testCatalog()
+	tb, err := catalog.Databases[0].Tables[0].builder("sales", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders := tb.Build()
+	// Same types written differently should not be reported
+	orders.Sd.Cols[0].Type = "bigint"
+	orders.Sd.Cols[1].Type = "decimal(10,2)"
+	orders.Parameters["transient_lastDdlTime"] = "1539000000"
+	unchanged := tb.Build()
+
+	live := &fakeCatalog{
+		databases: map[string]*hmsclient.Database{
+			"sales": {Name: "sales", Description: "Sales data", Owner: "admin",
+				Parameters: map[string]string{"team": "sales", "other": "x"}},
+		},
+		tables: map[string]map[string]*hive_metastore.Table{
+			"sales": {"orders": orders, "tmp": unchanged},
+		},
+	}
+	plan, err := makePlan(live, catalog, "admin", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"update database sales", "drop table sales.tmp"}
+	if got := planSummary(plan); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	if details := plan[0].Details; !reflect.DeepEqual(details,
+		[]string{`parameter team: "sales" -> "finance"`}) {
+		t.Errorf("unexpected database details %v", details)
+	}
+
+	// Now add a column and change table type
+	catalog.Databases[0].Tables[0].Columns = append(catalog.Databases[0].Tables[0].Columns,
+		columnSpec{Name: "note", Comment: "free text"})
+	catalog.Databases[0].Tables[0].Type = "managed"
+	plan, err = makePlan(live, catalog, "admin", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 2 {
+		t.Fatalf("expected 2 changes, got %v", planSummary(plan))
+	}
+	expectedDetails := []string{
+		"column note: added (string)",
+		"type: EXTERNAL_TABLE -> MANAGED_TABLE",
+	}
+	if !reflect.DeepEqual(plan[1].Details, expectedDetails) {
+		t.Errorf("expected %v, got %v", expectedDetails, plan[1].Details)
+	}
+}
+
+func TestMakePlanPartitionKeys(t *testing.T) {
+	catalog := testCatalog()
+	tb, _ := catalog.Databases[0].Tables[0].builder("sales", "admin")
+	orders := tb.Build()
+	orders.PartitionKeys[0].Type = "int"
+	live := &fakeCatalog{
+		databases: map[string]*hmsclient.Database{"sales": {Name: "sales"}},
+		tables:    map[string]map[string]*hive_metastore.Table{"sales": {"orders": orders}},
+	}
+	if _, err := makePlan(live, catalog, "admin", false); err == nil {
+		t.Error("partition key change should be rejected")
+	}
+}
+
+func TestMakePlanUnspecifiedAttributes(t *testing.T) {
+	catalog := testCatalog()
+	catalog.Databases[0].Description = ""
+	tb, err := catalog.Databases[0].Tables[0].builder("sales", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := &fakeCatalog{
+		databases: map[string]*hmsclient.Database{
+			"sales": {Name: "sales", Description: "Old description", Owner: "bob",
+				Parameters: map[string]string{"team": "finance"}},
+		},
+		tables: map[string]map[string]*hive_metastore.Table{"sales": {"orders": tb.Build()}},
+	}
+	plan, err := makePlan(live, catalog, "admin", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 0 {
+		t.Errorf("expected no changes, got %v", planSummary(plan))
+	}
+
+	// Table without storage descriptor
+	live.tables["sales"]["orders"].Sd = nil
+	catalog.Databases[0].Tables[0].Owner = "admin"
+	if plan, err = makePlan(live, catalog, "admin", false); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"update table sales.orders"}
+	if got := planSummary(plan); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	details := strings.Join(plan[0].Details, "\n")
+	if !strings.Contains(details, `owner: "bob" -> "admin"`) || !strings.Contains(details, "storage format") {
+		t.Errorf("unexpected details %v", plan[0].Details)
+	}
+}
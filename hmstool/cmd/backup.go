@@ -0,0 +1,544 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/gobwas/glob"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	optDest = "dest"
+	optFrom = "from"
+	optOnly = "only"
+
+	manifestName    = "manifest.json"
+	manifestVersion = 1
+	backupSuffix    = ".ndjson.gz"
+	restoreJournal  = "restore.journal"
+)
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "backup metastore objects to a directory",
+	Run:   backup,
+	Long: `Backup databases, tables and partitions to a local directory.
+
+Every database and every table with its partitions is written to a separate
+gzip-compressed NDJSON file, <db>.ndjson.gz and <db>/<table>.ndjson.gz. The
+manifest.json file lists all files with their SHA-256 checksums, together with
+the metastore UUID and notification event IDs before and after the backup.
+The manifest is written last, so a directory without manifest is an incomplete backup.
+
+Databases are selected with -d (default is all databases), tables can be selected
+with the same filters as for export.
+
+Use "hmstool restore" to restore objects from the backup and "hmstool backup verify"
+to check the backup without connecting to HMS.
+
+Examples:
+
+    hmstool backup --dest /backups/hms-2018-10-17
+    hmstool backup --dest /backups/sales -d sales --exclude 'tmp_*'
+    hmstool backup verify --from /backups/hms-2018-10-17
+`,
+}
+
+var backupVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "verify backup without connecting to HMS",
+	Run:   backupVerify,
+	Long: `Verify that all files listed in the backup manifest exist, match their
+checksums and contain the objects they are supposed to contain.
+
+Example:
+
+    hmstool backup verify --from /backups/hms-2018-10-17
+`,
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "restore metastore objects from backup",
+	Run:   restore,
+	Long: `Restore databases, tables and partitions from backup created by "hmstool backup".
+
+Checksums of restored files are verified before anything is restored. Databases are
+restored first, then tables with their partitions and finally views. Objects can be
+selected with --only, which accepts database names or db.table names and glob patterns.
+The database of each selected table is restored as well.
+
+Restore works like import: existing objects are handled according to --on-conflict,
+locations can be rewritten with --rewrite-location, and completed objects are
+recorded in the journal, so failed restore can be simply rerun. The journal is kept
+in the backup directory unless --journal is specified.
+
+Examples:
+
+    hmstool restore --from /backups/hms-2018-10-17
+    hmstool restore --from /backups/hms-2018-10-17 --only sales.orders --on-conflict replace
+`,
+}
+
+// backupManifest describes backup content
+type backupManifest struct {
+	Version       int           `json:"version"`
+	MetastoreUUID string        `json:"metastoreUuid,omitempty"`
+	Snapshot      *SnapshotInfo `json:"snapshot,omitempty"`
+	Files         []*backupFile `json:"files"`
+}
+
+// backupFile is a single file of the backup holding a database or a table
+// with its partitions.
+type backupFile struct {
+	Name      string `json:"name"` // Path relative to the backup directory
+	Kind      string `json:"kind"`
+	Database  string `json:"database"`
+	Table     string `json:"table,omitempty"`
+	TableType string `json:"tableType,omitempty"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+}
+
+func (f *backupFile) String() string {
+	if f.Kind == kindTable {
+		return f.Database + "." + f.Table
+	}
+	return f.Database
+}
+
+func backup(cmd *cobra.Command, _ []string) {
+	dest, _ := cmd.Flags().GetString(optDest)
+	if dest == "" {
+		log.Fatalf("--%s should be specified", optDest)
+	}
+	if _, err := os.Stat(filepath.Join(dest, manifestName)); err == nil {
+		log.Fatalf("%s already contains backup", dest)
+	}
+	filter, err := newExportFilter(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+	client, err := getClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+
+	dbNames, _ := cmd.Flags().GetStringSlice(optDbName)
+	if len(dbNames) == 0 {
+		if dbNames, err = client.GetAllDatabases(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	uuid, err := client.GetMetastoreDbUUID()
+	if err != nil {
+		log.Println("failed to get metastore UUID:", err)
+	}
+	snapshot := &SnapshotInfo{Host: viper.GetString(hostOpt), Time: time.Now().UTC()}
+	if snapshot.BeforeEventID, err = client.GetCurrentNotificationId(); err != nil {
+		log.Println("failed to get current notification id:", err)
+	}
+	manifest, err := writeBackup(client, dest, dbNames, filter)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if snapshot.AfterEventID, err = client.GetCurrentNotificationId(); err != nil {
+		log.Println("failed to get current notification id:", err)
+	}
+	if snapshot.AfterEventID != snapshot.BeforeEventID {
+		log.Printf("HMS was modified during backup (events %d-%d), backup may be inconsistent",
+			snapshot.BeforeEventID+1, snapshot.AfterEventID)
+	}
+	manifest.MetastoreUUID = uuid
+	manifest.Snapshot = snapshot
+	if err = manifest.save(dest); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Backup of %d files written to %s", len(manifest.Files), dest)
+}
+
+// writeBackup writes files for the given databases and returns manifest describing them
+func writeBackup(client exportSource, dir string, dbNames []string, filter *exportFilter) (*backupManifest, error) {
+	manifest := &backupManifest{Version: manifestVersion}
+	for _, dbName := range dbNames {
+		db, err := client.GetDatabase(dbName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get database %s: %v", dbName, err)
+		}
+		file, err := writeBackupFile(dir, dbName+backupSuffix, func(sink exportSink) error {
+			return sink.addDatabase(db)
+		})
+		if err != nil {
+			return nil, err
+		}
+		file.Kind = kindDatabase
+		file.Database = dbName
+		manifest.Files = append(manifest.Files, file)
+
+		tableNames, err := client.GetAllTables(dbName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get tables for %s: %v", dbName, err)
+		}
+		sort.Strings(tableNames)
+		for _, tableName := range tableNames {
+			if !filter.acceptName(dbName, tableName) {
+				continue
+			}
+			table, err := client.GetTable(dbName, tableName)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get table %s.%s: %v", dbName, tableName, err)
+			}
+			if !filter.acceptType(table.TableType) {
+				continue
+			}
+			name := filepath.Join(dbName, tableName+backupSuffix)
+			file, err := writeBackupFile(dir, name, func(sink exportSink) error {
+				if err := sink.addTable(table); err != nil {
+					return err
+				}
+				if filter != nil && filter.noPartitions {
+					return nil
+				}
+				return exportPartitions(client, sink, dbName, tableName, filter)
+			})
+			if err != nil {
+				return nil, err
+			}
+			file.Kind = kindTable
+			file.Database = dbName
+			file.Table = tableName
+			file.TableType = table.TableType
+			manifest.Files = append(manifest.Files, file)
+		}
+	}
+	return manifest, nil
+}
+
+// writeBackupFile writes objects to the compressed NDJSON file and returns its description
+func writeBackupFile(dir string, name string, write func(sink exportSink) error) (*backupFile, error) {
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	w, err := createOutput(path, compressGzip)
+	if err != nil {
+		return nil, err
+	}
+	err = write(newRecordWriter(w))
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	checksum, size, err := fileChecksum(path)
+	if err != nil {
+		return nil, err
+	}
+	return &backupFile{Name: filepath.ToSlash(name), Size: size, SHA256: checksum}, nil
+}
+
+// fileChecksum returns hex-encoded SHA-256 checksum and size of the file
+func fileChecksum(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// save atomically writes manifest to the backup directory
+func (m *backupManifest) save(dir string) error {
+	b, _ := json.MarshalIndent(m, "", "  ")
+	fileName := filepath.Join(dir, manifestName)
+	tmpName := fileName + ".tmp"
+	if err := ioutil.WriteFile(tmpName, b, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest %s: %v", tmpName, err)
+	}
+	if err := os.Rename(tmpName, fileName); err != nil {
+		return fmt.Errorf("failed to write manifest %s: %v", fileName, err)
+	}
+	return nil
+}
+
+// readManifest reads manifest from the backup directory
+func readManifest(dir string) (*backupManifest, error) {
+	fileName := filepath.Join(dir, manifestName)
+	raw, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %v", err)
+	}
+	manifest := new(backupManifest)
+	if err = json.Unmarshal(raw, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %v", fileName, err)
+	}
+	if manifest.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", manifest.Version)
+	}
+	return manifest, nil
+}
+
+// verifyBackup verifies files and returns the list of problems found
+func verifyBackup(dir string, files []*backupFile) []string {
+	var problems []string
+	for _, f := range files {
+		if err := verifyBackupFile(dir, f); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", f.Name, err))
+		}
+	}
+	return problems
+}
+
+// verifyBackupFile verifies file checksum and content
+func verifyBackupFile(dir string, f *backupFile) error {
+	path := filepath.Join(dir, filepath.FromSlash(f.Name))
+	checksum, size, err := fileChecksum(path)
+	if err != nil {
+		return err
+	}
+	if size != f.Size || checksum != f.SHA256 {
+		return fmt.Errorf("checksum mismatch")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r, err := newDecompressingReader(file)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var record streamRecord
+		if err := decoder.Decode(&record); err != nil {
+			if err == io.EOF {
+				if line == 1 {
+					return fmt.Errorf("file is empty")
+				}
+				return nil
+			}
+			return fmt.Errorf("invalid record %d: %v", line, err)
+		}
+		var valid bool
+		switch {
+		case line == 1 && f.Kind == kindDatabase:
+			valid = record.Database != nil && record.Database.Name == f.Database
+		case line == 1 && f.Kind == kindTable:
+			valid = record.Table != nil && record.Table.DbName == f.Database && record.Table.TableName == f.Table
+		case f.Kind == kindTable:
+			valid = record.Partition != nil &&
+				record.Partition.DbName == f.Database && record.Partition.TableName == f.Table
+		}
+		if !valid {
+			return fmt.Errorf("unexpected record %d of kind %s", line, record.Kind)
+		}
+	}
+}
+
+// selectFiles returns files matching any of the patterns in the restore order: databases,
+// tables and then views. Database of every selected table is selected as well.
+// All files are selected if there are no patterns.
+func selectFiles(files []*backupFile, patterns []string) ([]*backupFile, error) {
+	globs := make([]glob.Glob, len(patterns))
+	for i, p := range patterns {
+		g, err := glob.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", p, err)
+		}
+		globs[i] = g
+	}
+	matches := func(name string) bool {
+		if len(globs) == 0 {
+			return true
+		}
+		for _, g := range globs {
+			if g.Match(name) {
+				return true
+			}
+		}
+		return false
+	}
+	selectedDbs := make(map[string]bool)
+	var tables, views []*backupFile
+	for _, f := range files {
+		if f.Kind != kindTable || !(matches(f.Database) || matches(f.String())) {
+			continue
+		}
+		selectedDbs[f.Database] = true
+		if f.TableType == hmsclient.TableTypeView.String() {
+			views = append(views, f)
+		} else {
+			tables = append(tables, f)
+		}
+	}
+	var result []*backupFile
+	for _, f := range files {
+		if f.Kind == kindDatabase && (selectedDbs[f.Database] || matches(f.Database)) {
+			result = append(result, f)
+		}
+	}
+	result = append(result, tables...)
+	return append(result, views...), nil
+}
+
+// archiveReader reads decompressed content of backup files one after another
+type archiveReader struct {
+	dir     string
+	files   []*backupFile
+	file    *os.File
+	current io.Reader
+}
+
+func (r *archiveReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.files) == 0 {
+				return 0, io.EOF
+			}
+			f, err := os.Open(filepath.Join(r.dir, filepath.FromSlash(r.files[0].Name)))
+			if err != nil {
+				return 0, err
+			}
+			r.files = r.files[1:]
+			reader, err := newDecompressingReader(f)
+			if err != nil {
+				f.Close()
+				return 0, err
+			}
+			r.file, r.current = f, reader
+		}
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.file.Close()
+			r.file, r.current = nil, nil
+			if n == 0 {
+				continue
+			}
+			return n, nil
+		}
+		return n, err
+	}
+}
+
+func backupVerify(cmd *cobra.Command, _ []string) {
+	dir, _ := cmd.Flags().GetString(optFrom)
+	manifest, err := readManifest(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if problems := verifyBackup(dir, manifest.Files); len(problems) != 0 {
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+		os.Exit(1)
+	}
+	fmt.Printf("%d files verified\n", len(manifest.Files))
+}
+
+func restore(cmd *cobra.Command, _ []string) {
+	dir, _ := cmd.Flags().GetString(optFrom)
+	if dir == "" {
+		log.Fatalf("--%s should be specified", optFrom)
+	}
+	opts, err := newImportOptions(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+	manifest, err := readManifest(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	only, _ := cmd.Flags().GetStringSlice(optOnly)
+	files, err := selectFiles(manifest.Files, only)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(files) == 0 {
+		log.Fatal("no objects to restore")
+	}
+	if problems := verifyBackup(dir, files); len(problems) != 0 {
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+		log.Fatal("backup is damaged, nothing is restored")
+	}
+	if s := manifest.Snapshot; s != nil {
+		log.Printf("Restoring backup of %s taken at %s, event %d",
+			s.Host, s.Time.Format(time.RFC3339), s.BeforeEventID)
+	}
+
+	client, err := getClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+	journalName, _ := cmd.Flags().GetString(optJournal)
+	if journalName == "" {
+		journalName = filepath.Join(dir, restoreJournal)
+	}
+	journal, err := openJournal(journalName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	report := newImportReport()
+	im := newImporter(client, opts, journal, report)
+	err = im.importStream(&archiveReader{dir: dir, files: files})
+	journal.Close()
+	if err != nil {
+		report.fail("backup", dir, err)
+	}
+	fmt.Print(report)
+	if report.failed() {
+		os.Exit(1)
+	}
+}
+
+func init() {
+	backupCmd.Flags().String(optDest, "", "backup directory")
+	backupCmd.Flags().StringSliceP(optDbName, "d", nil, "databases to backup (default all)")
+	addFilterFlags(backupCmd)
+	backupVerifyCmd.Flags().String(optFrom, ".", "backup directory")
+	backupCmd.AddCommand(backupVerifyCmd)
+	rootCmd.AddCommand(backupCmd)
+
+	restoreCmd.Flags().String(optFrom, "", "backup directory")
+	restoreCmd.Flags().StringSlice(optOnly, nil, "restore only given databases or db.table names")
+	restoreCmd.Flags().String(optJournal, "", "journal file (default is "+restoreJournal+" in the backup directory)")
+	addImportFlags(restoreCmd)
+	rootCmd.AddCommand(restoreCmd)
+}
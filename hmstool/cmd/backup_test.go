@@ -0,0 +1,92 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+)
+
+func TestBackupRestore(t *testing.T) {
+	orders, ordersParts := deltaTestTable("orders", "1", "2", "3")
+	items, itemsParts := deltaTestTable("items", "1")
+	view := &hive_metastore.Table{DbName: "sales", TableName: "recent",
+		TableType: hmsclient.TableTypeView.String()}
+	source := &fakeCatalog{
+		databases: map[string]*hmsclient.Database{"sales": {Name: "sales"}, "hr": {Name: "hr"}},
+		tables: map[string]map[string]*hive_metastore.Table{
+			"sales": {"recent": view, "orders": orders, "items": items}},
+		partitions: map[string][]*hive_metastore.Partition{
+			"sales.orders": ordersParts, "sales.items": itemsParts},
+	}
+	dir := t.TempDir()
+	manifest, err := writeBackup(source, dir, []string{"hr", "sales"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = manifest.save(dir); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err = readManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems := verifyBackup(dir, manifest.Files); len(problems) != 0 {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+
+	files, err := selectFiles(manifest.Files, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	expected := []string{"hr.ndjson.gz", "sales.ndjson.gz",
+		"sales/items.ndjson.gz", "sales/orders.ndjson.gz", "sales/recent.ndjson.gz"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected restore order %v, got %v", expected, names)
+	}
+
+	files, _ = selectFiles(manifest.Files, []string{"sales.ord*"})
+	if len(files) != 2 || files[0].String() != "sales" || files[1].String() != "sales.orders" {
+		t.Errorf("unexpected selection %v", files)
+	}
+	target := newFakeTarget()
+	im := newTestImporter(t, target, filepath.Join(dir, "journal"), conflictSkip)
+	if err = im.importStream(&archiveReader{dir: dir, files: files}); err != nil {
+		t.Fatal(err)
+	}
+	checkCounts(t, im.report, kindDatabase, map[string]int{resultCreated: 1})
+	checkCounts(t, im.report, kindTable, map[string]int{resultCreated: 1})
+	checkCounts(t, im.report, kindPartition, map[string]int{resultCreated: 3})
+	if len(target.tables) != 1 || target.tables["sales.orders"] == nil {
+		t.Errorf("unexpected tables %v", target.tables)
+	}
+
+	// Damaged file is detected
+	if err = ioutil.WriteFile(filepath.Join(dir, "sales", "items.ndjson.gz"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if problems := verifyBackup(dir, manifest.Files); len(problems) != 1 {
+		t.Errorf("expected one problem, got %v", problems)
+	}
+}
@@ -0,0 +1,339 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+	"github.com/gobwas/glob"
+	"github.com/spf13/cobra"
+)
+
+const (
+	bulkOK     = "ok"
+	bulkFailed = "failed"
+)
+
+var tableSetParamCmd = &cobra.Command{
+	Use:   "set-param",
+	Short: "set parameters of tables matching a pattern",
+	Run:   setTableParams,
+	Long: `Set parameters of all tables matching the pattern.
+
+The pattern has the form dbName.tableName or tableName with database specified by -d flag.
+Both database and table names may be glob patterns. The list of matching tables is shown
+and the change is applied after confirmation, use --yes to skip confirmation or --dry-run
+to only show matching tables. The command fails when confirmation is refused.
+
+Examples:
+
+    hmstool table set-param 'sales.*' retention=30
+    hmstool table set-param -d staging 'tmp_*' owner_team=etl retention=1 --yes
+`,
+}
+
+var tableSetOwnerCmd = &cobra.Command{
+	Use:   "set-owner",
+	Short: "set owner of tables matching a pattern",
+	Run:   setTableOwner,
+	Long: `Set owner of all tables matching the pattern.
+
+The pattern has the form dbName.tableName or tableName with database specified by -d flag.
+Both database and table names may be glob patterns. The list of matching tables is shown
+and the change is applied after confirmation, use --yes to skip confirmation or --dry-run
+to only show matching tables. The command fails when confirmation is refused.
+
+Examples:
+
+    hmstool table set-owner 'sales.*' etl
+    hmstool table set-owner -d staging 'tmp_*' nobody --yes
+`,
+}
+
+// bulkSource is the part of the metastore client used to select objects
+type bulkSource interface {
+	GetAllDatabases() ([]string, error)
+	GetAllTables(dbName string) ([]string, error)
+}
+
+// bulkTarget is the part of the metastore client used by bulk table operations
+type bulkTarget interface {
+	bulkSource
+	GetTable(dbName string, tableName string) (*hive_metastore.Table, error)
+	AlterTable(dbName string, tableName string, table *hive_metastore.Table) error
+	DropTable(dbName string, tableName string, deleteData bool) error
+}
+
+// tableOp is an operation applied to a single table by bulk commands
+type tableOp func(client bulkTarget, dbName string, tableName string) error
+
+// bulkResult is the outcome of bulk operation on a single object
+type bulkResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+var bulkColumns = []column{
+	{"NAME", func(item interface{}) string { return item.(*bulkResult).Name }},
+	{"STATUS", func(item interface{}) string { return item.(*bulkResult).Status }},
+	{"ERROR", func(item interface{}) string { return item.(*bulkResult).Error }},
+}
+
+// matchTables returns db.table pairs of tables matching the patterns.
+// Patterns have the form db.table or table with dbName as the database,
+// both parts may be globs. The result is sorted and has no duplicates.
+func matchTables(client bulkSource, dbName string, patterns []string) ([][2]string, error) {
+	var allDatabases []string
+	var selected [][2]string
+	seen := make(map[[2]string]bool)
+	for _, pattern := range patterns {
+		dbPattern, tablePattern := dbName, pattern
+		if parts := strings.SplitN(pattern, ".", 2); len(parts) == 2 {
+			dbPattern, tablePattern = parts[0], parts[1]
+		}
+		if dbPattern == "" {
+			return nil, fmt.Errorf("missing database name for %s", pattern)
+		}
+		dbGlob, err := glob.Compile(dbPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", dbPattern, err)
+		}
+		tableGlob, err := glob.Compile(tablePattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", tablePattern, err)
+		}
+		dbNames := []string{dbPattern}
+		if glob.QuoteMeta(dbPattern) != dbPattern {
+			if allDatabases == nil {
+				if allDatabases, err = client.GetAllDatabases(); err != nil {
+					return nil, fmt.Errorf("failed to get databases: %v", err)
+				}
+			}
+			dbNames = nil
+			for _, db := range allDatabases {
+				if dbGlob.Match(db) {
+					dbNames = append(dbNames, db)
+				}
+			}
+		}
+		for _, db := range dbNames {
+			tableNames, err := client.GetAllTables(db)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get tables for %s: %v", db, err)
+			}
+			for _, tableName := range tableNames {
+				name := [2]string{db, tableName}
+				if tableGlob.Match(tableName) && !seen[name] {
+					seen[name] = true
+					selected = append(selected, name)
+				}
+			}
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		if selected[i][0] != selected[j][0] {
+			return selected[i][0] < selected[j][0]
+		}
+		return selected[i][1] < selected[j][1]
+	})
+	return selected, nil
+}
+
+// confirmBulk shows objects affected by the action and asks for confirmation
+// unless --yes is given. It returns false for --dry-run. The list and the prompt
+// are written to stderr, so that stdout only has results. The command fails when
+// confirmation is refused or can't be read, so scripts don't mistake it for success.
+func confirmBulk(cmd *cobra.Command, action string, kind string, names []string) bool {
+	fmt.Fprintf(os.Stderr, "%ss to %s:\n", strings.Title(kind), action)
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "   ", name)
+	}
+	if dryRun, _ := cmd.Flags().GetBool(optDryRun); dryRun {
+		return false
+	}
+	if yes, _ := cmd.Flags().GetBool(optYes); yes {
+		return true
+	}
+	if !confirm(fmt.Sprintf("%s %d %ss?", strings.Title(action), len(names), kind)) {
+		fmt.Fprintln(os.Stderr, "cancelled")
+		os.Exit(1)
+	}
+	return true
+}
+
+// runBulk applies op to every selected table concurrently, one table per client
+// at a time, and returns per-table results. Failures don't stop other operations.
+func runBulk(clients []bulkTarget, selected [][2]string, op tableOp) []*bulkResult {
+	results := make([]*bulkResult, len(selected))
+	runWorkers(len(clients), len(selected), func(w int, i int) error {
+		dbName, tableName := selected[i][0], selected[i][1]
+		results[i] = &bulkResult{Name: dbName + "." + tableName, Status: bulkOK}
+		if err := op(clients[w], dbName, tableName); err != nil {
+			results[i].Status = bulkFailed
+			results[i].Error = err.Error()
+		}
+		return nil
+	})
+	return results
+}
+
+// bulkTables selects tables matching patterns, asks for confirmation and runs op
+// for each selected table, then shows results.
+func bulkTables(cmd *cobra.Command, patterns []string, action string, op tableOp) {
+	workers, _ := cmd.Flags().GetInt(optWorkers)
+	client, err := getClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+
+	dbName, _ := cmd.Flags().GetString(optDbName)
+	selected, err := matchTables(client, dbName, patterns)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(selected) == 0 {
+		log.Fatal("no tables match ", strings.Join(patterns, " "))
+	}
+	names := make([]string, len(selected))
+	for i, s := range selected {
+		names[i] = s[0] + "." + s[1]
+	}
+	if !confirmBulk(cmd, action, "table", names) {
+		return
+	}
+	// Thrift clients can't be used concurrently, so each worker uses its own clone
+	targets := []bulkTarget{client}
+	for len(targets) < workers && len(targets) < len(selected) {
+		c, err := client.Clone()
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer c.Close()
+		targets = append(targets, c)
+	}
+	showBulkResults(cmd, runBulk(targets, selected, op))
+}
+
+// showBulkResults displays results and exits with error if any operation failed
+func showBulkResults(cmd *cobra.Command, results []*bulkResult) {
+	items := make([]interface{}, len(results))
+	failed := 0
+	for i, r := range results {
+		items[i] = r
+		if r.Status == bulkFailed {
+			failed++
+		}
+	}
+	data := &displayData{object: results, sections: []displaySection{{items: items, columns: bulkColumns}}}
+	if err := display(cmd, data, formatTable); err != nil {
+		log.Fatal(err)
+	}
+	if failed != 0 {
+		log.Fatalf("%d of %d operations failed", failed, len(results))
+	}
+}
+
+// parseParams parses key=value arguments
+func parseParams(args []string) (map[string]string, error) {
+	params := make(map[string]string, len(args))
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid parameter %q, should be key=value", arg)
+		}
+		params[kv[0]] = kv[1]
+	}
+	return params, nil
+}
+
+// alterTableOp returns operation applying change to the table and writing it back
+func alterTableOp(change func(table *hive_metastore.Table)) tableOp {
+	return func(client bulkTarget, dbName string, tableName string) error {
+		table, err := client.GetTable(dbName, tableName)
+		if err != nil {
+			return err
+		}
+		change(table)
+		return client.AlterTable(dbName, tableName, table)
+	}
+}
+
+// dropTableOp drops the table together with its data
+func dropTableOp(client bulkTarget, dbName string, tableName string) error {
+	return client.DropTable(dbName, tableName, true)
+}
+
+// setParamsOp returns operation setting table parameters
+func setParamsOp(params map[string]string) tableOp {
+	return alterTableOp(func(table *hive_metastore.Table) {
+		if table.Parameters == nil {
+			table.Parameters = make(map[string]string)
+		}
+		for k, v := range params {
+			table.Parameters[k] = v
+		}
+	})
+}
+
+// setOwnerOp returns operation setting table owner
+func setOwnerOp(owner string) tableOp {
+	return alterTableOp(func(table *hive_metastore.Table) {
+		table.Owner = owner
+	})
+}
+
+func setTableParams(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		log.Fatal("table pattern and parameters should be specified")
+	}
+	params, err := parseParams(args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	bulkTables(cmd, args[:1], "update", setParamsOp(params))
+}
+
+func setTableOwner(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		log.Fatal("table pattern and owner should be specified")
+	}
+	bulkTables(cmd, args[:1], "update", setOwnerOp(args[1]))
+}
+
+// addConfirmFlags adds flags controlling confirmation of bulk operations
+func addConfirmFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool(optDryRun, false, "only show affected objects")
+	cmd.Flags().BoolP(optYes, "y", false, "do not ask for confirmation")
+}
+
+// addBulkFlags adds flags controlling confirmation and concurrency of bulk operations
+func addBulkFlags(cmd *cobra.Command) {
+	addConfirmFlags(cmd)
+	cmd.Flags().Int(optWorkers, 8, "number of concurrent operations")
+}
+
+func init() {
+	addBulkFlags(tableSetParamCmd)
+	addBulkFlags(tableSetOwnerCmd)
+	tablesCmd.AddCommand(tableSetParamCmd)
+	tablesCmd.AddCommand(tableSetOwnerCmd)
+}
@@ -0,0 +1,88 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+)
+
+func (f *fakeCatalog) DropTable(dbName string, tableName string, deleteData bool) error {
+	if _, ok := f.tables[dbName][tableName]; !ok {
+		return &hive_metastore.NoSuchObjectException{Message: dbName + "." + tableName}
+	}
+	delete(f.tables[dbName], tableName)
+	return nil
+}
+
+func TestBulkTables(t *testing.T) {
+	newTable := func(db, name string) *hive_metastore.Table {
+		return &hive_metastore.Table{DbName: db, TableName: name, Owner: "hive"}
+	}
+	catalog := &fakeCatalog{
+		databases: map[string]*hmsclient.Database{"sales": {}, "staging": {}, "staging_old": {}},
+		tables: map[string]map[string]*hive_metastore.Table{
+			"sales": {"orders": newTable("sales", "orders"), "items": newTable("sales", "items")},
+			"staging": {"tmp_1": newTable("staging", "tmp_1"), "tmp_2": newTable("staging", "tmp_2"),
+				"keep": newTable("staging", "keep")},
+			"staging_old": {"tmp_1": newTable("staging_old", "tmp_1")},
+		},
+	}
+
+	selected, err := matchTables(catalog, "staging", []string{"tmp_*", "staging.tmp_1", "sales.*", "staging_*.tmp*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][2]string{{"sales", "items"}, {"sales", "orders"},
+		{"staging", "tmp_1"}, {"staging", "tmp_2"}, {"staging_old", "tmp_1"}}
+	if !reflect.DeepEqual(selected, expected) {
+		t.Errorf("expected %v, got %v", expected, selected)
+	}
+	if _, err = matchTables(catalog, "", []string{"tmp_*"}); err == nil {
+		t.Error("expected error for missing database")
+	}
+
+	clients := []bulkTarget{catalog}
+	results := runBulk(clients, [][2]string{{"sales", "items"}, {"sales", "missing"}},
+		setParamsOp(map[string]string{"retention": "30"}))
+	if results[0].Status != bulkOK || results[1].Status != bulkFailed || results[1].Error == "" {
+		t.Errorf("unexpected results %v %v", results[0], results[1])
+	}
+	if catalog.tables["sales"]["items"].Parameters["retention"] != "30" {
+		t.Errorf("parameter not set: %v", catalog.tables["sales"]["items"].Parameters)
+	}
+
+	runBulk(clients, [][2]string{{"sales", "orders"}}, setOwnerOp("etl"))
+	if owner := catalog.tables["sales"]["orders"].Owner; owner != "etl" {
+		t.Errorf("expected owner etl, got %s", owner)
+	}
+
+	results = runBulk(clients, [][2]string{{"staging", "tmp_1"}, {"staging", "tmp_2"}}, dropTableOp)
+	for _, r := range results {
+		if r.Status != bulkOK {
+			t.Errorf("failed to drop %s: %s", r.Name, r.Error)
+		}
+	}
+	if names, _ := catalog.GetAllTables("staging"); !reflect.DeepEqual(names, []string{"keep"}) {
+		t.Errorf("expected only keep in staging, got %v", names)
+	}
+
+	if _, err = parseParams([]string{"a=1", "b"}); err == nil {
+		t.Error("expected error for parameter without value")
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	optCompress = "compress"
+
+	compressNone = "none"
+	compressGzip = "gzip"
+	compressZstd = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// compressionFromName returns compression implied by file extension
+func compressionFromName(fileName string) string {
+	switch {
+	case strings.HasSuffix(fileName, ".gz"):
+		return compressGzip
+	case strings.HasSuffix(fileName, ".zst"):
+		return compressZstd
+	}
+	return compressNone
+}
+
+// trimCompressionSuffix removes compression extension from the file name
+func trimCompressionSuffix(fileName string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(fileName, ".gz"), ".zst")
+}
+
+// chainCloser closes the list of closers in order
+type chainCloser struct {
+	io.Writer
+	closers []io.Closer
+}
+
+func (c *chainCloser) Close() error {
+	var result error
+	for _, closer := range c.closers {
+		if err := closer.Close(); err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
+
+// newCompressingWriter wraps writer with compressor. Closing the result flushes
+// compressed data but doesn't close the underlying writer.
+func newCompressingWriter(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case "", compressNone:
+		return &chainCloser{Writer: w}, nil
+	case compressGzip:
+		return gzip.NewWriter(w), nil
+	case compressZstd:
+		return zstd.NewWriter(w)
+	}
+	return nil, fmt.Errorf("unsupported compression %s, should be %s, %s or %s",
+		compression, compressNone, compressGzip, compressZstd)
+}
+
+// createOutput opens output file or stdout if fileName is empty, compressing written data.
+func createOutput(fileName string, compression string) (io.WriteCloser, error) {
+	var out io.Writer = os.Stdout
+	var closers []io.Closer
+	if fileName != "" {
+		f, err := os.Create(fileName)
+		if err != nil {
+			return nil, err
+		}
+		out = f
+		closers = append(closers, f)
+	}
+	buffered := bufio.NewWriter(out)
+	w, err := newCompressingWriter(buffered, compression)
+	if err != nil {
+		for _, c := range closers {
+			c.Close()
+		}
+		return nil, err
+	}
+	closers = append([]io.Closer{w, flushCloser{buffered}}, closers...)
+	return &chainCloser{Writer: w, closers: closers}, nil
+}
+
+// flushCloser flushes buffered writer on Close
+type flushCloser struct {
+	w *bufio.Writer
+}
+
+func (f flushCloser) Close() error {
+	return f.w.Flush()
+}
+
+// newDecompressingReader returns reader which transparently decompresses gzip
+// or zstd data. Compression is detected by magic bytes.
+func newDecompressingReader(r io.Reader) (*bufio.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return bufio.NewReader(gz), nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return bufio.NewReader(zr.IOReadCloser()), nil
+	}
+	return br, nil
+}
@@ -15,10 +15,12 @@
 package cmd
 
 import (
+	"io/ioutil"
 	"log"
 	"strings"
 
 	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/ddl"
 	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
 	"github.com/spf13/cobra"
 )
@@ -27,12 +29,30 @@ const (
 	stringType    = "string" // HMS representation of string type
 	optColumns    = "columns"
 	optPartitions = "partitions"
+	optFile       = "file"
 )
 
 var tableCreateCmd = &cobra.Command{
 	Use:   "create",
 	Short: "Create Table",
 	Run:   createTable,
+	Long: `Create table with given columns and partition keys.
+Columns and partition keys are specified as a list of name=type pairs separated by comma.
+If type is omitted, string is assumed. Types are validated before the table is created.
+Table parameters are specified as a list of name=value pairs.
+
+Alternatively, tables can be created from a file with HiveQL CREATE TABLE statements
+specified with -f flag. Tables without database name are created in the database
+specified with -d flag.
+
+Examples:
+
+    hmstool table create -d default -t sales \
+        -C "id=bigint,price=decimal(10,2),tags=array<string>,info=struct<a:int,b:string>" \
+        -P "ds=date" owner=finance
+
+    hmstool table create -d default -f schema.hql
+`,
 }
 
 func createTable(cmd *cobra.Command, args []string) {
@@ -51,32 +71,77 @@ func createTable(cmd *cobra.Command, args []string) {
 	defer client.Close()
 
 	owner := getOwner()
+	if fileName, _ := cmd.Flags().GetString(optFile); fileName != "" {
+		createTablesFromFile(client, fileName, dbName, owner)
+		return
+	}
 	params := argsToParams(args)
 	columns, _ := cmd.Flags().GetString(optColumns)
 	partitions, _ := cmd.Flags().GetString(optPartitions)
 
-	table := hmsclient.NewTableBuilder(dbName, tableName).
+	tb := hmsclient.NewTableBuilder(dbName, tableName).
 		WithOwner(owner).
 		WithColumns(getSchema(columns)).
 		WithPartitionKeys(getSchema(partitions)).
-		WithParameters(params).
-		Build()
+		WithParameters(params)
+	if err = tb.Validate(); err != nil {
+		log.Fatalf("invalid schema for %s.%s: %v", dbName, tableName, err)
+	}
 
-	err = client.CreateTable(table)
+	err = client.CreateTable(tb.Build())
 
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
+// createTablesFromFile creates all tables defined by CREATE TABLE statements in the file.
+func createTablesFromFile(client *hmsclient.MetastoreClient, fileName string,
+	dbName string, owner string) {
+	script, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		log.Fatalf("failed to read %s: %v", fileName, err)
+	}
+	stmts, err := ddl.ParseScript(string(script))
+	if err != nil {
+		log.Fatalf("failed to parse %s: %v", fileName, err)
+	}
+	for _, stmt := range stmts {
+		tb := stmt.Table
+		if tb.Db == "" {
+			tb.Db = dbName
+		}
+		if tb.Db == "" {
+			log.Fatalf("missing database name for table %s", tb.Name)
+		}
+		if tb.Owner == "" {
+			tb.WithOwner(owner)
+		}
+		if err = tb.Validate(); err != nil {
+			log.Fatalf("invalid schema for %s.%s: %v", tb.Db, tb.Name, err)
+		}
+		log.Println("Creating table", tb.Db+"."+tb.Name)
+		err = client.CreateTable(tb.Build())
+		if _, ok := err.(*hive_metastore.AlreadyExistsException); ok && stmt.IfNotExists {
+			log.Println("skipping", tb.Db+"."+tb.Name, ": table exist already")
+			continue
+		}
+		if err != nil {
+			log.Fatalf("failed to create table %s.%s: %v", tb.Db, tb.Name, err)
+		}
+	}
+}
+
 // getSchema converts argument to list of field schemas.
 // Schema is represented as name=type,.... If type is missing, "string" is assumed.
+// Commas inside complex types like struct<a:int,b:string> or decimal(10,2) do not
+// separate fields.
 func getSchema(arg string) []hive_metastore.FieldSchema {
 	// First split on commas
 	if arg == "" {
 		return nil
 	}
-	fields := strings.Split(arg, ",")
+	fields := splitFields(arg)
 	if len(fields) == 0 {
 		return nil
 	}
@@ -84,7 +149,7 @@ func getSchema(arg string) []hive_metastore.FieldSchema {
 	for _, s := range fields {
 		name := s
 		typ := stringType
-		parts := strings.Split(s, "=")
+		parts := strings.SplitN(s, "=", 2)
 		if len(parts) == 2 {
 			name = parts[0]
 			typ = parts[1]
@@ -94,10 +159,33 @@ func getSchema(arg string) []hive_metastore.FieldSchema {
 	return schema
 }
 
+// splitFields splits string on commas which are not enclosed in <> or ().
+func splitFields(arg string) []string {
+	var fields []string
+	depth := 0
+	start := 0
+	for i, c := range arg {
+		switch c {
+		case '<', '(':
+			depth++
+		case '>', ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				fields = append(fields, arg[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(fields, arg[start:])
+}
+
 func init() {
 	tableCreateCmd.Flags().StringP(optColumns, "C", "",
-		"table columns separated by comma")
+		"table columns as name=type separated by comma")
 	tableCreateCmd.Flags().StringP(optPartitions, "P", "",
-		"table partitions separated by comma")
+		"table partition keys as name=type separated by comma")
+	tableCreateCmd.Flags().StringP(optFile, "f", "",
+		"file with CREATE TABLE statements")
 	tablesCmd.AddCommand(tableCreateCmd)
 }
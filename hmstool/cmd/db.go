@@ -34,8 +34,12 @@ var dbCmd = &cobra.Command{
 var dbDropCmd = &cobra.Command{
 	Use:   "drop",
 	Short: "drop database",
-	Long:  "drop database db1, ...",
-	Run:   dropDB,
+	Long: `drop database db1, ...
+
+Databases are dropped with all their tables and data. The list of databases is shown
+and databases are dropped after confirmation, use --yes to skip confirmation
+or --dry-run to only show them. The command fails when confirmation is refused.`,
+	Run: dropDB,
 }
 
 func dropDB(cmd *cobra.Command, args []string) {
@@ -46,17 +50,24 @@ func dropDB(cmd *cobra.Command, args []string) {
 	} else {
 		dbNames = args
 	}
+	var dropped []string
+	for _, dbName = range dbNames {
+		if dbName == "default" {
+			log.Println("skipping default database")
+			continue
+		}
+		dropped = append(dropped, dbName)
+	}
+	if len(dropped) == 0 || !confirmBulk(cmd, "drop", "database", dropped) {
+		return
+	}
 	client, err := getClient()
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer client.Close()
-	for _, dbName = range dbNames {
+	for _, dbName = range dropped {
 		log.Println("Dropping database", dbName)
-		if dbName == "default" {
-			log.Println("skipping default database")
-			continue
-		}
 		if err = client.DropDatabase(dbName, true, true); err != nil {
 			log.Println("failed to delete", dbName, err)
 		}
@@ -65,6 +76,7 @@ func dropDB(cmd *cobra.Command, args []string) {
 
 func init() {
 	dbCmd.PersistentFlags().StringP(optDbName, "d", "default", "database name")
+	addConfirmFlags(dbDropCmd)
 	dbCmd.AddCommand(dbDropCmd)
 	rootCmd.AddCommand(dbCmd)
 }
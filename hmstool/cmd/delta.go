@@ -0,0 +1,451 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+	"github.com/spf13/cobra"
+)
+
+const (
+	optSinceEvent = "since-event"
+
+	kindTombstone = "tombstone"
+
+	// Maximum number of events fetched at once
+	deltaEventBatch = 1000
+)
+
+// Tombstone marks an object dropped since the previous export.
+// Partitions are identified by their key values.
+type Tombstone struct {
+	Kind      string            `json:"kind"`
+	Database  string            `json:"database"`
+	Table     string            `json:"table,omitempty"`
+	Partition map[string]string `json:"partition,omitempty"`
+}
+
+func (t *Tombstone) String() string {
+	switch t.Kind {
+	case kindTable:
+		return t.Database + "." + t.Table
+	case kindPartition:
+		return t.Database + "." + t.Table + "/" + specName(t.Partition)
+	}
+	return t.Database
+}
+
+// deltaDatabase is the change of a single database
+type deltaDatabase struct {
+	dropped bool // Dropped at some point, tombstone precedes upsert
+	upsert  bool // Exists and was created or modified
+}
+
+// deltaPartition is the change of a single partition
+type deltaPartition struct {
+	spec    map[string]string
+	dropped bool
+}
+
+// deltaTable is the change of a single table and its partitions
+type deltaTable struct {
+	dropped    bool
+	upsert     bool
+	full       bool                       // Created or renamed, exported with all partitions
+	partitions map[string]*deltaPartition // Changed partitions, keyed by specName
+}
+
+// eventDelta collects objects changed by notification events. Each object keeps
+// only its latest state, current objects are fetched from HMS when the delta is exported.
+type eventDelta struct {
+	databases map[string]*deltaDatabase
+	tables    map[string]map[string]*deltaTable // db -> table -> change
+}
+
+func newEventDelta() *eventDelta {
+	return &eventDelta{
+		databases: make(map[string]*deltaDatabase),
+		tables:    make(map[string]map[string]*deltaTable),
+	}
+}
+
+func (d *eventDelta) database(dbName string) *deltaDatabase {
+	db, ok := d.databases[dbName]
+	if !ok {
+		db = new(deltaDatabase)
+		d.databases[dbName] = db
+	}
+	return db
+}
+
+func (d *eventDelta) table(dbName string, tableName string) *deltaTable {
+	tables, ok := d.tables[dbName]
+	if !ok {
+		tables = make(map[string]*deltaTable)
+		d.tables[dbName] = tables
+	}
+	t, ok := tables[tableName]
+	if !ok {
+		t = &deltaTable{partitions: make(map[string]*deltaPartition)}
+		tables[tableName] = t
+	}
+	return t
+}
+
+func (d *eventDelta) dropTable(dbName string, tableName string) {
+	t := d.table(dbName, tableName)
+	t.dropped = true
+	t.upsert = false
+	t.full = false
+	t.partitions = make(map[string]*deltaPartition)
+}
+
+// createTable records table which should be exported with all its partitions
+func (d *eventDelta) createTable(dbName string, tableName string) {
+	t := d.table(dbName, tableName)
+	t.upsert = true
+	t.full = true
+	t.partitions = make(map[string]*deltaPartition)
+}
+
+// add records changes made by the notification event
+func (d *eventDelta) add(event *hive_metastore.NotificationEvent) error {
+	dbName, tableName := event.GetDbName(), event.GetTableName()
+	switch event.EventType {
+	case eventCreateDatabase, eventAlterDatabase:
+		d.database(dbName).upsert = true
+	case eventDropDatabase:
+		db := d.database(dbName)
+		db.dropped = true
+		db.upsert = false
+		// Tables are dropped together with the database
+		delete(d.tables, dbName)
+	case eventCreateTable:
+		d.createTable(dbName, tableName)
+	case eventAlterTable:
+		message, err := decodeEventMessage(event)
+		if err != nil {
+			return err
+		}
+		before, after, err := message.renamed()
+		if err != nil {
+			return err
+		}
+		if after != nil {
+			// The event has the new name, so the old one comes from the table before rename
+			d.dropTable(before.DbName, before.TableName)
+			d.createTable(after.DbName, after.TableName)
+		} else {
+			d.table(dbName, tableName).upsert = true
+		}
+	case eventDropTable:
+		d.dropTable(dbName, tableName)
+	case eventAddPartition, eventAlterPartition, eventDropPartition:
+		t := d.table(dbName, tableName)
+		if t.full {
+			return nil
+		}
+		message, err := decodeEventMessage(event)
+		if err != nil {
+			return err
+		}
+		specs := message.Partitions
+		if message.KeyValues != nil {
+			specs = append(specs, message.KeyValues)
+		}
+		for _, spec := range specs {
+			t.partitions[specName(spec)] = &deltaPartition{
+				spec:    spec,
+				dropped: event.EventType == eventDropPartition,
+			}
+		}
+	}
+	return nil
+}
+
+func (d *eventDelta) databaseNames() []string {
+	names := make([]string, 0, len(d.databases))
+	for name := range d.databases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tableDbNames returns names of databases with changed tables
+func (d *eventDelta) tableDbNames() []string {
+	names := make([]string, 0, len(d.tables))
+	for name := range d.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func tableNames(tables map[string]*deltaTable) []string {
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (t *deltaTable) partitionNames() []string {
+	names := make([]string, 0, len(t.partitions))
+	for name := range t.partitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tombstones returns tombstones for all dropped objects
+func (d *eventDelta) tombstones() []*Tombstone {
+	var result []*Tombstone
+	for _, dbName := range d.databaseNames() {
+		if d.databases[dbName].dropped {
+			result = append(result, &Tombstone{Kind: kindDatabase, Database: dbName})
+		}
+	}
+	for _, dbName := range d.tableDbNames() {
+		tables := d.tables[dbName]
+		for _, tableName := range tableNames(tables) {
+			t := tables[tableName]
+			if t.dropped {
+				result = append(result, &Tombstone{Kind: kindTable, Database: dbName, Table: tableName})
+			}
+			for _, name := range t.partitionNames() {
+				if p := t.partitions[name]; p.dropped {
+					result = append(result, &Tombstone{Kind: kindPartition,
+						Database: dbName, Table: tableName, Partition: p.spec})
+				}
+			}
+		}
+	}
+	return result
+}
+
+// export writes tombstones followed by the current state of all changed objects.
+// Objects which no longer exist are skipped, they are dropped by later events.
+func (d *eventDelta) export(client exportSource, sink exportSink, filter *exportFilter) error {
+	for _, t := range d.tombstones() {
+		if t.Kind != kindDatabase && !filter.acceptName(t.Database, t.Table) {
+			continue
+		}
+		if t.Kind == kindPartition && filter != nil && filter.noPartitions {
+			continue
+		}
+		if err := sink.addTombstone(t); err != nil {
+			return err
+		}
+	}
+	for _, dbName := range d.databaseNames() {
+		if !d.databases[dbName].upsert {
+			continue
+		}
+		db, err := getOptionalDatabase(client, dbName)
+		if err != nil {
+			return fmt.Errorf("failed to get database %s: %v", dbName, err)
+		}
+		if db == nil {
+			continue
+		}
+		if err = sink.addDatabase(db); err != nil {
+			return err
+		}
+	}
+	for _, dbName := range d.tableDbNames() {
+		tables := d.tables[dbName]
+		for _, tableName := range tableNames(tables) {
+			if !filter.acceptName(dbName, tableName) {
+				continue
+			}
+			if err := d.exportTable(client, sink, dbName, tableName, tables[tableName], filter); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// exportTable exports changed table and its changed partitions
+func (d *eventDelta) exportTable(client exportSource, sink exportSink,
+	dbName string, tableName string, change *deltaTable, filter *exportFilter) error {
+	var specs []map[string]string
+	for _, name := range change.partitionNames() {
+		if p := change.partitions[name]; !p.dropped {
+			specs = append(specs, p.spec)
+		}
+	}
+	if filter != nil && filter.noPartitions {
+		specs = nil
+	}
+	if !change.upsert && len(specs) == 0 {
+		return nil
+	}
+	table, err := client.GetTable(dbName, tableName)
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get table %s.%s: %v", dbName, tableName, err)
+	}
+	if !filter.acceptType(table.TableType) {
+		return nil
+	}
+	if change.upsert {
+		if err = sink.addTable(table); err != nil {
+			return err
+		}
+	}
+	if change.full {
+		if filter != nil && filter.noPartitions {
+			return nil
+		}
+		return exportPartitions(client, sink, dbName, tableName, filter)
+	}
+	if len(specs) == 0 {
+		return nil
+	}
+	values, err := partitionValues(table.PartitionKeys, specs)
+	if err != nil {
+		return fmt.Errorf("table %s.%s: %v", dbName, tableName, err)
+	}
+	keys := make([]string, len(table.PartitionKeys))
+	for i, k := range table.PartitionKeys {
+		keys[i] = k.Name
+	}
+	names := make([]string, len(values))
+	for i, v := range values {
+		names[i] = hmsclient.MakePartName(keys, v)
+	}
+	for start := 0; start < len(names); start += maxParts {
+		end := start + maxParts
+		if end > len(names) {
+			end = len(names)
+		}
+		partitions, err := client.GetPartitionsByNames(dbName, tableName, names[start:end])
+		if err != nil {
+			return fmt.Errorf("failed to get partitions for %s: %s", tableName, err.Error())
+		}
+		if err = sink.addPartitions(partitions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readDelta reads notification events after sinceEventID up to and including
+// untilEventID and collects changed objects.
+func readDelta(client *hmsclient.MetastoreClient, sinceEventID int64, untilEventID int64) (*eventDelta, error) {
+	delta := newEventDelta()
+	for last := sinceEventID; last < untilEventID; {
+		events, err := client.GetNextNotification(last, deltaEventBatch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get notifications: %v", err)
+		}
+		if len(events) == 0 {
+			break
+		}
+		if events[0].EventId > last+1 {
+			return nil, fmt.Errorf("events %d-%d are no longer available, full export is needed",
+				last+1, events[0].EventId-1)
+		}
+		for _, event := range events {
+			if event.EventId > untilEventID {
+				return delta, nil
+			}
+			if err = delta.add(event); err != nil {
+				return nil, err
+			}
+			last = event.EventId
+		}
+	}
+	return delta, nil
+}
+
+// deltaExport exports objects changed since the given notification event
+func deltaExport(cmd *cobra.Command, _ []string) {
+	if !cmd.Flags().Changed(optSinceEvent) {
+		cmd.Help()
+		return
+	}
+	sinceEventID, _ := cmd.Flags().GetInt64(optSinceEvent)
+	if sinceEventID < 0 {
+		log.Fatalf("invalid --%s value %d", optSinceEvent, sinceEventID)
+	}
+	filter, err := newExportFilter(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if filter.partitionFilter != "" {
+		log.Fatalf("--%s can't be used with --%s", optPartitionFilter, optSinceEvent)
+	}
+	client, err := getClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+	output, err := newExportOutput(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if output.format == formatSQL {
+		log.Fatalf("--%s can't be used with sql format", optSinceEvent)
+	}
+	output.delta, output.sinceEventID = true, sinceEventID
+	if err = output.begin(client); err != nil {
+		log.Fatal(err)
+	}
+	if output.snapshot == nil {
+		log.Fatal("can't export delta without notification event ID")
+	}
+	// Objects are fetched after all events are read, so they reflect at least
+	// the state as of the last event.
+	delta, err := readDelta(client, sinceEventID, output.snapshot.BeforeEventID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = delta.export(client, output.sink, filter); err != nil {
+		log.Fatal(err)
+	}
+	if err = output.end(client); err != nil {
+		log.Fatal(err)
+	}
+	if err = output.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// specName returns canonical name of the partition spec with keys sorted by name
+func specName(spec map[string]string) string {
+	keys := make([]string, 0, len(spec))
+	for k := range spec {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + spec[k]
+	}
+	return strings.Join(parts, "/")
+}
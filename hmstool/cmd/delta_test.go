@@ -0,0 +1,209 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+)
+
+// GetPartitionNamesByFilter supports only filters of the form key="value"
+func (f *fakeCatalog) GetPartitionNamesByFilter(dbName string, tableName string,
+	filter string, maxCount int) ([]string, error) {
+	parts := strings.SplitN(filter, "=", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("filter %q is not supported", filter)
+	}
+	key, value := strings.TrimSpace(parts[0]), strings.Trim(strings.TrimSpace(parts[1]), `"`)
+	names, _ := f.GetPartitionNames(dbName, tableName, -1)
+	var result []string
+	for _, name := range names {
+		keys, values, _ := hmsclient.ParsePartName(name)
+		for i, k := range keys {
+			if k == key && values[i] == value {
+				result = append(result, name)
+			}
+		}
+	}
+	return result, nil
+}
+
+func deltaTestTable(name string, ds ...string) (*hive_metastore.Table, []*hive_metastore.Partition) {
+	table := &hive_metastore.Table{DbName: "sales", TableName: name,
+		PartitionKeys: []*hive_metastore.FieldSchema{{Name: "ds", Type: "string"}},
+		Sd:            &hive_metastore.StorageDescriptor{Location: "hdfs://old/sales/" + name}}
+	var partitions []*hive_metastore.Partition
+	for _, v := range ds {
+		partitions = append(partitions, &hive_metastore.Partition{DbName: "sales", TableName: name,
+			Values: []string{v},
+			Sd:     &hive_metastore.StorageDescriptor{Location: "hdfs://old/sales/" + name + "/ds=" + v}})
+	}
+	return table, partitions
+}
+
+func TestEventDelta(t *testing.T) {
+	// Source after the events
+	orders, ordersParts := deltaTestTable("orders", "2", "3", "4")
+	items, itemsParts := deltaTestTable("items", "1")
+	lines, linesParts := deltaTestTable("lines", "1", "2")
+	source := &fakeCatalog{
+		databases: map[string]*hmsclient.Database{"sales": {Name: "sales"}},
+		tables: map[string]map[string]*hive_metastore.Table{
+			"sales": {"orders": orders, "items": items, "lines": lines}},
+		partitions: map[string][]*hive_metastore.Partition{
+			"sales.orders": ordersParts, "sales.items": itemsParts, "sales.lines": linesParts},
+	}
+
+	sales := "sales"
+	event := func(id int64, eventType string, table string, message string) *hive_metastore.NotificationEvent {
+		return &hive_metastore.NotificationEvent{EventId: id, EventType: eventType,
+			DbName: &sales, TableName: &table, Message: message}
+	}
+	renamed := fmt.Sprintf(`{"tableObjBeforeJson":%q,"tableObjAfterJson":%q}`,
+		thriftJSON(t, &hive_metastore.Table{DbName: "sales", TableName: "line_items"}),
+		thriftJSON(t, &hive_metastore.Table{DbName: "sales", TableName: "lines"}))
+	old := "old"
+	events := []*hive_metastore.NotificationEvent{
+		event(1, eventAddPartition, "orders", `{"partitions":[{"ds":"4"}]}`),
+		event(2, eventDropPartition, "orders", `{"partitions":[{"ds":"1"}]}`),
+		event(3, eventCreateTable, "items", "{}"),
+		event(4, eventAddPartition, "items", `{"partitions":[{"ds":"1"}]}`),
+		event(5, eventAlterTable, "lines", renamed),
+		event(6, eventCreateTable, "tmp", "{}"),
+		event(7, eventDropTable, "tmp", "{}"),
+		{EventId: 8, EventType: eventDropDatabase, DbName: &old, Message: "{}"},
+	}
+	delta := newEventDelta()
+	for _, e := range events {
+		if err := delta.add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hms := &HmsObject{Snapshot: &SnapshotInfo{Delta: true, BeforeEventID: 8}}
+	if err := delta.export(source, hms, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var tombstones []string
+	for _, ts := range hms.Tombstones {
+		tombstones = append(tombstones, ts.Kind+" "+ts.String())
+	}
+	expected := []string{"database old", "table sales.line_items",
+		"partition sales.orders/ds=1", "table sales.tmp"}
+	if !reflect.DeepEqual(tombstones, expected) {
+		t.Errorf("expected tombstones %v, got %v", expected, tombstones)
+	}
+	var tables []string
+	for _, table := range hms.Tables {
+		tables = append(tables, table.TableName)
+	}
+	if !reflect.DeepEqual(tables, []string{"items", "lines"}) {
+		t.Errorf("unexpected tables %v", tables)
+	}
+	var partitions []string
+	for _, p := range hms.Partitions {
+		partitions = append(partitions, p.TableName+"/"+p.Values[0])
+	}
+	sort.Strings(partitions)
+	if !reflect.DeepEqual(partitions, []string{"items/1", "lines/1", "lines/2", "orders/4"}) {
+		t.Errorf("unexpected partitions %v", partitions)
+	}
+
+	// Apply delta on top of the previous state
+	target := newFakeTarget()
+	target.databases["sales"] = &hmsclient.Database{Name: "sales"}
+	target.databases["old"] = &hmsclient.Database{Name: "old"}
+	prevOrders, prevParts := deltaTestTable("orders", "1", "2", "3")
+	prevLines, prevLinesParts := deltaTestTable("line_items", "1", "2")
+	target.tables["sales.orders"] = prevOrders
+	target.tables["sales.line_items"] = prevLines
+	for _, p := range append(prevParts, prevLinesParts...) {
+		target.partitions[partitionKey(p)] = p
+	}
+	im := newTestImporter(t, target, filepath.Join(t.TempDir(), "delta"), conflictSkip)
+	if err := im.importObjects(hms); err != nil {
+		t.Fatal(err)
+	}
+	report := im.report
+	checkCounts(t, report, kindDatabase, map[string]int{resultDropped: 1})
+	checkCounts(t, report, kindTable, map[string]int{resultDropped: 1, resultSkipped: 1, resultCreated: 2})
+	checkCounts(t, report, kindPartition, map[string]int{resultDropped: 1, resultCreated: 4})
+	if report.failed() {
+		t.Errorf("unexpected failures\n%s", report)
+	}
+	var keys []string
+	for key := range target.partitions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	expected = []string{"sales.items/1", "sales.lines/1", "sales.lines/2",
+		"sales.orders/2", "sales.orders/3", "sales.orders/4"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected partitions %v, got %v", expected, keys)
+	}
+	if _, ok := target.databases["old"]; ok {
+		t.Error("database old should be dropped")
+	}
+}
+
+// fakeNotifications is notificationSource with fixed current event ID
+type fakeNotifications int64
+
+func (n fakeNotifications) GetCurrentNotificationId() (int64, error) {
+	return int64(n), nil
+}
+
+func TestStreamDelta(t *testing.T) {
+	var buf bytes.Buffer
+	output := &exportOutput{format: formatNDJSON, sink: newRecordWriter(&buf), delta: true, sinceEventID: 5}
+	if err := output.begin(fakeNotifications(8)); err != nil {
+		t.Fatal(err)
+	}
+	orders, ordersParts := deltaTestTable("orders", "1", "2")
+	orders.Sd.Location = "hdfs://new/sales/orders"
+	ordersParts[0].Sd.Location = "hdfs://new/sales/orders/ds=1"
+	output.sink.addTable(orders)
+	output.sink.addPartitions(ordersParts)
+	if err := output.end(fakeNotifications(8)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Existing table and partition are replaced by delta
+	target := newFakeTarget()
+	target.databases["sales"] = &hmsclient.Database{Name: "sales"}
+	prevOrders, prevParts := deltaTestTable("orders", "1")
+	target.tables["sales.orders"] = prevOrders
+	target.partitions[partitionKey(prevParts[0])] = prevParts[0]
+	im := newTestImporter(t, target, filepath.Join(t.TempDir(), "delta"), conflictSkip)
+	if err := im.importStream(&buf); err != nil {
+		t.Fatal(err)
+	}
+	checkCounts(t, im.report, kindTable, map[string]int{resultReplaced: 1})
+	checkCounts(t, im.report, kindPartition, map[string]int{resultReplaced: 1, resultCreated: 1})
+	if location := target.tables["sales.orders"].Sd.Location; location != "hdfs://new/sales/orders" {
+		t.Errorf("table is not replaced, location %s", location)
+	}
+	if p := target.partitions["sales.orders/1"]; p.Sd.Location != "hdfs://new/sales/orders/ds=1" {
+		t.Errorf("partition is not replaced, location %s", p.Sd.Location)
+	}
+}
@@ -14,7 +14,18 @@
 
 package cmd
 
-import "github.com/spf13/cobra"
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+	"github.com/spf13/cobra"
+)
 
 // dbCmd represents the db command
 var describeCmd = &cobra.Command{
@@ -33,12 +44,261 @@ var describeDbCmd = &cobra.Command{
 var describeTableCmd = &cobra.Command{
 	Use:   "table",
 	Short: "describe table",
-	Run:   showTables,
+	Run:   describeTable,
+	Long: `Describe tables in the same way as Hive DESCRIBE FORMATTED does.
+
+The output includes columns, partition keys, detailed table information,
+storage information and the number of partitions. Use --format to get the
+table in other formats, for example json.
+
+Example:
+
+    hmstool describe table default.customers
+`,
+}
+
+var describePartitionCmd = &cobra.Command{
+	Use:     "partition",
+	Aliases: []string{"part"},
+	Short:   "describe partition",
+	Run:     describePartition,
+	Long: `Describe partitions in the same way as Hive DESCRIBE FORMATTED does.
+The first argument is the table name, followed by partition names.
+
+Example:
+
+    hmstool describe partition default.web_logs ds=2018-10-01/hr=12
+`,
+}
+
+func describeTable(cmd *cobra.Command, args []string) {
+	client, err := getClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+
+	tables := make([]*hive_metastore.Table, 0, len(args))
+	var text []string
+	for _, arg := range args {
+		dbName, tableName := getDbTableName(cmd, arg)
+		table, err := client.GetTable(dbName, tableName)
+		if err != nil {
+			log.Fatalf("failed to get table information for %s.%s: %v",
+				dbName, tableName, err)
+		}
+		partitionCount := -1
+		if len(table.PartitionKeys) != 0 {
+			names, err := client.GetPartitionNames(dbName, tableName, -1)
+			if err != nil {
+				log.Fatalf("failed to get partitions for %s.%s: %v", dbName, tableName, err)
+			}
+			partitionCount = len(names)
+		}
+		tables = append(tables, table)
+		text = append(text, renderDescribeTable(table, partitionCount))
+	}
+	data := objectData(&HmsObject{Tables: tables})
+	data.text = func() string { return strings.Join(text, "\n") }
+	if err = display(cmd, data, formatText); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func describePartition(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		log.Fatal("table name and partition names should be specified")
+	}
+	client, err := getClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+
+	dbName, tableName := getDbTableName(cmd, args[0])
+	table, err := client.GetTable(dbName, tableName)
+	if err != nil {
+		log.Fatalf("failed to get table information for %s.%s: %v",
+			dbName, tableName, err)
+	}
+	partitions := make([]*hive_metastore.Partition, 0, len(args)-1)
+	var text []string
+	for _, name := range args[1:] {
+		partition, err := client.GetPartitionByName(dbName, tableName, name)
+		if err != nil {
+			log.Fatalf("can not get partition %s: %v", name, err)
+		}
+		partitions = append(partitions, partition)
+		text = append(text, renderDescribePartition(table, partition))
+	}
+	data := objectData(&HmsObject{Partitions: partitions})
+	data.text = func() string { return strings.Join(text, "\n") }
+	if err = display(cmd, data, formatText); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// describeWriter formats DESCRIBE FORMATTED output
+type describeWriter struct {
+	buf bytes.Buffer
+	w   *tabwriter.Writer
+}
+
+func newDescribeWriter() *describeWriter {
+	d := new(describeWriter)
+	d.w = tabwriter.NewWriter(&d.buf, 0, 0, 2, ' ', 0)
+	return d
+}
+
+// section starts a new section with the given title
+func (d *describeWriter) section(title string) {
+	d.w.Flush()
+	if d.buf.Len() != 0 {
+		d.buf.WriteString("\n")
+	}
+	d.buf.WriteString("# " + title + "\n")
+}
+
+func (d *describeWriter) row(values ...string) {
+	fmt.Fprintln(d.w, strings.Join(values, "\t"))
+}
+
+func (d *describeWriter) columns(cols []*hive_metastore.FieldSchema) {
+	d.row("# col_name", "data_type", "comment")
+	for _, c := range cols {
+		d.row(c.Name, c.Type, c.Comment)
+	}
+}
+
+// parameters writes parameters sorted by name
+func (d *describeWriter) parameters(title string, params map[string]string) {
+	if len(params) == 0 {
+		return
+	}
+	d.row(title)
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		d.row("", k, params[k])
+	}
+}
+
+// storage writes storage descriptor information
+func (d *describeWriter) storage(sd *hive_metastore.StorageDescriptor) {
+	d.section("Storage Information")
+	if sd == nil {
+		return
+	}
+	if sd.SerdeInfo != nil {
+		d.row("SerDe Library:", sd.SerdeInfo.SerializationLib)
+	}
+	d.row("InputFormat:", sd.InputFormat)
+	d.row("OutputFormat:", sd.OutputFormat)
+	compressed := "No"
+	if sd.Compressed {
+		compressed = "Yes"
+	}
+	d.row("Compressed:", compressed)
+	d.row("Num Buckets:", fmt.Sprint(sd.NumBuckets))
+	d.row("Bucket Columns:", "["+strings.Join(sd.BucketCols, ", ")+"]")
+	sortCols := make([]string, len(sd.SortCols))
+	for i, o := range sd.SortCols {
+		order := "ASC"
+		if o.Order == 0 {
+			order = "DESC"
+		}
+		sortCols[i] = o.Col + " " + order
+	}
+	d.row("Sort Columns:", "["+strings.Join(sortCols, ", ")+"]")
+	if sd.SerdeInfo != nil {
+		d.parameters("Storage Desc Params:", sd.SerdeInfo.Parameters)
+	}
+}
+
+func (d *describeWriter) String() string {
+	d.w.Flush()
+	return d.buf.String()
+}
+
+// renderDescribeTable returns DESCRIBE FORMATTED representation of the table.
+// Negative partitionCount means that the table is not partitioned.
+func renderDescribeTable(table *hive_metastore.Table, partitionCount int) string {
+	d := newDescribeWriter()
+	d.section("Columns")
+	var cols []*hive_metastore.FieldSchema
+	if table.Sd != nil {
+		cols = table.Sd.Cols
+	}
+	d.columns(cols)
+	if len(table.PartitionKeys) != 0 {
+		d.section("Partition Information")
+		d.columns(table.PartitionKeys)
+	}
+
+	d.section("Detailed Table Information")
+	d.row("Database:", table.DbName)
+	d.row("Table:", table.TableName)
+	d.row("Owner:", table.Owner)
+	d.row("CreateTime:", describeTime(table.CreateTime))
+	d.row("LastAccessTime:", describeTime(table.LastAccessTime))
+	d.row("Retention:", fmt.Sprint(table.Retention))
+	d.row("Location:", sdLocation(table.Sd))
+	d.row("Table Type:", table.TableType)
+	if partitionCount >= 0 {
+		d.row("Partitions:", fmt.Sprint(partitionCount))
+	}
+	d.parameters("Table Parameters:", table.Parameters)
+
+	if table.TableType == hmsclient.TableTypeView.String() {
+		d.section("View Information")
+		d.row("View Original Text:", table.GetViewOriginalText())
+		d.row("View Expanded Text:", table.GetViewExpandedText())
+		return d.String()
+	}
+	d.storage(table.Sd)
+	return d.String()
+}
+
+// renderDescribePartition returns DESCRIBE FORMATTED representation of the partition
+func renderDescribePartition(table *hive_metastore.Table, partition *hive_metastore.Partition) string {
+	d := newDescribeWriter()
+	d.section("Columns")
+	var cols []*hive_metastore.FieldSchema
+	if partition.Sd != nil {
+		cols = partition.Sd.Cols
+	}
+	d.columns(cols)
+	d.section("Partition Information")
+	d.columns(table.PartitionKeys)
+
+	d.section("Detailed Partition Information")
+	d.row("Partition Value:", "["+strings.Join(partition.Values, ", ")+"]")
+	d.row("Database:", partition.DbName)
+	d.row("Table:", partition.TableName)
+	d.row("CreateTime:", describeTime(partition.CreateTime))
+	d.row("LastAccessTime:", describeTime(partition.LastAccessTime))
+	d.row("Location:", sdLocation(partition.Sd))
+	d.parameters("Partition Parameters:", partition.Parameters)
+	d.storage(partition.Sd)
+	return d.String()
+}
+
+// describeTime formats HMS timestamp like other commands, unknown time is
+// shown as UNKNOWN the way Hive does.
+func describeTime(seconds int32) string {
+	if seconds == 0 {
+		return "UNKNOWN"
+	}
+	return formatTime(seconds)
 }
 
 func init() {
 	describeCmd.PersistentFlags().StringP(optDbName, "d", "default", "database name")
 	describeCmd.AddCommand(describeDbCmd)
 	describeCmd.AddCommand(describeTableCmd)
+	describeCmd.AddCommand(describePartitionCmd)
 	rootCmd.AddCommand(describeCmd)
 }
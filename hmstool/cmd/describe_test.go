@@ -0,0 +1,76 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+)
+
+func TestRenderDescribeTable(t *testing.T) {
+	table := &hive_metastore.Table{DbName: "sales", TableName: "orders", Owner: "hive",
+		CreateTime: 1538352000, TableType: "EXTERNAL_TABLE",
+		PartitionKeys: []*hive_metastore.FieldSchema{{Name: "ds", Type: "string", Comment: "date"}},
+		Parameters:    map[string]string{"numFiles": "3", "EXTERNAL": "TRUE"},
+		Sd: &hive_metastore.StorageDescriptor{
+			Cols: []*hive_metastore.FieldSchema{
+				{Name: "id", Type: "bigint", Comment: "order id"},
+				{Name: "amount", Type: "decimal(10,2)"},
+			},
+			Location:     "hdfs://nn/sales/orders",
+			InputFormat:  "org.apache.hadoop.hive.ql.io.orc.OrcInputFormat",
+			OutputFormat: "org.apache.hadoop.hive.ql.io.orc.OrcOutputFormat",
+			NumBuckets:   4,
+			BucketCols:   []string{"id"},
+			SortCols:     []*hive_metastore.Order{{Col: "id", Order: 1}},
+			SerdeInfo: &hive_metastore.SerDeInfo{
+				SerializationLib: "org.apache.hadoop.hive.ql.io.orc.OrcSerde",
+				Parameters:       map[string]string{"serialization.format": "1"},
+			},
+		},
+	}
+	text := renderDescribeTable(table, 12)
+	expected := []string{
+		"# Columns\n# col_name  data_type      comment\nid          bigint         order id\n" +
+			"amount      decimal(10,2)  \n",
+		"# Partition Information\n# col_name  data_type  comment\nds          string     date\n",
+		"CreateTime:      2018-10-01T00:00:00Z",
+		"LastAccessTime:  UNKNOWN",
+		"Partitions:      12",
+		"Table Parameters:\n  EXTERNAL  TRUE\n  numFiles  3\n",
+		"SerDe Library:   org.apache.hadoop.hive.ql.io.orc.OrcSerde",
+		"Num Buckets:     4",
+		"Bucket Columns:  [id]",
+		"Sort Columns:    [id ASC]",
+		"Storage Desc Params:\n  serialization.format  1\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(text, e) {
+			t.Errorf("missing %q in\n%s", e, text)
+		}
+	}
+
+	partition := &hive_metastore.Partition{DbName: "sales", TableName: "orders",
+		Values: []string{"2018-10-01"}, Sd: table.Sd}
+	text = renderDescribePartition(table, partition)
+	for _, e := range []string{"# Detailed Partition Information", "Partition Value:  [2018-10-01]",
+		"Location:         hdfs://nn/sales/orders"} {
+		if !strings.Contains(text, e) {
+			t.Errorf("missing %q in\n%s", e, text)
+		}
+	}
+}
@@ -0,0 +1,482 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	optSource      = "source"
+	optTarget      = "target"
+	optIgnoreParam = "ignore-param"
+
+	formatText = "text"
+
+	changeAdded   = "added"
+	changeRemoved = "removed"
+	changeChanged = "changed"
+
+	kindPartition = "partition"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "compare two metastores",
+	Run:   diffMetastores,
+	Long: `Compare databases, tables and partitions of two metastores.
+
+Objects which only exist in the target are reported as added, objects which
+only exist in the source are reported as removed. For objects present in both
+metastores the tool compares table schema, SerDe, storage formats, locations
+and parameters.
+
+Source and target are specified as host or host:port. When port is not
+specified, the value of --port is used.
+
+Locations in the source can be rewritten before comparing with
+--rewrite-location old=new. The flag can be repeated, the longest matching
+prefix is used.
+
+Examples:
+
+    hmstool diff --source old-hms --target new-hms:9083 -d sales
+    hmstool diff --source old-hms --target new-hms \
+        --rewrite-location hdfs://old-nn:8020=hdfs://new-nn:8020 --format json
+`,
+}
+
+// diffEntry describes single difference between source and target metastore
+type diffEntry struct {
+	Change  string   `json:"change"`
+	Kind    string   `json:"kind"`
+	Name    string   `json:"name"`
+	Details []string `json:"details,omitempty"`
+}
+
+// metastoreReader provides read access to metastore objects needed for comparison.
+type metastoreReader interface {
+	catalogReader
+	GetAllDatabases() ([]string, error)
+	GetPartitionNames(dbName string, tableName string, max int) ([]string, error)
+	GetPartitionsByNames(dbName string, tableName string,
+		partNames []string) ([]*hive_metastore.Partition, error)
+}
+
+// metastoreDiff compares source and target metastores
+type metastoreDiff struct {
+	source       metastoreReader
+	target       metastoreReader
+	ignoreParams map[string]bool
+	rewriter     locationRewriter
+	entries      []*diffEntry
+}
+
+func diffMetastores(cmd *cobra.Command, _ []string) {
+	sourceHost, _ := cmd.Flags().GetString(optSource)
+	targetHost, _ := cmd.Flags().GetString(optTarget)
+	if sourceHost == "" || targetHost == "" {
+		log.Fatal("both --source and --target should be specified")
+	}
+	rewrites, _ := cmd.Flags().GetStringArray(optRewriteLocation)
+	rewriter, err := newLocationRewriter(rewrites)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ignored, _ := cmd.Flags().GetStringSlice(optIgnoreParam)
+
+	source, err := hmsclient.Open(sourceHost, viper.GetInt(portOpt))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer source.Close()
+	target, err := hmsclient.Open(targetHost, viper.GetInt(portOpt))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer target.Close()
+
+	d := &metastoreDiff{
+		source:       source,
+		target:       target,
+		ignoreParams: make(map[string]bool),
+		rewriter:     rewriter,
+	}
+	for _, p := range ignored {
+		d.ignoreParams[p] = true
+	}
+
+	var dbNames []string
+	if dbName, _ := cmd.Flags().GetString(optDbName); dbName != "" {
+		dbNames = []string{dbName}
+	}
+	if err = d.compare(dbNames); err != nil {
+		log.Fatal(err)
+	}
+
+	items := make([]interface{}, len(d.entries))
+	for i, e := range d.entries {
+		items[i] = e
+	}
+	entries := d.entries
+	if entries == nil {
+		entries = []*diffEntry{}
+	}
+	data := &displayData{
+		object:   entries,
+		sections: []displaySection{{items: items, columns: diffEntryColumns}},
+		text:     func() string { return formatDiff(d.entries) },
+	}
+	if err = display(cmd, data, formatText); err != nil {
+		log.Fatal(err)
+	}
+}
+
+var diffEntryColumns = []column{
+	{"CHANGE", func(item interface{}) string { return item.(*diffEntry).Change }},
+	{"KIND", func(item interface{}) string { return item.(*diffEntry).Kind }},
+	{"NAME", func(item interface{}) string { return item.(*diffEntry).Name }},
+	{"DETAILS", func(item interface{}) string { return strings.Join(item.(*diffEntry).Details, "; ") }},
+}
+
+// formatDiff returns human-readable representation of differences
+func formatDiff(entries []*diffEntry) string {
+	if len(entries) == 0 {
+		return "No differences\n"
+	}
+	symbols := map[string]string{changeAdded: "+", changeRemoved: "-", changeChanged: "~"}
+	counts := make(map[string]int)
+	var buf bytes.Buffer
+	for _, e := range entries {
+		counts[e.Change]++
+		fmt.Fprintf(&buf, "%s %s %s\n", symbols[e.Change], e.Kind, e.Name)
+		for _, d := range e.Details {
+			fmt.Fprintf(&buf, "    %s\n", d)
+		}
+	}
+	fmt.Fprintf(&buf, "\n%d added, %d removed, %d changed\n",
+		counts[changeAdded], counts[changeRemoved], counts[changeChanged])
+	return buf.String()
+}
+
+func (d *metastoreDiff) add(change string, kind string, name string, details []string) {
+	d.entries = append(d.entries,
+		&diffEntry{Change: change, Kind: kind, Name: name, Details: details})
+}
+
+// compare compares given databases or all databases if dbNames is empty.
+func (d *metastoreDiff) compare(dbNames []string) error {
+	var sourceDbs, targetDbs []string
+	if len(dbNames) != 0 {
+		sourceDbs, targetDbs = dbNames, dbNames
+	} else {
+		var err error
+		if sourceDbs, err = d.source.GetAllDatabases(); err != nil {
+			return fmt.Errorf("failed to get source databases: %v", err)
+		}
+		if targetDbs, err = d.target.GetAllDatabases(); err != nil {
+			return fmt.Errorf("failed to get target databases: %v", err)
+		}
+	}
+	for _, name := range mergeNames(sourceDbs, targetDbs) {
+		if err := d.compareDatabase(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *metastoreDiff) compareDatabase(dbName string) error {
+	sourceDb, err := getOptionalDatabase(d.source, dbName)
+	if err != nil {
+		return err
+	}
+	targetDb, err := getOptionalDatabase(d.target, dbName)
+	if err != nil {
+		return err
+	}
+	switch {
+	case sourceDb == nil && targetDb == nil:
+		return fmt.Errorf("database %s doesn't exist", dbName)
+	case sourceDb == nil:
+		d.add(changeAdded, kindDatabase, dbName, nil)
+		return nil
+	case targetDb == nil:
+		d.add(changeRemoved, kindDatabase, dbName, nil)
+		return nil
+	}
+
+	var details []string
+	if sourceDb.Description != targetDb.Description {
+		details = append(details, fmt.Sprintf("description: %q -> %q",
+			sourceDb.Description, targetDb.Description))
+	}
+	if location := d.rewriter.Rewrite(sourceDb.Location); location != targetDb.Location {
+		details = append(details, fmt.Sprintf("location: %q -> %q", location, targetDb.Location))
+	}
+	details = append(details, d.diffParameters(sourceDb.Parameters, targetDb.Parameters)...)
+	if len(details) != 0 {
+		d.add(changeChanged, kindDatabase, dbName, details)
+	}
+
+	sourceTables, err := d.source.GetAllTables(dbName)
+	if err != nil {
+		return fmt.Errorf("failed to get source tables for %s: %v", dbName, err)
+	}
+	targetTables, err := d.target.GetAllTables(dbName)
+	if err != nil {
+		return fmt.Errorf("failed to get target tables for %s: %v", dbName, err)
+	}
+	sourceSet := stringSet(sourceTables)
+	targetSet := stringSet(targetTables)
+	for _, tableName := range mergeNames(sourceTables, targetTables) {
+		fullName := dbName + "." + tableName
+		switch {
+		case !sourceSet[tableName]:
+			d.add(changeAdded, kindTable, fullName, nil)
+		case !targetSet[tableName]:
+			d.add(changeRemoved, kindTable, fullName, nil)
+		default:
+			if err = d.compareTable(dbName, tableName); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *metastoreDiff) compareTable(dbName string, tableName string) error {
+	fullName := dbName + "." + tableName
+	source, err := d.source.GetTable(dbName, tableName)
+	if err != nil {
+		return fmt.Errorf("failed to get source table %s: %v", fullName, err)
+	}
+	target, err := d.target.GetTable(dbName, tableName)
+	if err != nil {
+		return fmt.Errorf("failed to get target table %s: %v", fullName, err)
+	}
+	if details := d.diffTables(source, target); len(details) != 0 {
+		d.add(changeChanged, kindTable, fullName, details)
+	}
+	if len(source.PartitionKeys) == 0 || !sameSchema(source.PartitionKeys, target.PartitionKeys) {
+		return nil
+	}
+	return d.comparePartitions(source)
+}
+
+// diffTables returns list of differences between two tables
+func (d *metastoreDiff) diffTables(source *hive_metastore.Table, target *hive_metastore.Table) []string {
+	var details []string
+	if source.TableType != target.TableType {
+		details = append(details, fmt.Sprintf("type: %s -> %s", source.TableType, target.TableType))
+	}
+	if !sameSchema(source.PartitionKeys, target.PartitionKeys) {
+		details = append(details, fmt.Sprintf("partition keys: %s -> %s",
+			schemaString(source.PartitionKeys), schemaString(target.PartitionKeys)))
+	}
+	if source.ViewExpandedText != target.ViewExpandedText {
+		details = append(details, "view text changed")
+	}
+	details = append(details, d.diffStorage(source.Sd, target.Sd)...)
+	return append(details, d.diffParameters(source.Parameters, target.Parameters)...)
+}
+
+// diffStorage returns list of differences between storage descriptors
+func (d *metastoreDiff) diffStorage(source *hive_metastore.StorageDescriptor,
+	target *hive_metastore.StorageDescriptor) []string {
+	if source == nil {
+		source = &hive_metastore.StorageDescriptor{}
+	}
+	if target == nil {
+		target = &hive_metastore.StorageDescriptor{}
+	}
+	details := diffColumns(source.Cols, target.Cols)
+	if location := d.rewriter.Rewrite(source.Location); location != target.Location {
+		details = append(details, fmt.Sprintf("location: %q -> %q", location, target.Location))
+	}
+	if source.InputFormat != target.InputFormat {
+		details = append(details, fmt.Sprintf("input format: %s -> %s",
+			source.InputFormat, target.InputFormat))
+	}
+	if source.OutputFormat != target.OutputFormat {
+		details = append(details, fmt.Sprintf("output format: %s -> %s",
+			source.OutputFormat, target.OutputFormat))
+	}
+	sourceSerde := source.SerdeInfo.GetSerializationLib()
+	if targetSerde := target.SerdeInfo.GetSerializationLib(); sourceSerde != targetSerde {
+		details = append(details, fmt.Sprintf("serde: %s -> %s", sourceSerde, targetSerde))
+	}
+	for _, p := range d.diffParameters(source.SerdeInfo.GetParameters(), target.SerdeInfo.GetParameters()) {
+		details = append(details, "serde "+p)
+	}
+	if source.NumBuckets != target.NumBuckets {
+		details = append(details, fmt.Sprintf("buckets: %d -> %d", source.NumBuckets, target.NumBuckets))
+	}
+	return details
+}
+
+// diffParameters returns differences between two parameter sets, skipping ignored parameters
+func (d *metastoreDiff) diffParameters(source map[string]string, target map[string]string) []string {
+	var keys []string
+	for k := range source {
+		keys = append(keys, k)
+	}
+	for k := range target {
+		keys = append(keys, k)
+	}
+	var details []string
+	for _, k := range mergeNames(keys, nil) {
+		if d.ignoreParams[k] {
+			continue
+		}
+		sourceValue, inSource := source[k]
+		targetValue, inTarget := target[k]
+		switch {
+		case !inSource:
+			details = append(details, fmt.Sprintf("parameter %s: added %q", k, targetValue))
+		case !inTarget:
+			details = append(details, fmt.Sprintf("parameter %s: removed %q", k, sourceValue))
+		case sourceValue != targetValue:
+			details = append(details, fmt.Sprintf("parameter %s: %q -> %q", k, sourceValue, targetValue))
+		}
+	}
+	return details
+}
+
+// comparePartitions compares partition sets of two tables. Partitions present in both
+// tables are compared by location and parameters.
+func (d *metastoreDiff) comparePartitions(table *hive_metastore.Table) error {
+	dbName, tableName := table.DbName, table.TableName
+	fullName := dbName + "." + tableName
+	keys := make([]string, len(table.PartitionKeys))
+	for i, k := range table.PartitionKeys {
+		keys[i] = k.Name
+	}
+	sourceNames, err := d.source.GetPartitionNames(dbName, tableName, -1)
+	if err != nil {
+		return fmt.Errorf("failed to get source partitions for %s: %v", fullName, err)
+	}
+	targetNames, err := d.target.GetPartitionNames(dbName, tableName, -1)
+	if err != nil {
+		return fmt.Errorf("failed to get target partitions for %s: %v", fullName, err)
+	}
+	sourceSet := stringSet(sourceNames)
+	targetSet := stringSet(targetNames)
+	var common []string
+	for _, name := range mergeNames(sourceNames, targetNames) {
+		switch {
+		case !sourceSet[name]:
+			d.add(changeAdded, kindPartition, fullName+"/"+name, nil)
+		case !targetSet[name]:
+			d.add(changeRemoved, kindPartition, fullName+"/"+name, nil)
+		default:
+			common = append(common, name)
+		}
+	}
+
+	for start := 0; start < len(common); start += maxParts {
+		end := start + maxParts
+		if end > len(common) {
+			end = len(common)
+		}
+		batch := common[start:end]
+		sourceParts, err := d.source.GetPartitionsByNames(dbName, tableName, batch)
+		if err != nil {
+			return fmt.Errorf("failed to get source partitions for %s: %v", fullName, err)
+		}
+		targetParts, err := d.target.GetPartitionsByNames(dbName, tableName, batch)
+		if err != nil {
+			return fmt.Errorf("failed to get target partitions for %s: %v", fullName, err)
+		}
+		targetByValues := make(map[string]*hive_metastore.Partition, len(targetParts))
+		for _, p := range targetParts {
+			targetByValues[strings.Join(p.Values, "\x00")] = p
+		}
+		for _, sp := range sourceParts {
+			tp := targetByValues[strings.Join(sp.Values, "\x00")]
+			if tp == nil {
+				continue
+			}
+			var details []string
+			sourceLocation := d.rewriter.Rewrite(sp.GetSd().GetLocation())
+			if targetLocation := tp.GetSd().GetLocation(); sourceLocation != targetLocation {
+				details = append(details, fmt.Sprintf("location: %q -> %q", sourceLocation, targetLocation))
+			}
+			details = append(details, d.diffParameters(sp.Parameters, tp.Parameters)...)
+			if len(details) != 0 {
+				name := fullName + "/" + hmsclient.MakePartName(keys, sp.Values)
+				d.add(changeChanged, kindPartition, name, details)
+			}
+		}
+	}
+	return nil
+}
+
+// getOptionalDatabase returns database or nil if it doesn't exist
+func getOptionalDatabase(reader catalogReader, dbName string) (*hmsclient.Database, error) {
+	db, err := reader.GetDatabase(dbName)
+	if err != nil {
+		if _, ok := err.(*hive_metastore.NoSuchObjectException); ok {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get database %s: %v", dbName, err)
+	}
+	return db, nil
+}
+
+// mergeNames returns sorted union of two lists of names
+func mergeNames(a []string, b []string) []string {
+	set := stringSet(a)
+	for _, name := range b {
+		set[name] = true
+	}
+	result := make([]string, 0, len(set))
+	for name := range set {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func stringSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
+
+// ensure that MetastoreClient can be used for comparison
+var _ metastoreReader = (*hmsclient.MetastoreClient)(nil)
+
+func init() {
+	diffCmd.Flags().String(optSource, "", "source metastore host[:port]")
+	diffCmd.Flags().String(optTarget, "", "target metastore host[:port]")
+	diffCmd.Flags().StringP(optDbName, "d", "", "database name")
+	diffCmd.Flags().StringSlice(optIgnoreParam, []string{"transient_lastDdlTime"},
+		"parameters to ignore when comparing")
+	diffCmd.Flags().StringArray(optRewriteLocation, nil,
+		"rewrite source location prefix before comparing, as old=new")
+	rootCmd.AddCommand(diffCmd)
+}
@@ -0,0 +1,149 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+)
+
+func (f *fakeCatalog) GetAllDatabases() ([]string, error) {
+	var names []string
+	for name := range f.databases {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (f *fakeCatalog) GetPartitionNames(dbName string, tableName string, max int) ([]string, error) {
+	table := f.tables[dbName][tableName]
+	var keys []string
+	for _, k := range table.PartitionKeys {
+		keys = append(keys, k.Name)
+	}
+	var names []string
+	for _, p := range f.partitions[dbName+"."+tableName] {
+		names = append(names, hmsclient.MakePartName(keys, p.Values))
+	}
+	return names, nil
+}
+
+func (f *fakeCatalog) GetPartitionsByNames(dbName string, tableName string,
+	partNames []string) ([]*hive_metastore.Partition, error) {
+	all, _ := f.GetPartitionNames(dbName, tableName, -1)
+	wanted := stringSet(partNames)
+	var result []*hive_metastore.Partition
+	for i, name := range all {
+		if wanted[name] {
+			result = append(result, f.partitions[dbName+"."+tableName][i])
+		}
+	}
+	return result, nil
+}
+
+func TestLocationRewriter(t *testing.T) {
+	rewriter, err := newLocationRewriter([]string{
+		"hdfs://old:8020=hdfs://new:8020",
+		"hdfs://old:8020/warehouse=s3a://bucket/warehouse",
+		"/data=/new",
+		"/tmp/=/scratch/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"hdfs://old:8020/data/t":           "hdfs://new:8020/data/t",
+		"hdfs://old:8020/warehouse/a.db":   "s3a://bucket/warehouse/a.db",
+		"hdfs://other:8020/warehouse/a.db": "hdfs://other:8020/warehouse/a.db",
+		"hdfs://old:80201/data":            "hdfs://old:80201/data",
+		"/data":                            "/new",
+		"/data/x":                          "/new/x",
+		"/database/x":                      "/database/x",
+		"/tmp/x":                           "/scratch/x",
+	}
+	for location, expected := range tests {
+		if got := rewriter.Rewrite(location); got != expected {
+			t.Errorf("%s: expected %s, got %s", location, expected, got)
+		}
+	}
+	if _, rewritten := rewriter.rewrite("/data2/t"); rewritten {
+		t.Error("location without matching prefix should not be rewritten")
+	}
+	if _, err = newLocationRewriter([]string{"/data"}); err == nil {
+		t.Error("invalid rule should be rejected")
+	}
+}
+
+func diffTestCatalog(location string, ddlTime string, cols ...string) *fakeCatalog {
+	var columns []hive_metastore.FieldSchema
+	for _, c := range cols {
+		columns = append(columns, hive_metastore.FieldSchema{Name: c, Type: "int"})
+	}
+	table := hmsclient.NewTableBuilder("sales", "orders").
+		WithLocation(location+"/orders").
+		WithParameter("transient_lastDdlTime", ddlTime).
+		WithColumns(columns).
+		WithPartitionKeys([]hive_metastore.FieldSchema{{Name: "ds", Type: "string"}}).
+		Build()
+	f := &fakeCatalog{
+		databases: map[string]*hmsclient.Database{
+			"sales": {Name: "sales", Location: location},
+		},
+		tables:     map[string]map[string]*hive_metastore.Table{"sales": {"orders": table}},
+		partitions: make(map[string][]*hive_metastore.Partition),
+	}
+	return f
+}
+
+func TestMetastoreDiff(t *testing.T) {
+	source := diffTestCatalog("hdfs://old:8020/sales", "1", "id")
+	target := diffTestCatalog("hdfs://new:8020/sales", "2", "id", "price")
+	source.databases["legacy"] = &hmsclient.Database{Name: "legacy"}
+	for _, ds := range []string{"2018-10-01", "2018-10-02"} {
+		source.partitions["sales.orders"] = append(source.partitions["sales.orders"],
+			&hive_metastore.Partition{Values: []string{ds},
+				Sd: &hive_metastore.StorageDescriptor{Location: "hdfs://old:8020/sales/orders/ds=" + ds}})
+	}
+	target.partitions["sales.orders"] = []*hive_metastore.Partition{
+		{Values: []string{"2018-10-02"}, Sd: &hive_metastore.StorageDescriptor{Location: "/moved"}},
+		{Values: []string{"2018-10-03"}},
+	}
+
+	rewriter, _ := newLocationRewriter([]string{"hdfs://old:8020=hdfs://new:8020"})
+	d := &metastoreDiff{
+		source:       source,
+		target:       target,
+		ignoreParams: map[string]bool{"transient_lastDdlTime": true},
+		rewriter:     rewriter,
+	}
+	if err := d.compare(nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := []*diffEntry{
+		{Change: changeRemoved, Kind: kindDatabase, Name: "legacy"},
+		{Change: changeChanged, Kind: kindTable, Name: "sales.orders",
+			Details: []string{"column price: added (int)"}},
+		{Change: changeRemoved, Kind: kindPartition, Name: "sales.orders/ds=2018-10-01"},
+		{Change: changeAdded, Kind: kindPartition, Name: "sales.orders/ds=2018-10-03"},
+		{Change: changeChanged, Kind: kindPartition, Name: "sales.orders/ds=2018-10-02",
+			Details: []string{`location: "hdfs://new:8020/sales/orders/ds=2018-10-02" -> "/moved"`}},
+	}
+	if !reflect.DeepEqual(d.entries, expected) {
+		t.Errorf("unexpected diff:\n%s", formatDiff(d.entries))
+	}
+}
@@ -35,6 +35,8 @@ var dropTableCmd = &cobra.Command{
 
 func init() {
 	dropCmd.PersistentFlags().StringP(optDbName, "d", "default", "database name")
+	addConfirmFlags(dropDbCmd)
+	addBulkFlags(dropTableCmd)
 	dropCmd.AddCommand(dropDbCmd)
 	dropCmd.AddCommand(dropTableCmd)
 	rootCmd.AddCommand(dropCmd)
@@ -0,0 +1,413 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+	"github.com/akolb1/gometastore/hmstool/hmsutil"
+	"github.com/spf13/cobra"
+)
+
+const (
+	optSort = "sort"
+	optTop  = "top"
+
+	sortBySize  = "size"
+	sortByFiles = "files"
+	sortByName  = "name"
+
+	// Parameters maintained by Hive statistics
+	paramTotalSize = "totalSize"
+	paramNumFiles  = "numFiles"
+)
+
+var duCmd = &cobra.Command{
+	Use:   "du",
+	Short: "show storage usage of tables and partitions",
+	Run:   diskUsage,
+	Long: `Show number of files and bytes used by tables and partitions.
+
+Table and partition locations are walked recursively, hidden files and directories
+(starting with '.' or '_') are ignored, the same way as Hive does when computing
+statistics. Locations are walked concurrently by --workers workers.
+The usage is compared with numFiles and totalSize parameters maintained by Hive
+statistics and stats which don't match storage are flagged as stale.
+Usage of partitioned tables is the sum of their partitions.
+
+Tables can be specified as arguments in the form dbName.tableName or just tableName
+with database specified by -d flag. When no tables are specified, all tables of the
+database are reported.
+
+The output is a table by default, use --format json to get usage in JSON.
+
+Examples:
+
+    hmstool du -d sales
+    hmstool du sales.orders sales.items --partitions
+    hmstool du -d sales --sort files --top 10 --format json
+`,
+}
+
+// usageEntry is storage usage of a table or partition
+type usageEntry struct {
+	Name       string        `json:"name"`
+	Location   string        `json:"location,omitempty"`
+	Files      int64         `json:"files"`
+	Bytes      int64         `json:"bytes"`
+	HasStats   bool          `json:"hasStats"`
+	StatsFiles int64         `json:"statsFiles,omitempty"`
+	StatsBytes int64         `json:"statsBytes,omitempty"`
+	Stale      bool          `json:"stale"`
+	Missing    bool          `json:"missing,omitempty"` // Location does not exist
+	Partitions []*usageEntry `json:"partitions,omitempty"`
+}
+
+var usageColumns = []column{
+	{"NAME", func(item interface{}) string { return item.(*usageEntry).Name }},
+	{"FILES", func(item interface{}) string { return fmt.Sprint(item.(*usageEntry).Files) }},
+	{"SIZE", func(item interface{}) string { return formatBytes(item.(*usageEntry).Bytes) }},
+	{"HMS FILES", func(item interface{}) string {
+		e := item.(*usageEntry)
+		if !e.HasStats {
+			return "-"
+		}
+		return fmt.Sprint(e.StatsFiles)
+	}},
+	{"HMS SIZE", func(item interface{}) string {
+		e := item.(*usageEntry)
+		if !e.HasStats {
+			return "-"
+		}
+		return formatBytes(e.StatsBytes)
+	}},
+	{"STATUS", func(item interface{}) string {
+		e := item.(*usageEntry)
+		switch {
+		case e.Missing:
+			return "missing"
+		case e.Stale:
+			return "stale"
+		case !e.HasStats:
+			return "no stats"
+		}
+		return "ok"
+	}},
+}
+
+func diskUsage(cmd *cobra.Command, args []string) {
+	var names [][2]string
+	for _, arg := range args {
+		dbName, tableName := getDbTableName(cmd, arg)
+		if dbName == "" {
+			log.Fatal("missing database name")
+		}
+		names = append(names, [2]string{dbName, tableName})
+	}
+	dbName, _ := cmd.Flags().GetString(optDbName)
+	if len(args) == 0 && dbName == "" {
+		log.Fatal("database or table names should be specified")
+	}
+	sortBy, _ := cmd.Flags().GetString(optSort)
+	if sortBy != sortBySize && sortBy != sortByFiles && sortBy != sortByName {
+		log.Fatalf("invalid sort order %s, should be one of %s, %s or %s",
+			sortBy, sortBySize, sortByFiles, sortByName)
+	}
+	client, err := getClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+	if len(args) == 0 {
+		tableNames, err := client.GetAllTables(dbName)
+		if err != nil {
+			log.Fatalf("failed to get tables for %s: %v", dbName, err)
+		}
+		for _, tableName := range tableNames {
+			names = append(names, [2]string{dbName, tableName})
+		}
+	}
+	workers, _ := cmd.Flags().GetInt(optWorkers)
+	usage, err := tableUsage(client, names, workers)
+	if err != nil {
+		log.Fatal(err)
+	}
+	top, _ := cmd.Flags().GetInt(optTop)
+	usage = sortUsage(usage, sortBy, top)
+	withPartitions, _ := cmd.Flags().GetBool(optPartitions)
+	var partitions []*usageEntry
+	for _, u := range usage {
+		if withPartitions {
+			u.Partitions = sortUsage(u.Partitions, sortBy, top)
+			partitions = append(partitions, u.Partitions...)
+		} else {
+			u.Partitions = nil
+		}
+	}
+	data := &displayData{object: usage, sections: []displaySection{usageSection(usage)}}
+	if len(partitions) != 0 {
+		data.sections = append(data.sections, usageSection(partitions))
+	}
+	if err = display(cmd, data, formatTable); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usageSection(usage []*usageEntry) displaySection {
+	items := make([]interface{}, len(usage))
+	for i, u := range usage {
+		items[i] = u
+	}
+	return displaySection{items: items, columns: usageColumns}
+}
+
+// tableUsage computes storage usage for the given tables. Metadata is read
+// sequentially, locations are walked concurrently by workers.
+func tableUsage(client metastoreReader, names [][2]string, workers int) ([]*usageEntry, error) {
+	var usage []*usageEntry
+	var locations []*usageEntry
+	for _, name := range names {
+		dbName, tableName := name[0], name[1]
+		table, err := client.GetTable(dbName, tableName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get table %s.%s: %v", dbName, tableName, err)
+		}
+		if table.TableType == hmsclient.TableTypeView.String() {
+			continue
+		}
+		entry := &usageEntry{Name: dbName + "." + tableName, Location: sdLocation(table.Sd)}
+		usage = append(usage, entry)
+		if len(table.PartitionKeys) == 0 {
+			entry.HasStats, entry.StatsFiles, entry.StatsBytes = statsUsage(table.Parameters)
+			locations = append(locations, entry)
+			continue
+		}
+		partitions, err := tablePartitions(client, dbName, tableName)
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]string, len(table.PartitionKeys))
+		for i, k := range table.PartitionKeys {
+			keys[i] = k.Name
+		}
+		for _, p := range partitions {
+			partEntry := &usageEntry{
+				Name:     entry.Name + "/" + hmsclient.MakePartName(keys, p.Values),
+				Location: sdLocation(p.Sd),
+			}
+			partEntry.HasStats, partEntry.StatsFiles, partEntry.StatsBytes = statsUsage(p.Parameters)
+			entry.Partitions = append(entry.Partitions, partEntry)
+			locations = append(locations, partEntry)
+		}
+	}
+
+	if err := walkUsage(locations, workers); err != nil {
+		return nil, err
+	}
+
+	for _, entry := range usage {
+		if entry.Partitions == nil {
+			entry.Stale = isStale(entry)
+			continue
+		}
+		entry.HasStats = true
+		for _, p := range entry.Partitions {
+			p.Stale = isStale(p)
+			entry.Files += p.Files
+			entry.Bytes += p.Bytes
+			entry.StatsFiles += p.StatsFiles
+			entry.StatsBytes += p.StatsBytes
+			entry.HasStats = entry.HasStats && p.HasStats
+			entry.Stale = entry.Stale || p.Stale
+		}
+	}
+	return usage, nil
+}
+
+// tablePartitions returns all partitions of the table, fetching them in batches
+func tablePartitions(client metastoreReader, dbName string, tableName string) ([]*hive_metastore.Partition, error) {
+	names, err := client.GetPartitionNames(dbName, tableName, -1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get partitions for %s.%s: %v", dbName, tableName, err)
+	}
+	return partitionsByNames(client, dbName, tableName, names)
+}
+
+// partitionsByNames returns partitions with the given names, fetching them in batches
+func partitionsByNames(client metastoreReader, dbName string, tableName string,
+	names []string) ([]*hive_metastore.Partition, error) {
+	var result []*hive_metastore.Partition
+	for start := 0; start < len(names); start += maxParts {
+		end := start + maxParts
+		if end > len(names) {
+			end = len(names)
+		}
+		partitions, err := client.GetPartitionsByNames(dbName, tableName, names[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("failed to get partitions for %s.%s: %v", dbName, tableName, err)
+		}
+		result = append(result, partitions...)
+	}
+	return result, nil
+}
+
+// walkUsage walks locations of entries concurrently and fills their usage
+func walkUsage(entries []*usageEntry, workers int) error {
+	return runParallel(workers, len(entries), func(i int) error {
+		return entries[i].walk()
+	})
+}
+
+// runParallel calls fn for each index from 0 to count-1 using workers goroutines.
+// It returns one of the errors returned by fn.
+func runParallel(workers int, count int, fn func(i int) error) error {
+	return runWorkers(workers, count, func(_ int, i int) error {
+		return fn(i)
+	})
+}
+
+// runWorkers is like runParallel but also passes the index of the worker
+// running fn, so that workers can use their own resources such as metastore clients.
+func runWorkers(workers int, count int, fn func(worker int, i int) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+	jobs := make(chan int)
+	errs := make(chan error, count)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := range jobs {
+				if err := fn(w, i); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+	for i := 0; i < count; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// walk counts files and bytes in the entry location
+func (u *usageEntry) walk() error {
+	if u.Location == "" {
+		u.Missing = true
+		return nil
+	}
+	fs, err := hmsutil.GetFileSystem(u.Location)
+	if err != nil {
+		return fmt.Errorf("%s: %v", u.Name, err)
+	}
+	err = fs.Walk(u.Location, func(info hmsutil.FileInfo) error {
+		if isHidden(info.Name) {
+			if info.IsDir {
+				return hmsutil.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir {
+			u.Files++
+			u.Bytes += info.Size
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		u.Missing = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to walk %s for %s: %v", u.Location, u.Name, err)
+	}
+	return nil
+}
+
+// isHidden returns true for files ignored by Hive
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
+
+// statsUsage returns numFiles and totalSize from Hive statistics parameters
+func statsUsage(params map[string]string) (ok bool, files int64, bytes int64) {
+	files, err := strconv.ParseInt(params[paramNumFiles], 10, 64)
+	if err != nil {
+		return false, 0, 0
+	}
+	bytes, err = strconv.ParseInt(params[paramTotalSize], 10, 64)
+	if err != nil {
+		return false, 0, 0
+	}
+	return true, files, bytes
+}
+
+func isStale(u *usageEntry) bool {
+	return u.HasStats && (u.Files != u.StatsFiles || u.Bytes != u.StatsBytes)
+}
+
+// sortUsage sorts usage entries, largest first, and returns at most top entries.
+// Zero top means all entries.
+func sortUsage(usage []*usageEntry, sortBy string, top int) []*usageEntry {
+	sort.SliceStable(usage, func(i, j int) bool {
+		a, b := usage[i], usage[j]
+		switch {
+		case sortBy == sortBySize && a.Bytes != b.Bytes:
+			return a.Bytes > b.Bytes
+		case sortBy == sortByFiles && a.Files != b.Files:
+			return a.Files > b.Files
+		}
+		return a.Name < b.Name
+	})
+	if top > 0 && top < len(usage) {
+		usage = usage[:top]
+	}
+	return usage
+}
+
+// formatBytes formats size in human-readable form using binary units
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%dB", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+func init() {
+	duCmd.Flags().StringP(optDbName, "d", "", "database name")
+	duCmd.Flags().String(optSort, sortBySize, "sort order: size, files or name")
+	duCmd.Flags().Int(optTop, 0, "show only top N tables (and top N partitions of each table)")
+	duCmd.Flags().Bool(optPartitions, false, "show usage of each partition")
+	duCmd.Flags().Int(optWorkers, 8, "number of locations walked concurrently")
+	rootCmd.AddCommand(duCmd)
+}
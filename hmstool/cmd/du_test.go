@@ -0,0 +1,87 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+)
+
+func TestTableUsage(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]int{
+		"orders/ds=1/part-0":          100,
+		"orders/ds=1/part-1":          50,
+		"orders/ds=1/_SUCCESS":        0,
+		"orders/ds=2/part-0":          10,
+		"orders/ds=2/.hive-staging/x": 1000,
+		"items/part-0":                7,
+	}
+	for name, size := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	location := "file://" + filepath.ToSlash(dir)
+	orders, ordersParts := deltaTestTable("orders", "1", "2", "3")
+	orders.Sd.Location = location + "/orders"
+	for i, p := range ordersParts {
+		p.Sd.Location = orders.Sd.Location + "/ds=" + p.Values[0]
+		if i < 2 {
+			p.Parameters = map[string]string{paramNumFiles: "2", paramTotalSize: "150"}
+		}
+	}
+	items := &hive_metastore.Table{DbName: "sales", TableName: "items",
+		Sd:         &hive_metastore.StorageDescriptor{Location: location + "/items"},
+		Parameters: map[string]string{paramNumFiles: "1", paramTotalSize: "7"}}
+	catalog := &fakeCatalog{
+		tables:     map[string]map[string]*hive_metastore.Table{"sales": {"orders": orders, "items": items}},
+		partitions: map[string][]*hive_metastore.Partition{"sales.orders": ordersParts},
+	}
+
+	usage, err := tableUsage(catalog, [][2]string{{"sales", "items"}, {"sales", "orders"}}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usage = sortUsage(usage, sortBySize, 0)
+	if len(usage) != 2 || usage[0].Name != "sales.orders" || usage[1].Name != "sales.items" {
+		t.Fatalf("unexpected usage %v", usage)
+	}
+	itemsUsage, ordersUsage := usage[1], usage[0]
+	if itemsUsage.Files != 1 || itemsUsage.Bytes != 7 || !itemsUsage.HasStats || itemsUsage.Stale {
+		t.Errorf("unexpected usage of items %+v", itemsUsage)
+	}
+	if ordersUsage.Files != 3 || ordersUsage.Bytes != 160 || ordersUsage.HasStats || !ordersUsage.Stale {
+		t.Errorf("unexpected usage of orders %+v", ordersUsage)
+	}
+	parts := sortUsage(ordersUsage.Partitions, sortByName, 0)
+	if parts[0].Stale || !parts[1].Stale || parts[1].Bytes != 10 || !parts[2].Missing {
+		t.Errorf("unexpected partition usage %+v %+v %+v", parts[0], parts[1], parts[2])
+	}
+	if top := sortUsage(parts, sortByFiles, 1); len(top) != 1 || top[0].Name != "sales.orders/ds=1" {
+		t.Errorf("unexpected top partition %v", top)
+	}
+	if s := formatBytes(1536); s != "1.5K" {
+		t.Errorf("expected 1.5K, got %s", s)
+	}
+}
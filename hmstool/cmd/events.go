@@ -0,0 +1,136 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+	"github.com/apache/thrift/lib/go/thrift"
+)
+
+// Notification event types produced by HMS DbNotificationListener
+const (
+	eventCreateDatabase = "CREATE_DATABASE"
+	eventAlterDatabase  = "ALTER_DATABASE"
+	eventDropDatabase   = "DROP_DATABASE"
+	eventCreateTable    = "CREATE_TABLE"
+	eventAlterTable     = "ALTER_TABLE"
+	eventDropTable      = "DROP_TABLE"
+	eventAddPartition   = "ADD_PARTITION"
+	eventAlterPartition = "ALTER_PARTITION"
+	eventDropPartition  = "DROP_PARTITION"
+
+	gzipFormatPrefix = "gzip("
+)
+
+// eventMessage is the subset of the JSON notification message used for replication.
+type eventMessage struct {
+	Db                 string              `json:"db"`
+	Table              string              `json:"table"`
+	Partitions         []map[string]string `json:"partitions"`
+	KeyValues          map[string]string   `json:"keyValues"`
+	TableObjBeforeJSON string              `json:"tableObjBeforeJson"`
+	TableObjAfterJSON  string              `json:"tableObjAfterJson"`
+}
+
+// decodeEventMessage decodes the JSON message of the notification event.
+// Both plain JSON and gzip-compressed (base64-encoded) messages are supported.
+func decodeEventMessage(event *hive_metastore.NotificationEvent) (*eventMessage, error) {
+	raw := []byte(event.Message)
+	if strings.HasPrefix(event.GetMessageFormat(), gzipFormatPrefix) {
+		compressed, err := base64.StdEncoding.DecodeString(event.Message)
+		if err != nil {
+			return nil, fmt.Errorf("event %d: invalid message encoding: %v", event.EventId, err)
+		}
+		reader, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, fmt.Errorf("event %d: invalid compressed message: %v", event.EventId, err)
+		}
+		if raw, err = ioutil.ReadAll(reader); err != nil {
+			return nil, fmt.Errorf("event %d: invalid compressed message: %v", event.EventId, err)
+		}
+	}
+	message := new(eventMessage)
+	if err := json.Unmarshal(raw, message); err != nil {
+		return nil, fmt.Errorf("event %d: invalid message: %v", event.EventId, err)
+	}
+	if message.Db == "" {
+		message.Db = event.GetDbName()
+	}
+	if message.Table == "" {
+		message.Table = event.GetTableName()
+	}
+	return message, nil
+}
+
+// renamed returns the table before and after the change for ALTER_TABLE events
+// which rename the table, possibly moving it to another database, and nil tables
+// otherwise. HMS reports the event with the new database and table names, so the
+// old names are only known from the table before the change.
+func (m *eventMessage) renamed() (before *hive_metastore.Table, after *hive_metastore.Table, err error) {
+	if m.TableObjBeforeJSON == "" || m.TableObjAfterJSON == "" {
+		return nil, nil, nil
+	}
+	before = new(hive_metastore.Table)
+	if err = decodeThriftJSON(m.TableObjBeforeJSON, before); err != nil {
+		return nil, nil, err
+	}
+	after = new(hive_metastore.Table)
+	if err = decodeThriftJSON(m.TableObjAfterJSON, after); err != nil {
+		return nil, nil, err
+	}
+	if strings.EqualFold(before.DbName, after.DbName) && strings.EqualFold(before.TableName, after.TableName) {
+		return nil, nil, nil
+	}
+	return before, after, nil
+}
+
+// partitionValues returns lists of partition values from partition specs, ordered
+// according to table partition keys.
+func partitionValues(keys []*hive_metastore.FieldSchema, specs []map[string]string) ([][]string, error) {
+	result := make([][]string, 0, len(specs))
+	for _, spec := range specs {
+		values := make([]string, len(keys))
+		for i, key := range keys {
+			value, ok := spec[key.Name]
+			if !ok {
+				return nil, fmt.Errorf("missing value for partition key %s in %v", key.Name, spec)
+			}
+			values[i] = value
+		}
+		result = append(result, values)
+	}
+	return result, nil
+}
+
+// decodeThriftJSON decodes Thrift object serialized with TJSONProtocol.
+func decodeThriftJSON(data string, obj thrift.TStruct) error {
+	buffer := thrift.NewTMemoryBufferLen(len(data))
+	if _, err := buffer.WriteString(data); err != nil {
+		return err
+	}
+	if err := obj.Read(context.Background(), thrift.NewTJSONProtocol(buffer)); err != nil {
+		return fmt.Errorf("failed to decode thrift object: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+	"github.com/apache/thrift/lib/go/thrift"
+)
+
+func thriftJSON(t *testing.T, obj thrift.TStruct) string {
+	buffer := thrift.NewTMemoryBuffer()
+	protocol := thrift.NewTJSONProtocol(buffer)
+	if err := obj.Write(context.Background(), protocol); err != nil {
+		t.Fatal(err)
+	}
+	protocol.Flush(context.Background())
+	return buffer.String()
+}
+
+func TestDecodeEventMessage(t *testing.T) {
+	dbName := "sales"
+	message := `{"server":"","db":"sales","table":"orders",` +
+		`"partitions":[{"hr":"1","ds":"2018-10-01"},{"ds":"2018-10-02","hr":"2"}]}`
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	w.Write([]byte(message))
+	w.Close()
+	gzipFormat := "gzip(json-2.0)"
+
+	events := []*hive_metastore.NotificationEvent{
+		{EventId: 1, EventType: eventAddPartition, DbName: &dbName, Message: message},
+		{EventId: 2, EventType: eventAddPartition, DbName: &dbName, MessageFormat: &gzipFormat,
+			Message: base64.StdEncoding.EncodeToString(compressed.Bytes())},
+	}
+	keys := []*hive_metastore.FieldSchema{{Name: "ds"}, {Name: "hr"}}
+	expected := [][]string{{"2018-10-01", "1"}, {"2018-10-02", "2"}}
+	for _, event := range events {
+		m, err := decodeEventMessage(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Db != "sales" || m.Table != "orders" {
+			t.Errorf("event %d: invalid table %s.%s", event.EventId, m.Db, m.Table)
+		}
+		values, err := partitionValues(keys, m.Partitions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(values, expected) {
+			t.Errorf("event %d: expected %v, got %v", event.EventId, expected, values)
+		}
+	}
+
+	if _, err := partitionValues(append(keys, &hive_metastore.FieldSchema{Name: "min"}),
+		[]map[string]string{{"ds": "1", "hr": "2"}}); err == nil {
+		t.Error("missing partition value should be reported")
+	}
+}
+
+func TestRenamed(t *testing.T) {
+	before := &hive_metastore.Table{DbName: "sales", TableName: "orders", Sd: &hive_metastore.StorageDescriptor{}}
+	after := &hive_metastore.Table{DbName: "sales", TableName: "all_orders", Sd: &hive_metastore.StorageDescriptor{}}
+	m := &eventMessage{TableObjBeforeJSON: thriftJSON(t, before), TableObjAfterJSON: thriftJSON(t, after)}
+	oldTable, newTable, err := m.renamed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oldTable.TableName != "orders" || newTable.TableName != "all_orders" {
+		t.Errorf("expected rename of orders to all_orders, got %v to %v", oldTable, newTable)
+	}
+	m.TableObjAfterJSON = m.TableObjBeforeJSON
+	if _, newTable, _ = m.renamed(); newTable != nil {
+		t.Errorf("unexpected rename to %s", newTable.TableName)
+	}
+	// Table moved to another database
+	after.DbName = "archive"
+	after.TableName = "orders"
+	m.TableObjAfterJSON = thriftJSON(t, after)
+	if _, newTable, _ = m.renamed(); newTable == nil || newTable.DbName != "archive" {
+		t.Errorf("expected rename to archive.orders, got %v", newTable)
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "checkpoint.json")
+	checkpoint, err := readCheckpoint(fileName)
+	if err != nil || checkpoint != nil {
+		t.Fatalf("missing checkpoint should be ignored, got %v, %v", checkpoint, err)
+	}
+	saved := &replicationCheckpoint{Source: "h1", Target: "h2", LastEventID: 42}
+	if err = saved.save(fileName); err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint, err = readCheckpoint(fileName); err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint.LastEventID != 42 || checkpoint.Source != "h1" || checkpoint.Target != "h2" {
+		t.Errorf("invalid checkpoint %+v", checkpoint)
+	}
+}
@@ -0,0 +1,319 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+	"github.com/akolb1/gometastore/hmstool/hmsutil"
+	"github.com/spf13/cobra"
+)
+
+const (
+	optKey         = "key"
+	optDateFormat  = "date-format"
+	optKeep        = "keep"
+	optPolicyParam = "policy-param"
+	optDropData    = "drop-data"
+
+	defaultDateFormat  = "2006-01-02"
+	defaultPolicyParam = "retention.days"
+
+	// Status of expired partitions in the audit output
+	expireStatusExpired = "expired"
+	expireStatusDropped = "dropped"
+)
+
+var partitionsExpireCmd = &cobra.Command{
+	Use:   "expire",
+	Short: "drop partitions older than retention period",
+	Run:   expirePartitionsCmd,
+	Long: `Drop partitions with dates older than the retention period.
+
+The value of the partition key specified by --key is parsed as a date using the Go
+layout given by --date-format. The flag isn't called --format because --format
+already selects the output format of all commands. The key may be omitted for tables
+with a single partition key. Partitions with values that can't be parsed are never
+dropped.
+
+The retention period is given by --keep as a number of days (90d), weeks (2w) or a
+Go duration (36h). When --keep isn't given, it is read from the table parameter
+specified by --policy-param which holds the number of days or a period in the same
+format. When the period is a whole number of days, the current day is counted from
+midnight UTC, so --keep 90d keeps 90 days of partitions besides today's.
+
+Expired partitions are dropped in batches. Partition data of managed tables is
+deleted only with --drop-data. Since HMS never deletes data of external tables,
+--drop-data deletes their partition locations after partitions are dropped, but
+only locations inside the table location.
+
+Every expired partition is listed in the output, use --format json for audit logs.
+With --dry-run expired partitions are listed but not dropped.
+
+Examples:
+
+    hmstool partitions expire sales.orders --key ds --keep 90d --dry-run
+    hmstool partitions expire sales.events --key hour --date-format 2006-01-02-15 --keep 48h
+    hmstool partitions expire sales.orders --drop-data --format json
+`,
+}
+
+// expireTarget is the part of the metastore client used to expire partitions
+type expireTarget interface {
+	GetTable(dbName string, tableName string) (*hive_metastore.Table, error)
+	GetPartitionNames(dbName string, tableName string, max int) ([]string, error)
+	GetPartitionsByNames(dbName string, tableName string,
+		partNames []string) ([]*hive_metastore.Partition, error)
+	DropPartitionsByNames(dbName string, tableName string, partNames []string, deleteData bool) error
+}
+
+// retentionPolicy selects expired partitions
+type retentionPolicy struct {
+	key         string        // Partition key holding the date, may be empty for single key
+	layout      string        // Date layout of the partition values
+	keep        time.Duration // Retention period, read from table parameter if zero
+	policyParam string        // Table parameter holding retention period
+}
+
+// expiredPartition is an audit record of expired partition
+type expiredPartition struct {
+	Name        string `json:"name"`
+	Date        string `json:"date"`
+	Location    string `json:"location,omitempty"`
+	Status      string `json:"status"`
+	DataDeleted bool   `json:"dataDeleted"`
+}
+
+var expireColumns = []column{
+	{"NAME", func(item interface{}) string { return item.(*expiredPartition).Name }},
+	{"DATE", func(item interface{}) string { return item.(*expiredPartition).Date }},
+	{"STATUS", func(item interface{}) string { return item.(*expiredPartition).Status }},
+	{"DATA DELETED", func(item interface{}) string {
+		return strconv.FormatBool(item.(*expiredPartition).DataDeleted)
+	}},
+	{"LOCATION", func(item interface{}) string { return item.(*expiredPartition).Location }},
+}
+
+func expirePartitionsCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		log.Fatal("table name should be specified")
+	}
+	dbName, tableName := getDbTableName(cmd, args[0])
+	if dbName == "" {
+		log.Fatal("missing database name")
+	}
+	policy := retentionPolicy{}
+	policy.key, _ = cmd.Flags().GetString(optKey)
+	policy.layout, _ = cmd.Flags().GetString(optDateFormat)
+	policy.policyParam, _ = cmd.Flags().GetString(optPolicyParam)
+	if keep, _ := cmd.Flags().GetString(optKeep); keep != "" {
+		var err error
+		if policy.keep, err = parseRetention(keep); err != nil {
+			log.Fatalf("invalid --%s: %v", optKeep, err)
+		}
+	}
+	dropData, _ := cmd.Flags().GetBool(optDropData)
+	dryRun, _ := cmd.Flags().GetBool(optDryRun)
+
+	client, err := getClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+
+	expired, expireErr := expirePartitions(client, dbName, tableName, policy, time.Now(), dropData, dryRun)
+	items := make([]interface{}, len(expired))
+	for i, p := range expired {
+		items[i] = p
+	}
+	data := &displayData{object: expired, sections: []displaySection{{items: items, columns: expireColumns}}}
+	if err = display(cmd, data, formatTable); err != nil {
+		log.Fatal(err)
+	}
+	if expireErr != nil {
+		log.Fatal(expireErr)
+	}
+}
+
+// parseRetention parses retention period given as number of days, days or weeks
+// with d or w suffix or Go duration.
+func parseRetention(s string) (time.Duration, error) {
+	const day = 24 * time.Hour
+	units := map[string]time.Duration{"": day, "d": day, "w": 7 * day}
+	number := strings.TrimRight(s, "dw")
+	if unit, ok := units[s[len(number):]]; ok {
+		if n, err := strconv.Atoi(number); err == nil {
+			if n <= 0 {
+				return 0, fmt.Errorf("retention period %q should be positive", s)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid retention period %q", s)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("retention period %q should be positive", s)
+	}
+	return d, nil
+}
+
+// expirePartitions drops partitions of the table which are older than the
+// retention period relative to now. It returns expired partitions, including
+// ones dropped before an error occurred.
+func expirePartitions(client expireTarget, dbName string, tableName string,
+	policy retentionPolicy, now time.Time, dropData bool, dryRun bool) ([]*expiredPartition, error) {
+	name := dbName + "." + tableName
+	table, err := client.GetTable(dbName, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get table %s: %v", name, err)
+	}
+	keys := make([]string, len(table.PartitionKeys))
+	keyIndex := -1
+	for i, k := range table.PartitionKeys {
+		keys[i] = k.Name
+		if k.Name == policy.key || (policy.key == "" && len(table.PartitionKeys) == 1) {
+			keyIndex = i
+		}
+	}
+	switch {
+	case len(keys) == 0:
+		return nil, fmt.Errorf("table %s is not partitioned", name)
+	case policy.key == "" && keyIndex < 0:
+		return nil, fmt.Errorf("table %s has multiple partition keys, the date key should be specified", name)
+	case keyIndex < 0:
+		return nil, fmt.Errorf("table %s has no partition key %s", name, policy.key)
+	}
+
+	keep := policy.keep
+	if keep == 0 {
+		value := table.Parameters[policy.policyParam]
+		if value == "" {
+			return nil, fmt.Errorf("no retention period for %s: table parameter %s is not set",
+				name, policy.policyParam)
+		}
+		if keep, err = parseRetention(value); err != nil {
+			return nil, fmt.Errorf("table %s parameter %s: %v", name, policy.policyParam, err)
+		}
+	}
+	now = now.UTC()
+	if keep%(24*time.Hour) == 0 {
+		// Count whole days from the beginning of the current day
+		now = now.Truncate(24 * time.Hour)
+	}
+	cutoff := now.Add(-keep)
+
+	names, err := client.GetPartitionNames(dbName, tableName, -1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get partitions for %s: %v", name, err)
+	}
+	var expired []*expiredPartition
+	byName := make(map[string]*expiredPartition)
+	for _, partName := range names {
+		_, values, err := hmsclient.ParsePartName(partName)
+		if err != nil || len(values) != len(keys) {
+			log.Printf("skipping partition %s of %s: unexpected name", partName, name)
+			continue
+		}
+		date, err := time.ParseInLocation(policy.layout, values[keyIndex], time.UTC)
+		if err != nil {
+			log.Printf("skipping partition %s of %s: %v", partName, name, err)
+			continue
+		}
+		if date.Before(cutoff) {
+			p := &expiredPartition{Name: partName, Date: date.Format(time.RFC3339), Status: expireStatusExpired}
+			expired = append(expired, p)
+			byName[partName] = p
+		}
+	}
+	if len(expired) == 0 {
+		return nil, nil
+	}
+
+	isExternal := table.TableType == hmsclient.TableTypeExternal.String() ||
+		strings.EqualFold(table.Parameters[externalTable], trueValue)
+	tableLocation := sdLocation(table.Sd)
+	for start := 0; start < len(expired); start += maxParts {
+		end := start + maxParts
+		if end > len(expired) {
+			end = len(expired)
+		}
+		batch := make([]string, 0, end-start)
+		for _, p := range expired[start:end] {
+			batch = append(batch, p.Name)
+		}
+		partitions, err := client.GetPartitionsByNames(dbName, tableName, batch)
+		if err != nil {
+			return expired, fmt.Errorf("failed to get partitions for %s: %v", name, err)
+		}
+		for _, p := range partitions {
+			if e := byName[hmsclient.MakePartName(keys, p.Values)]; e != nil {
+				e.Location = sdLocation(p.Sd)
+			}
+		}
+		if dryRun {
+			continue
+		}
+		if err = client.DropPartitionsByNames(dbName, tableName, batch, dropData); err != nil {
+			return expired, fmt.Errorf("failed to drop partitions from %s: %v", name, err)
+		}
+		for _, p := range expired[start:end] {
+			p.Status = expireStatusDropped
+			p.DataDeleted = dropData && !isExternal
+			if !dropData || !isExternal || p.Location == "" {
+				continue
+			}
+			if !isSubLocation(p.Location, tableLocation) {
+				log.Printf("not deleting %s outside of table location %s", p.Location, tableLocation)
+				continue
+			}
+			if err = removeLocation(p.Location); err != nil {
+				return expired, err
+			}
+			p.DataDeleted = true
+		}
+	}
+	return expired, nil
+}
+
+// removeLocation deletes the location with all its content
+func removeLocation(location string) error {
+	fs, err := hmsutil.GetFileSystem(location)
+	if err != nil {
+		return err
+	}
+	if err = fs.RemoveAll(location); err != nil {
+		return fmt.Errorf("failed to delete %s: %v", location, err)
+	}
+	return nil
+}
+
+func init() {
+	partitionsExpireCmd.Flags().String(optKey, "", "partition key holding the date")
+	partitionsExpireCmd.Flags().String(optDateFormat, defaultDateFormat, "Go layout of partition dates (--format selects the output format)")
+	partitionsExpireCmd.Flags().String(optKeep, "", "retention period, e.g. 90d")
+	partitionsExpireCmd.Flags().String(optPolicyParam, defaultPolicyParam,
+		"table parameter with retention period used when --keep is not given")
+	partitionsExpireCmd.Flags().Bool(optDropData, false, "delete data of dropped partitions")
+	partitionsExpireCmd.Flags().Bool(optDryRun, false, "only show expired partitions")
+	partitionsCmd.AddCommand(partitionsExpireCmd)
+}
@@ -0,0 +1,116 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+)
+
+func (f *fakeCatalog) DropPartitionsByNames(dbName string, tableName string,
+	partNames []string, deleteData bool) error {
+	return f.DropPartitions(dbName, tableName, partNames)
+}
+
+func TestParseRetention(t *testing.T) {
+	day := 24 * time.Hour
+	for s, expected := range map[string]time.Duration{
+		"90": 90 * day, "90d": 90 * day, "2w": 14 * day, "36h": 36 * time.Hour,
+	} {
+		if d, err := parseRetention(s); err != nil || d != expected {
+			t.Errorf("%s: expected %v, got %v, %v", s, expected, d, err)
+		}
+	}
+	for _, s := range []string{"", "0d", "-1h", "10x", "d"} {
+		if _, err := parseRetention(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestExpirePartitions(t *testing.T) {
+	dir := t.TempDir()
+	location := "file://" + filepath.ToSlash(dir)
+	orders, parts := deltaTestTable("orders", "2018-07-19", "2018-07-20", "2018-07-21", "2018-10-19", "latest")
+	orders.Parameters = map[string]string{defaultPolicyParam: "90"}
+	orders.Sd.Location = location + "/orders"
+	for _, p := range parts {
+		p.Sd.Location = orders.Sd.Location + "/ds=" + p.Values[0]
+		if err := os.MkdirAll(filepath.Join(dir, "orders", "ds="+p.Values[0]), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	catalog := &fakeCatalog{
+		tables:     map[string]map[string]*hive_metastore.Table{"sales": {"orders": orders}},
+		partitions: map[string][]*hive_metastore.Partition{"sales.orders": parts},
+	}
+	now := time.Date(2018, 10, 19, 15, 30, 0, 0, time.UTC)
+	policy := retentionPolicy{layout: defaultDateFormat, policyParam: defaultPolicyParam}
+
+	expired, err := expirePartitions(catalog, "sales", "orders", policy, now, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range expired {
+		names = append(names, e.Name)
+		if e.Status != expireStatusExpired || e.Location == "" {
+			t.Errorf("unexpected dry run result %v", e)
+		}
+	}
+	if expected := []string{"ds=2018-07-19", "ds=2018-07-20"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+	if len(catalog.partitions["sales.orders"]) != 5 {
+		t.Error("dry run should not drop partitions")
+	}
+
+	// Explicit retention overrides table parameter, data of external table is deleted
+	orders.TableType = hmsclient.TableTypeExternal.String()
+	policy.key, policy.keep = "ds", 7*24*time.Hour
+	expired, err = expirePartitions(catalog, "sales", "orders", policy, now, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 3 {
+		t.Fatalf("expected 3 expired partitions, got %d", len(expired))
+	}
+	for _, e := range expired {
+		if e.Status != expireStatusDropped || !e.DataDeleted {
+			t.Errorf("unexpected result %v", e)
+		}
+	}
+	if names, _ := catalog.GetPartitionNames("sales", "orders", -1); !reflect.DeepEqual(names,
+		[]string{"ds=2018-10-19", "ds=latest"}) {
+		t.Errorf("unexpected remaining partitions %v", names)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "orders", "ds=2018-07-21")); !os.IsNotExist(err) {
+		t.Errorf("expected partition directory to be deleted, got %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "orders", "ds=2018-10-19")); err != nil {
+		t.Error(err)
+	}
+
+	policy.key = "hour"
+	if _, err = expirePartitions(catalog, "sales", "orders", policy, now, false, true); err == nil {
+		t.Error("expected error for unknown partition key")
+	}
+}
@@ -1,18 +1,61 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"path/filepath"
+	"time"
 
-	"github.com/akolb1/gometastore/hmsclient"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	optFormat = "format"
+
+	formatJSON = "json"
+	formatSQL  = "sql"
 )
 
 var exportCmd = &cobra.Command{
 	Use:   "export",
 	Short: "Export databases or tables in JSON format",
+	Run:   deltaExport,
 	Long: `Export HMS databases or tables in JSON format.
 
+With --format sql the objects are exported as HiveQL statements instead.
+SQL output can't be imported with hmstool, use beeline to execute it.
+
+With --format ndjson every object is written as a separate JSON record on its
+own line, for example {"kind":"table","table":{...}}. Objects are written as
+they are fetched from HMS and partitions are fetched in batches, so this format
+should be used for very large catalogs.
+
+When --format is not specified it is derived from the output file extension:
+.ndjson and .jsonl files use ndjson format, .sql files use sql, all others use json.
+
+Output can be compressed with --compress gzip or zstd. Files with .gz or .zst
+extension are compressed by default. Import detects both format and compression
+automatically.
+
+Exported tables can be selected with --tables and --exclude glob patterns, which
+match either table name or db.table name, and with --table-type. Partitions can be
+skipped with --no-partitions or selected with --partition-filter, which is
+evaluated by HMS, for example 'ds >= "2018-10-01"'.
+
+Every export records the ID of the last HMS notification event before and after the
+export. If they differ, HMS was modified during the export and the snapshot may be
+inconsistent. Events after the first ID should be applied to bring the snapshot up to date.
+
+With --since-event N, objects changed by notification events after N are exported
+instead. Dropped objects are recorded as tombstones, other changed objects are
+exported in their current state. Tables which were created or renamed are exported
+with all partitions, for other tables only changed partitions are exported.
+Use the first event ID recorded by the previous export as N. Import applies the
+delta on top of the previous export. Delta can't be exported in sql format.
+
 The file can then be imported using 
 
     hmstool import
@@ -32,6 +75,25 @@ Examples assume that HMS_HOST is pointing to the valid HMS server.
 3. Import JSON file:
 
        hmstool import tables.json
+
+4. Export default database as HiveQL script
+
+       hmstool export db default --format sql -o default.sql
+
+5. Export large database as compressed NDJSON stream
+
+       hmstool export db warehouse -o warehouse.ndjson.zst
+
+6. Export external tables of the sales database, except temporary ones,
+   with partitions for October only
+
+       hmstool export db sales --table-type external --exclude 'tmp_*' \
+           --partition-filter 'ds >= "2018-10-01" and ds < "2018-11-01"'
+
+7. Export changes since the previous export and apply them
+
+       hmstool export --since-event 123456 -o delta.ndjson.gz
+       hmstool import delta.ndjson.gz
 `,
 }
 
@@ -80,18 +142,33 @@ func dbExport(cmd *cobra.Command, args []string) {
 			args = []string{dbName}
 		}
 	}
-	hmsObject := new(HmsObject)
+	filter, err := newExportFilter(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+	output, err := newExportOutput(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = output.begin(client); err != nil {
+		log.Fatal(err)
+	}
 	dbNames := make(map[string]bool)
 
 	for _, dbName := range args {
 		if !dbNames[dbName] {
 			dbNames[dbName] = true
-			if err = exportDatabase(client, hmsObject, dbName, true); err != nil {
+			if err = exportDatabase(client, output.sink, dbName, true, filter); err != nil {
 				fmt.Println(err)
 			}
 		}
 	}
-	displayObject(hmsObject)
+	if err = output.end(client); err != nil {
+		log.Fatal(err)
+	}
+	if err = output.Close(); err != nil {
+		log.Fatal(err)
+	}
 }
 
 func tableExport(cmd *cobra.Command, args []string) {
@@ -105,7 +182,17 @@ func tableExport(cmd *cobra.Command, args []string) {
 			args = []string{table}
 		}
 	}
-	hmsObject := new(HmsObject)
+	filter, err := newExportFilter(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+	output, err := newExportOutput(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = output.begin(client); err != nil {
+		log.Fatal(err)
+	}
 	// names of databases that we already stored
 	dbNames := make(map[string]bool)
 
@@ -113,25 +200,159 @@ func tableExport(cmd *cobra.Command, args []string) {
 		dbName, tableName := getDbTableName(cmd, tableName)
 		if !dbNames[dbName] {
 			dbNames[dbName] = true
-			err = exportDatabase(client, hmsObject, dbName, false)
+			err = exportDatabase(client, output.sink, dbName, false, filter)
 			if err != nil {
 				fmt.Println(err)
 			}
 		}
-		exportTable(client, hmsObject, dbName, tableName, true)
+		if err = exportTable(client, output.sink, dbName, tableName, true, filter); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if err = output.end(client); err != nil {
+		log.Fatal(err)
+	}
+	if err = output.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// exportSource is the metastore providing exported tables and partitions
+type exportSource interface {
+	metastoreReader
+	GetPartitionNamesByFilter(dbName string, tableName string,
+		filter string, maxCount int) ([]string, error)
+}
+
+// exportOutput writes exported objects in the format requested by --format flag.
+// NDJSON records are written as objects are exported, other formats are written on Close.
+type exportOutput struct {
+	format       string
+	toFile       bool
+	writer       io.WriteCloser
+	sink         exportSink
+	hmsObject    *HmsObject
+	snapshot     *SnapshotInfo
+	delta        bool // Exporting delta since event sinceEventID
+	sinceEventID int64
+}
+
+func newExportOutput(cmd *cobra.Command) (*exportOutput, error) {
+	fileName := viper.GetString(outputOpt)
+	format, _ := cmd.Flags().GetString(optFormat)
+	if format == "" {
+		format = formatFromName(fileName)
+	}
+	if format != formatJSON && format != formatSQL && format != formatNDJSON {
+		return nil, fmt.Errorf("unsupported export format %s", format)
+	}
+	compression, _ := cmd.Flags().GetString(optCompress)
+	if compression == "" {
+		compression = compressionFromName(fileName)
+	}
+	writer, err := createOutput(fileName, compression)
+	if err != nil {
+		return nil, err
+	}
+	output := &exportOutput{format: format, toFile: fileName != "", writer: writer}
+	if format == formatNDJSON {
+		output.sink = newRecordWriter(writer)
+	} else {
+		output.hmsObject = new(HmsObject)
+		output.sink = output.hmsObject
+	}
+	return output, nil
+}
+
+// notificationSource provides notification event IDs recorded in snapshots
+type notificationSource interface {
+	GetCurrentNotificationId() (int64, error)
+}
+
+// begin records notification event ID before the export
+func (output *exportOutput) begin(client notificationSource) error {
+	eventID, err := client.GetCurrentNotificationId()
+	if err != nil {
+		log.Println("failed to get current notification id:", err)
+		return nil
+	}
+	output.snapshot = &SnapshotInfo{
+		Host:          viper.GetString(hostOpt),
+		Time:          time.Now().UTC(),
+		BeforeEventID: eventID,
+		Delta:         output.delta,
+		SinceEventID:  output.sinceEventID,
+	}
+	return output.sink.setSnapshot(output.snapshot)
+}
+
+// end records notification event ID after the export and warns if HMS was modified
+// during the export.
+func (output *exportOutput) end(client notificationSource) error {
+	if output.snapshot == nil {
+		return nil
+	}
+	eventID, err := client.GetCurrentNotificationId()
+	if err != nil {
+		log.Println("failed to get current notification id:", err)
+		return nil
+	}
+	output.snapshot.AfterEventID = eventID
+	if eventID != output.snapshot.BeforeEventID {
+		log.Printf("HMS was modified during export (events %d-%d), export may be inconsistent",
+			output.snapshot.BeforeEventID+1, eventID)
+	}
+	return output.sink.setSnapshot(output.snapshot)
+}
+
+// formatFromName returns export format implied by the file extension
+func formatFromName(fileName string) string {
+	switch filepath.Ext(trimCompressionSuffix(fileName)) {
+	case ".ndjson", ".jsonl":
+		return formatNDJSON
+	case ".sql":
+		return formatSQL
+	}
+	return formatJSON
+}
+
+// Close writes buffered objects and closes the output
+func (output *exportOutput) Close() error {
+	var err error
+	switch output.format {
+	case formatJSON:
+		var b []byte
+		if output.toFile {
+			b, _ = json.Marshal(output.hmsObject)
+		} else {
+			b, _ = json.MarshalIndent(output.hmsObject, "", "  ")
+			b = append(b, '\n')
+		}
+		_, err = output.writer.Write(b)
+	case formatSQL:
+		if s := output.snapshot; s != nil {
+			fmt.Fprintf(output.writer, "-- Exported from %s, notification events %d-%d\n\n",
+				s.Host, s.BeforeEventID, s.AfterEventID)
+		}
+		_, err = io.WriteString(output.writer, renderSQL(output.hmsObject))
+	}
+	if closeErr := output.writer.Close(); err == nil {
+		err = closeErr
 	}
-	displayObject(hmsObject)
+	return err
 }
 
-func exportDatabase(client *hmsclient.MetastoreClient,
-	hmsObject *HmsObject,
-	dbName string, recurse bool) error {
+func exportDatabase(client exportSource,
+	sink exportSink,
+	dbName string, recurse bool, filter *exportFilter) error {
 	db, err := client.GetDatabase(dbName)
 	if err != nil {
 		return fmt.Errorf("failed to get database %s: %s",
 			dbName, err.Error())
 	}
-	hmsObject.Databases = append(hmsObject.Databases, db)
+	if err = sink.addDatabase(db); err != nil {
+		return err
+	}
 	if !recurse {
 		return nil
 	}
@@ -141,7 +362,10 @@ func exportDatabase(client *hmsclient.MetastoreClient,
 			dbName, err.Error())
 	}
 	for _, tableName := range tableNames {
-		err = exportTable(client, hmsObject, dbName, tableName, recurse)
+		if !filter.acceptName(dbName, tableName) {
+			continue
+		}
+		err = exportTable(client, sink, dbName, tableName, recurse, filter)
 		if err != nil {
 			return fmt.Errorf("failed to export tables for %s: %s",
 				dbName, err.Error())
@@ -150,15 +374,20 @@ func exportDatabase(client *hmsclient.MetastoreClient,
 	}
 	return nil
 }
-func exportTable(client *hmsclient.MetastoreClient,
-	hmsObject *HmsObject, dbName string, tableName string, recurse bool) error {
+func exportTable(client exportSource,
+	sink exportSink, dbName string, tableName string, recurse bool, filter *exportFilter) error {
 	table, err := client.GetTable(dbName, tableName)
 	if err != nil {
 		return fmt.Errorf("failed to get table %s: %s", tableName, err.Error())
 	}
-	hmsObject.Tables = append(hmsObject.Tables, table)
-	if recurse {
-		err = exportPartitions(client, hmsObject, dbName, tableName)
+	if !filter.acceptType(table.TableType) {
+		return nil
+	}
+	if err = sink.addTable(table); err != nil {
+		return err
+	}
+	if recurse && (filter == nil || !filter.noPartitions) {
+		err = exportPartitions(client, sink, dbName, tableName, filter)
 		if err != nil {
 			return err
 		}
@@ -166,18 +395,42 @@ func exportTable(client *hmsclient.MetastoreClient,
 	return nil
 }
 
-func exportPartitions(client *hmsclient.MetastoreClient,
-	hmsObject *HmsObject, dbName string, tableName string) error {
-	partitions, err := client.GetPartitions(dbName, tableName, -1)
+// exportPartitions exports partitions of a table, fetching them in batches.
+func exportPartitions(client exportSource,
+	sink exportSink, dbName string, tableName string, filter *exportFilter) error {
+	var names []string
+	var err error
+	if filter != nil && filter.partitionFilter != "" {
+		names, err = client.GetPartitionNamesByFilter(dbName, tableName, filter.partitionFilter, -1)
+	} else {
+		names, err = client.GetPartitionNames(dbName, tableName, -1)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to get partitions for %s: %s",
 			tableName, err.Error())
 	}
-	hmsObject.Partitions = append(hmsObject.Partitions, partitions...)
+	for start := 0; start < len(names); start += maxParts {
+		end := start + maxParts
+		if end > len(names) {
+			end = len(names)
+		}
+		partitions, err := client.GetPartitionsByNames(dbName, tableName, names[start:end])
+		if err != nil {
+			return fmt.Errorf("failed to get partitions for %s: %s",
+				tableName, err.Error())
+		}
+		if err = sink.addPartitions(partitions); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 func init() {
+	exportCmd.PersistentFlags().String(optCompress, "",
+		"output compression: none, gzip or zstd (default is based on output file name)")
+	addFilterFlags(exportCmd)
+	exportCmd.Flags().Int64(optSinceEvent, 0, "export changes after the given notification event ID")
 	exportCmd.AddCommand(exportDbCmd)
 	exportCmd.AddCommand(exportTablesCmd)
 	rootCmd.AddCommand(exportCmd)
@@ -0,0 +1,127 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/gobwas/glob"
+	"github.com/spf13/cobra"
+)
+
+const (
+	optTables          = "tables"
+	optExclude         = "exclude"
+	optNoPartitions    = "no-partitions"
+	optPartitionFilter = "partition-filter"
+	optTableType       = "table-type"
+)
+
+// Short names of table types accepted by --table-type
+var tableTypeNames = map[string]string{
+	"managed":  hmsclient.TableTypeManaged.String(),
+	"external": hmsclient.TableTypeExternal.String(),
+	"view":     hmsclient.TableTypeView.String(),
+	"index":    hmsclient.TableTypeIndex.String(),
+}
+
+// exportFilter selects exported tables and partitions. A nil filter selects everything.
+type exportFilter struct {
+	tables          []glob.Glob     // Exported tables, all if empty
+	exclude         []glob.Glob     // Tables which are never exported
+	tableTypes      map[string]bool // Exported table types, all if empty
+	noPartitions    bool
+	partitionFilter string // HMS partition filter expression
+}
+
+// newExportFilter creates filter from command flags
+func newExportFilter(cmd *cobra.Command) (*exportFilter, error) {
+	f := &exportFilter{tableTypes: make(map[string]bool)}
+	var err error
+	tables, _ := cmd.Flags().GetStringSlice(optTables)
+	if f.tables, err = compileGlobs(tables); err != nil {
+		return nil, err
+	}
+	exclude, _ := cmd.Flags().GetStringSlice(optExclude)
+	if f.exclude, err = compileGlobs(exclude); err != nil {
+		return nil, err
+	}
+	tableTypes, _ := cmd.Flags().GetStringSlice(optTableType)
+	for _, t := range tableTypes {
+		typeName, ok := tableTypeNames[strings.ToLower(t)]
+		if !ok {
+			typeName = strings.ToUpper(t)
+		}
+		f.tableTypes[typeName] = true
+	}
+	f.noPartitions, _ = cmd.Flags().GetBool(optNoPartitions)
+	f.partitionFilter, _ = cmd.Flags().GetString(optPartitionFilter)
+	if f.noPartitions && f.partitionFilter != "" {
+		return nil, fmt.Errorf("--%s and --%s can't be used together", optNoPartitions, optPartitionFilter)
+	}
+	return f, nil
+}
+
+// compileGlobs compiles glob patterns
+func compileGlobs(patterns []string) ([]glob.Glob, error) {
+	globs := make([]glob.Glob, len(patterns))
+	for i, p := range patterns {
+		g, err := glob.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", p, err)
+		}
+		globs[i] = g
+	}
+	return globs, nil
+}
+
+// matchAny returns true if table name or db.table name matches any of the patterns
+func matchAny(globs []glob.Glob, dbName string, tableName string) bool {
+	for _, g := range globs {
+		if g.Match(tableName) || g.Match(dbName+"."+tableName) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptName returns true if the table with the given name should be exported
+func (f *exportFilter) acceptName(dbName string, tableName string) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.tables) != 0 && !matchAny(f.tables, dbName, tableName) {
+		return false
+	}
+	return !matchAny(f.exclude, dbName, tableName)
+}
+
+// acceptType returns true if the table of the given type should be exported
+func (f *exportFilter) acceptType(tableType string) bool {
+	return f == nil || len(f.tableTypes) == 0 || f.tableTypes[tableType]
+}
+
+// addFilterFlags adds filter flags to the command
+func addFilterFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringSlice(optTables, nil, "export only tables matching glob patterns")
+	cmd.PersistentFlags().StringSlice(optExclude, nil, "do not export tables matching glob patterns")
+	cmd.PersistentFlags().Bool(optNoPartitions, false, "do not export partitions")
+	cmd.PersistentFlags().String(optPartitionFilter, "",
+		`export only partitions matching HMS filter, e.g. 'ds >= "2018-10-01"'`)
+	cmd.PersistentFlags().StringSlice(optTableType, nil,
+		"export only tables of given types: managed, external, view, index")
+}
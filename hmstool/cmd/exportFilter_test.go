@@ -0,0 +1,64 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestExportFilter(t *testing.T) {
+	cmd := &cobra.Command{}
+	addFilterFlags(cmd)
+	err := cmd.ParseFlags([]string{"--tables", "orders*,sales.items",
+		"--exclude", "*_tmp", "--table-type", "external"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := newExportFilter(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{
+		"orders":     true,
+		"orders_tmp": false,
+		"items":      true,
+		"customers":  false,
+	}
+	for name, expected := range names {
+		if got := filter.acceptName("sales", name); got != expected {
+			t.Errorf("%s: expected %v, got %v", name, expected, got)
+		}
+	}
+	if filter.acceptName("other", "items") {
+		t.Error("db.table pattern should not match other databases")
+	}
+	if !filter.acceptType("EXTERNAL_TABLE") || filter.acceptType("MANAGED_TABLE") {
+		t.Error("table type is not filtered")
+	}
+
+	var nilFilter *exportFilter
+	if !nilFilter.acceptName("sales", "orders") || !nilFilter.acceptType("VIRTUAL_VIEW") {
+		t.Error("nil filter should accept everything")
+	}
+
+	cmd = &cobra.Command{}
+	addFilterFlags(cmd)
+	cmd.ParseFlags([]string{"--no-partitions", "--partition-filter", "ds > 1"})
+	if _, err = newExportFilter(cmd); err == nil {
+		t.Error("conflicting partition options should be rejected")
+	}
+}
@@ -0,0 +1,378 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	optTemplate = "template"
+	optJSONPath = "jsonpath"
+
+	formatYAML     = "yaml"
+	formatTable    = "table"
+	formatCSV      = "csv"
+	formatTemplate = "template"
+	formatJSONPath = "jsonpath"
+)
+
+// column describes a single column of table and CSV output
+type column struct {
+	name  string
+	value func(item interface{}) string
+}
+
+// displaySection is a list of objects of the same kind
+type displaySection struct {
+	items   []interface{}
+	columns []column
+}
+
+// displayData is the output of a command. The object is rendered as JSON or YAML,
+// sections are rendered as tables or CSV, template and JSONPath are applied to
+// each item of each section. Text is the native output of the command.
+type displayData struct {
+	object   interface{}
+	sections []displaySection
+	text     func() string
+}
+
+// outputFormat returns output format selected by --format, --template or --jsonpath
+// flags. Empty format means the default format of the command.
+func outputFormat(cmd *cobra.Command, defaultFormat string) string {
+	format, _ := cmd.Flags().GetString(optFormat)
+	if format != "" {
+		return format
+	}
+	if t, _ := cmd.Flags().GetString(optTemplate); t != "" {
+		return formatTemplate
+	}
+	if p, _ := cmd.Flags().GetString(optJSONPath); p != "" {
+		return formatJSONPath
+	}
+	return defaultFormat
+}
+
+// display writes data in the format selected by command flags to the output file
+// or stdout. The defaultFormat is used when format is not specified.
+func display(cmd *cobra.Command, data *displayData, defaultFormat string) error {
+	format := outputFormat(cmd, defaultFormat)
+	toFile := viper.GetString(outputOpt) != ""
+	var text string
+	var err error
+	switch format {
+	case formatText:
+		if data.text == nil {
+			return fmt.Errorf("text format is not supported by this command")
+		}
+		text = data.text()
+	case formatJSON:
+		var b []byte
+		if toFile {
+			b, err = json.Marshal(data.object)
+		} else {
+			b, err = json.MarshalIndent(data.object, "", "  ")
+		}
+		text = string(b) + "\n"
+	case formatYAML:
+		text, err = renderYAML(data.object)
+	case formatTable:
+		text = renderTable(data.sections)
+	case formatCSV:
+		text, err = renderCSV(data.sections)
+	case formatTemplate:
+		t, _ := cmd.Flags().GetString(optTemplate)
+		text, err = renderTemplate(t, data.sections)
+	case formatJSONPath:
+		p, _ := cmd.Flags().GetString(optJSONPath)
+		text, err = renderJSONPath(p, data.sections)
+	default:
+		return fmt.Errorf("unsupported format %s, should be one of %s, %s, %s, %s, %s or %s",
+			format, formatJSON, formatYAML, formatTable, formatCSV, formatTemplate, formatJSONPath)
+	}
+	if err != nil {
+		return err
+	}
+	displayText(text)
+	return nil
+}
+
+// renderYAML converts object to JSON first, so that field names are the same as in JSON
+func renderYAML(object interface{}) (string, error) {
+	generic, err := toGeneric(object)
+	if err != nil {
+		return "", err
+	}
+	b, err := yaml.Marshal(generic)
+	return string(b), err
+}
+
+// toGeneric converts object to the generic form produced by JSON decoding
+func toGeneric(object interface{}) (interface{}, error) {
+	b, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	err = json.Unmarshal(b, &generic)
+	return generic, err
+}
+
+func renderTable(sections []displaySection) string {
+	var b bytes.Buffer
+	for i, s := range sections {
+		if i != 0 {
+			b.WriteString("\n")
+		}
+		w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		names := make([]string, len(s.columns))
+		for j, c := range s.columns {
+			names[j] = c.name
+		}
+		fmt.Fprintln(w, strings.Join(names, "\t"))
+		for _, item := range s.items {
+			fmt.Fprintln(w, strings.Join(rowValues(s.columns, item), "\t"))
+		}
+		w.Flush()
+	}
+	return b.String()
+}
+
+func renderCSV(sections []displaySection) (string, error) {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	for _, s := range sections {
+		names := make([]string, len(s.columns))
+		for j, c := range s.columns {
+			names[j] = strings.ToLower(strings.Replace(c.name, " ", "_", -1))
+		}
+		w.Write(names)
+		for _, item := range s.items {
+			w.Write(rowValues(s.columns, item))
+		}
+	}
+	w.Flush()
+	return b.String(), w.Error()
+}
+
+func rowValues(columns []column, item interface{}) []string {
+	values := make([]string, len(columns))
+	for i, c := range columns {
+		values[i] = c.value(item)
+	}
+	return values
+}
+
+// renderTemplate executes Go template for each item. A newline is added after
+// each item unless the template ends with one.
+func renderTemplate(text string, sections []displaySection) (string, error) {
+	if text == "" {
+		return "", fmt.Errorf("--%s should be specified", optTemplate)
+	}
+	t, err := template.New("output").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template: %v", err)
+	}
+	var b bytes.Buffer
+	for _, s := range sections {
+		for _, item := range s.items {
+			if err = t.Execute(&b, item); err != nil {
+				return "", err
+			}
+			if !strings.HasSuffix(text, "\n") {
+				b.WriteString("\n")
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+// renderJSONPath evaluates JSONPath expression on the JSON form of each item
+// and prints results separated by spaces, one line per item.
+func renderJSONPath(expr string, sections []displaySection) (string, error) {
+	if expr == "" {
+		return "", fmt.Errorf("--%s should be specified", optJSONPath)
+	}
+	path, err := parseJSONPath(expr)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	for _, s := range sections {
+		for _, item := range s.items {
+			generic, err := toGeneric(item)
+			if err != nil {
+				return "", err
+			}
+			results := path.eval(generic)
+			values := make([]string, len(results))
+			for i, r := range results {
+				if str, ok := r.(string); ok {
+					values[i] = str
+				} else {
+					v, _ := json.Marshal(r)
+					values[i] = string(v)
+				}
+			}
+			b.WriteString(strings.Join(values, " "))
+			b.WriteString("\n")
+		}
+	}
+	return b.String(), nil
+}
+
+// Columns for common objects
+
+var nameColumns = []column{
+	{"NAME", func(item interface{}) string { return item.(string) }},
+}
+
+var databaseColumns = []column{
+	{"NAME", func(item interface{}) string { return item.(*hmsclient.Database).Name }},
+	{"OWNER", func(item interface{}) string { return item.(*hmsclient.Database).Owner }},
+	{"LOCATION", func(item interface{}) string { return item.(*hmsclient.Database).Location }},
+	{"DESCRIPTION", func(item interface{}) string { return item.(*hmsclient.Database).Description }},
+}
+
+var tableColumns = []column{
+	{"NAME", func(item interface{}) string {
+		t := item.(*hive_metastore.Table)
+		return t.DbName + "." + t.TableName
+	}},
+	{"TYPE", func(item interface{}) string { return item.(*hive_metastore.Table).TableType }},
+	{"OWNER", func(item interface{}) string { return item.(*hive_metastore.Table).Owner }},
+	{"PARTITION KEYS", func(item interface{}) string {
+		keys := item.(*hive_metastore.Table).PartitionKeys
+		names := make([]string, len(keys))
+		for i, k := range keys {
+			names[i] = k.Name
+		}
+		return strings.Join(names, ",")
+	}},
+	{"LOCATION", func(item interface{}) string { return sdLocation(item.(*hive_metastore.Table).Sd) }},
+}
+
+var partitionColumns = []column{
+	{"TABLE", func(item interface{}) string {
+		p := item.(*hive_metastore.Partition)
+		return p.DbName + "." + p.TableName
+	}},
+	{"VALUES", func(item interface{}) string {
+		return strings.Join(item.(*hive_metastore.Partition).Values, "/")
+	}},
+	{"CREATED", func(item interface{}) string {
+		return formatTime(item.(*hive_metastore.Partition).CreateTime)
+	}},
+	{"LOCATION", func(item interface{}) string {
+		return sdLocation(item.(*hive_metastore.Partition).Sd)
+	}},
+}
+
+// sdLocation returns location of the storage descriptor which may be nil
+func sdLocation(sd *hive_metastore.StorageDescriptor) string {
+	if sd == nil {
+		return ""
+	}
+	return sd.Location
+}
+
+// formatTime formats HMS timestamp in seconds
+func formatTime(seconds int32) string {
+	if seconds == 0 {
+		return ""
+	}
+	return time.Unix(int64(seconds), 0).UTC().Format(time.RFC3339)
+}
+
+// namesData returns display data for the list of names
+func namesData(names []string) *displayData {
+	items := make([]interface{}, len(names))
+	for i, name := range names {
+		items[i] = name
+	}
+	if names == nil {
+		names = []string{}
+	}
+	return &displayData{
+		object:   names,
+		sections: []displaySection{{items: items, columns: nameColumns}},
+		text: func() string {
+			var b strings.Builder
+			for _, name := range names {
+				b.WriteString(name)
+				b.WriteString("\n")
+			}
+			return b.String()
+		},
+	}
+}
+
+// objectData returns display data for HMS objects
+func objectData(hmsObject *HmsObject) *displayData {
+	data := &displayData{object: hmsObject}
+	if len(hmsObject.Databases) != 0 {
+		items := make([]interface{}, len(hmsObject.Databases))
+		for i, db := range hmsObject.Databases {
+			items[i] = db
+		}
+		data.sections = append(data.sections, displaySection{items: items, columns: databaseColumns})
+	}
+	if len(hmsObject.Tables) != 0 {
+		items := make([]interface{}, len(hmsObject.Tables))
+		for i, t := range hmsObject.Tables {
+			items[i] = t
+		}
+		data.sections = append(data.sections, displaySection{items: items, columns: tableColumns})
+	}
+	if len(hmsObject.Partitions) != 0 {
+		items := make([]interface{}, len(hmsObject.Partitions))
+		for i, p := range hmsObject.Partitions {
+			items[i] = p
+		}
+		data.sections = append(data.sections, displaySection{items: items, columns: partitionColumns})
+	}
+	return data
+}
+
+// displayNames displays list of names, by default one name per line
+func displayNames(cmd *cobra.Command, names []string) {
+	if err := display(cmd, namesData(names), formatText); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().String(optFormat, "",
+		"output format: json, yaml, table, csv, template or jsonpath (default depends on command)")
+	rootCmd.PersistentFlags().String(optTemplate, "",
+		"Go template applied to each object, e.g. '{{.DbName}}.{{.TableName}}'")
+	rootCmd.PersistentFlags().String(optJSONPath, "",
+		"JSONPath expression applied to each object, e.g. '{.tableName}'")
+}
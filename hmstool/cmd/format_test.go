@@ -0,0 +1,99 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+)
+
+func TestJSONPath(t *testing.T) {
+	data, _ := toGeneric(map[string]interface{}{
+		"name": "orders",
+		"cols": []map[string]string{{"name": "id"}, {"name": "amount"}},
+		"parameters": map[string]string{
+			"b": "2",
+			"a": "1",
+		},
+	})
+	tests := map[string][]interface{}{
+		"{.name}":            {"orders"},
+		"$.cols[*].name":     {"id", "amount"},
+		".cols[-1].name":     {"amount"},
+		".parameters.*":      {"1", "2"},
+		"{['parameters'].b}": {"2"},
+		".missing":           nil,
+	}
+	for expr, expected := range tests {
+		path, err := parseJSONPath(expr)
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+			continue
+		}
+		if got := path.eval(data); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected %v, got %v", expr, expected, got)
+		}
+	}
+	for _, expr := range []string{".cols[x]", ".cols[0", "name", ".."} {
+		if _, err := parseJSONPath(expr); err == nil {
+			t.Errorf("%s: expected error", expr)
+		}
+	}
+}
+
+func TestRenderFormats(t *testing.T) {
+	data := objectData(&HmsObject{Tables: []*hive_metastore.Table{
+		{DbName: "sales", TableName: "orders", TableType: "EXTERNAL_TABLE",
+			PartitionKeys: []*hive_metastore.FieldSchema{{Name: "ds"}, {Name: "hr"}},
+			Sd:            &hive_metastore.StorageDescriptor{Location: "/data/orders"}},
+		{DbName: "sales", TableName: "v", TableType: "VIRTUAL_VIEW"},
+	}})
+	expected := "NAME          TYPE            OWNER  PARTITION KEYS  LOCATION\n" +
+		"sales.orders  EXTERNAL_TABLE         ds,hr           /data/orders\n" +
+		"sales.v       VIRTUAL_VIEW                           \n"
+	if got := renderTable(data.sections); got != expected {
+		t.Errorf("expected table\n%s\ngot\n%s", expected, got)
+	}
+	csv, err := renderCSV(data.sections)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "name,type,owner,partition_keys,location\n" +
+		"sales.orders,EXTERNAL_TABLE,,\"ds,hr\",/data/orders\n" +
+		"sales.v,VIRTUAL_VIEW,,,\n"
+	if csv != expected {
+		t.Errorf("expected csv\n%s\ngot\n%s", expected, csv)
+	}
+	text, err := renderTemplate("{{.DbName}}.{{.TableName}}", data.sections)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "sales.orders\nsales.v\n" {
+		t.Errorf("unexpected template output %q", text)
+	}
+	text, err = renderJSONPath("{.partitionKeys[*].name}", data.sections)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "ds hr\n\n" {
+		t.Errorf("unexpected jsonpath output %q", text)
+	}
+	text, err = renderYAML(namesData([]string{"a", "b"}).object)
+	if err != nil || text != "- a\n- b\n" {
+		t.Errorf("unexpected yaml output %q: %v", text, err)
+	}
+}
@@ -0,0 +1,365 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmstool/hmsutil"
+	"github.com/spf13/cobra"
+)
+
+const (
+	optRoot          = "root"
+	optDeleteOrphans = "delete-orphans"
+
+	problemOrphan        = "orphan"
+	problemEmptyLocation = "empty location"
+	problemMissing       = "missing location"
+)
+
+var fsckCmd = &cobra.Command{
+	Use:   "fsck",
+	Short: "find orphan directories and dangling locations",
+	Run:   fsck,
+	Long: `Check consistency between HMS and storage.
+
+Two kinds of problems are reported:
+
+- orphan directories which are not referenced by any HMS table or partition,
+  usually left behind by dropped tables and partitions;
+- tables and partitions with empty location or location which does not exist.
+
+Directories are scanned under the warehouse root specified by --root or, when the
+root is not specified, under locations of the databases checked with -d. References
+from all databases are always collected, since the scanned directories may hold data
+of other databases: the location of the default database is usually the warehouse
+root, and external tables may be stored anywhere. The -d option only selects tables
+and partitions checked for dangling locations. Directories which
+are locations of unpartitioned tables or partitions are not scanned further, so
+subdirectories of table data are never reported. Hidden directories (starting with
+'.' or '_') are ignored. Locations are compared by path, ignoring scheme and host.
+
+With --delete-orphans the orphan directories are deleted. By default this is a dry
+run which only shows what would be deleted, use --dry-run=false to actually delete
+directories.
+
+Examples:
+
+    hmstool fsck --root hdfs://namenode:8020/user/hive/warehouse
+    hmstool fsck -d sales --format json
+    hmstool fsck --root file:///data/warehouse --delete-orphans --dry-run=false
+`,
+}
+
+// fsckEntry is a single problem found by fsck
+type fsckEntry struct {
+	Problem  string `json:"problem"`
+	Name     string `json:"name,omitempty"` // Table or partition name for dangling locations
+	Location string `json:"location"`
+	dbName   string // Database of the table or partition
+}
+
+var fsckColumns = []column{
+	{"PROBLEM", func(item interface{}) string { return item.(*fsckEntry).Problem }},
+	{"NAME", func(item interface{}) string { return item.(*fsckEntry).Name }},
+	{"LOCATION", func(item interface{}) string { return item.(*fsckEntry).Location }},
+}
+
+// storageRefs is the set of locations referenced by HMS objects, keyed by path.
+type storageRefs struct {
+	data       map[string]bool // Locations of table or partition data
+	containers map[string]bool // Locations containing other locations: databases and partitioned tables
+	objects    []*fsckEntry    // All tables and partitions with their locations
+}
+
+func fsck(cmd *cobra.Command, _ []string) {
+	client, err := getClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+
+	dbNames, _ := cmd.Flags().GetStringSlice(optDbName)
+	root, _ := cmd.Flags().GetString(optRoot)
+	workers, _ := cmd.Flags().GetInt(optWorkers)
+	problems, orphans, err := checkStorage(client, dbNames, root, workers)
+	if err != nil {
+		log.Fatal(err)
+	}
+	problems = append(problems, orphans...)
+
+	items := make([]interface{}, len(problems))
+	for i, p := range problems {
+		items[i] = p
+	}
+	data := &displayData{
+		object:   problems,
+		sections: []displaySection{{items: items, columns: fsckColumns}},
+	}
+	if err = display(cmd, data, formatTable); err != nil {
+		log.Fatal(err)
+	}
+
+	if del, _ := cmd.Flags().GetBool(optDeleteOrphans); !del || len(orphans) == 0 {
+		return
+	}
+	if dryRun, _ := cmd.Flags().GetBool(optDryRun); dryRun {
+		fmt.Printf("Would delete %d orphan directories, use --%s=false to delete them\n",
+			len(orphans), optDryRun)
+		return
+	}
+	if yes, _ := cmd.Flags().GetBool(optYes); !yes &&
+		!confirm(fmt.Sprintf("Delete %d orphan directories?", len(orphans))) {
+		fmt.Println("Delete cancelled")
+		return
+	}
+	if err = deleteOrphans(orphans); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// checkStorage returns dangling locations of tables and partitions in the given
+// databases (all databases when empty) and orphan directories. Orphans are searched
+// under root or, when root is empty, under locations of the given databases. Scanned
+// directories may hold data of any database, so all databases are referenced.
+func checkStorage(client metastoreReader, dbNames []string, root string,
+	workers int) (dangling []*fsckEntry, orphans []*fsckEntry, err error) {
+	allNames, err := client.GetAllDatabases()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get databases: %v", err)
+	}
+	if len(dbNames) == 0 {
+		dbNames = allNames
+	}
+	refs, err := collectRefs(client, allNames)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var roots []string
+	if root != "" {
+		roots = []string{root}
+	} else {
+		for _, dbName := range dbNames {
+			db, err := client.GetDatabase(dbName)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to get database %s: %v", dbName, err)
+			}
+			roots = append(roots, db.Location)
+		}
+	}
+	for _, root := range roots {
+		found, err := refs.orphans(root)
+		if err != nil {
+			return nil, nil, err
+		}
+		orphans = append(orphans, found...)
+	}
+
+	// Only objects of the checked databases are verified
+	selected := stringSet(dbNames)
+	var objects []*fsckEntry
+	for _, o := range refs.objects {
+		if selected[o.dbName] {
+			objects = append(objects, o)
+		}
+	}
+	refs.objects = objects
+	if dangling, err = refs.danglingLocations(workers); err != nil {
+		return nil, nil, err
+	}
+	return dangling, orphans, nil
+}
+
+// collectRefs collects locations of databases, tables and partitions
+func collectRefs(client metastoreReader, dbNames []string) (*storageRefs, error) {
+	refs := &storageRefs{data: make(map[string]bool), containers: make(map[string]bool)}
+	for _, dbName := range dbNames {
+		db, err := client.GetDatabase(dbName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get database %s: %v", dbName, err)
+		}
+		refs.add(refs.containers, db.Location)
+		tableNames, err := client.GetAllTables(dbName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get tables for %s: %v", dbName, err)
+		}
+		for _, tableName := range tableNames {
+			table, err := client.GetTable(dbName, tableName)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get table %s.%s: %v", dbName, tableName, err)
+			}
+			if table.TableType == hmsclient.TableTypeView.String() {
+				continue
+			}
+			name := dbName + "." + tableName
+			location := sdLocation(table.Sd)
+			refs.objects = append(refs.objects, &fsckEntry{Name: name, Location: location, dbName: dbName})
+			if len(table.PartitionKeys) == 0 {
+				refs.add(refs.data, location)
+				continue
+			}
+			refs.add(refs.containers, location)
+			partitions, err := tablePartitions(client, dbName, tableName)
+			if err != nil {
+				return nil, err
+			}
+			keys := make([]string, len(table.PartitionKeys))
+			for i, k := range table.PartitionKeys {
+				keys[i] = k.Name
+			}
+			for _, p := range partitions {
+				location := sdLocation(p.Sd)
+				refs.objects = append(refs.objects,
+					&fsckEntry{Name: name + "/" + hmsclient.MakePartName(keys, p.Values),
+						Location: location, dbName: dbName})
+				refs.add(refs.data, location)
+			}
+		}
+	}
+	return refs, nil
+}
+
+// add adds location and all its parent directories to refs
+func (refs *storageRefs) add(set map[string]bool, location string) {
+	if location == "" {
+		return
+	}
+	p := locationPath(location)
+	set[p] = true
+	// Parents of referenced locations are never orphans
+	for p != "/" && p != "." {
+		p = path.Dir(p)
+		refs.containers[p] = true
+	}
+}
+
+// locationPath returns path of the location without trailing slash
+func locationPath(location string) string {
+	_, p, err := hmsutil.GetHostLocation(location)
+	if err != nil || p == "" {
+		p = location
+	}
+	return path.Clean(p)
+}
+
+// danglingLocations checks locations of all tables and partitions concurrently
+// and returns objects with empty or missing locations.
+func (refs *storageRefs) danglingLocations(workers int) ([]*fsckEntry, error) {
+	problems := make([]string, len(refs.objects))
+	err := runParallel(workers, len(refs.objects), func(i int) error {
+		o := refs.objects[i]
+		if o.Location == "" {
+			problems[i] = problemEmptyLocation
+			return nil
+		}
+		fs, err := hmsutil.GetFileSystem(o.Location)
+		if err != nil {
+			return fmt.Errorf("%s: %v", o.Name, err)
+		}
+		_, err = fs.Stat(o.Location)
+		if os.IsNotExist(err) {
+			problems[i] = problemMissing
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to check %s for %s: %v", o.Location, o.Name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var result []*fsckEntry
+	for i, o := range refs.objects {
+		if problems[i] != "" {
+			result = append(result, &fsckEntry{Problem: problems[i], Name: o.Name, Location: o.Location})
+		}
+	}
+	return result, nil
+}
+
+// orphans walks the root and returns directories not referenced by HMS
+func (refs *storageRefs) orphans(root string) ([]*fsckEntry, error) {
+	if root == "" {
+		return nil, nil
+	}
+	fs, err := hmsutil.GetFileSystem(root)
+	if err != nil {
+		return nil, err
+	}
+	var result []*fsckEntry
+	err = fs.Walk(root, func(info hmsutil.FileInfo) error {
+		if !info.IsDir {
+			return nil
+		}
+		if isHidden(info.Name) {
+			return hmsutil.SkipDir
+		}
+		p := locationPath(info.Path)
+		switch {
+		case refs.data[p]:
+			return hmsutil.SkipDir
+		case refs.containers[p]:
+			return nil
+		}
+		result = append(result, &fsckEntry{Problem: problemOrphan, Location: info.Path})
+		return hmsutil.SkipDir
+	})
+	if os.IsNotExist(err) {
+		log.Printf("skipping %s: %v", root, err)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %v", root, err)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Location < result[j].Location })
+	return result, nil
+}
+
+// deleteOrphans deletes orphan directories with all their contents
+func deleteOrphans(orphans []*fsckEntry) error {
+	for _, o := range orphans {
+		if strings.Trim(locationPath(o.Location), "/.") == "" {
+			return fmt.Errorf("refusing to delete %s", o.Location)
+		}
+		fs, err := hmsutil.GetFileSystem(o.Location)
+		if err != nil {
+			return err
+		}
+		log.Println("Deleting", o.Location)
+		if err = fs.RemoveAll(o.Location); err != nil {
+			return fmt.Errorf("failed to delete %s: %v", o.Location, err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	fsckCmd.Flags().StringSliceP(optDbName, "d", nil, "databases to check (default all)")
+	fsckCmd.Flags().String(optRoot, "", "warehouse root to scan for orphan directories (default database locations)")
+	fsckCmd.Flags().Int(optWorkers, 8, "number of locations checked concurrently")
+	fsckCmd.Flags().Bool(optDeleteOrphans, false, "delete orphan directories")
+	fsckCmd.Flags().Bool(optDryRun, true, "only show orphan directories which would be deleted")
+	fsckCmd.Flags().BoolP(optYes, "y", false, "do not ask for confirmation")
+	rootCmd.AddCommand(fsckCmd)
+}
@@ -0,0 +1,156 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+)
+
+func TestFsck(t *testing.T) {
+	dir := t.TempDir()
+	for _, d := range []string{"sales.db/orders/ds=1", "sales.db/orders/ds=9", "sales.db/orders/_tmp",
+		"sales.db/items/sub", "sales.db/old", "sales.db/.hive-staging", "dropped.db/t"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.FromSlash(d)), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root := "file://" + filepath.ToSlash(dir)
+	orders, ordersParts := deltaTestTable("orders", "1", "2")
+	orders.Sd.Location = root + "/sales.db/orders"
+	for _, p := range ordersParts {
+		p.Sd.Location = orders.Sd.Location + "/ds=" + p.Values[0]
+	}
+	items := &hive_metastore.Table{DbName: "sales", TableName: "items",
+		Sd: &hive_metastore.StorageDescriptor{Location: root + "/sales.db/items/"}}
+	broken := &hive_metastore.Table{DbName: "sales", TableName: "broken"}
+	view := &hive_metastore.Table{DbName: "sales", TableName: "recent",
+		TableType: hmsclient.TableTypeView.String()}
+	catalog := &fakeCatalog{
+		databases: map[string]*hmsclient.Database{"sales": {Name: "sales", Location: root + "/sales.db"}},
+		tables: map[string]map[string]*hive_metastore.Table{
+			"sales": {"orders": orders, "items": items, "broken": broken, "recent": view}},
+		partitions: map[string][]*hive_metastore.Partition{"sales.orders": ordersParts},
+	}
+
+	refs, err := collectRefs(catalog, []string{"sales"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dangling, err := refs.danglingLocations(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems := map[string]string{}
+	for _, d := range dangling {
+		problems[d.Name] = d.Problem
+	}
+	expected := map[string]string{"sales.broken": problemEmptyLocation, "sales.orders/ds=2": problemMissing}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Errorf("expected dangling %v, got %v", expected, problems)
+	}
+
+	orphans, err := refs.orphans(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var locations []string
+	for _, o := range orphans {
+		locations = append(locations, o.Location)
+	}
+	expectedOrphans := []string{root + "/dropped.db", root + "/sales.db/old", root + "/sales.db/orders/ds=9"}
+	if !reflect.DeepEqual(locations, expectedOrphans) {
+		t.Errorf("expected orphans %v, got %v", expectedOrphans, locations)
+	}
+
+	if err = deleteOrphans(orphans); err != nil {
+		t.Fatal(err)
+	}
+	if orphans, _ = refs.orphans(root); len(orphans) != 0 {
+		t.Errorf("expected no orphans after delete, got %v", orphans)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "sales.db", "items", "sub")); err != nil {
+		t.Errorf("table data should not be deleted: %v", err)
+	}
+}
+
+func TestFsckSelectedDatabases(t *testing.T) {
+	dir := t.TempDir()
+	for _, d := range []string{"sales.db/orders", "hr.db/people", "hr.db/old", "ext/events", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.FromSlash(d)), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root := "file://" + filepath.ToSlash(dir)
+	table := func(db string, name string) *hive_metastore.Table {
+		return &hive_metastore.Table{DbName: db, TableName: name,
+			Sd: &hive_metastore.StorageDescriptor{Location: root + "/" + db + ".db/" + name}}
+	}
+	catalog := &fakeCatalog{
+		databases: map[string]*hmsclient.Database{
+			"sales":   {Name: "sales", Location: root + "/sales.db"},
+			"hr":      {Name: "hr", Location: root + "/hr.db"},
+			"default": {Name: "default", Location: root},
+		},
+		tables: map[string]map[string]*hive_metastore.Table{
+			"sales": {"orders": table("sales", "orders")},
+			"hr": {"people": table("hr", "people"), "missing": table("hr", "missing"),
+				"events": {DbName: "hr", TableName: "events",
+					Sd: &hive_metastore.StorageDescriptor{Location: root + "/ext/events"}}},
+		},
+	}
+
+	// Directories of other databases under the root are referenced
+	dangling, orphans, err := checkStorage(catalog, []string{"sales"}, root, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dangling) != 0 {
+		t.Errorf("expected no dangling locations in sales, got %v", dangling)
+	}
+	if len(orphans) != 2 || orphans[0].Location != root+"/hr.db/old" || orphans[1].Location != root+"/tmp" {
+		t.Errorf("expected only hr.db/old and tmp to be orphans, got %v", orphans)
+	}
+
+	// Without root only locations of the selected databases are scanned
+	dangling, orphans, err = checkStorage(catalog, []string{"hr"}, "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dangling) != 1 || dangling[0].Name != "hr.missing" {
+		t.Errorf("expected hr.missing to be dangling, got %v", dangling)
+	}
+	if len(orphans) != 1 || orphans[0].Location != root+"/hr.db/old" {
+		t.Errorf("expected only hr.db/old to be orphan, got %v", orphans)
+	}
+
+	// Location of the default database is the warehouse root holding other databases
+	if _, orphans, err = checkStorage(catalog, []string{"default"}, "", 2); err != nil {
+		t.Fatal(err)
+	}
+	var locations []string
+	for _, o := range orphans {
+		locations = append(locations, o.Location)
+	}
+	expected := []string{root + "/hr.db/old", root + "/tmp"}
+	if !reflect.DeepEqual(locations, expected) {
+		t.Errorf("expected orphans %v, got %v", expected, locations)
+	}
+}
@@ -1,10 +1,14 @@
 package cmd
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/akolb1/gometastore/hmsclient"
 	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
@@ -14,163 +18,615 @@ import (
 const (
 	trueValue     = "true"
 	externalTable = "EXTERNAL"
+
+	optKeepManaged = "keep-managed"
+	optWorkers     = "workers"
+	optJournal     = "journal"
+	optOnConflict  = "on-conflict"
+
+	conflictSkip    = "skip"
+	conflictReplace = "replace"
+	conflictFail    = "fail"
+
+	resultCreated  = "created"
+	resultReplaced = "replaced"
+	resultSkipped  = "skipped"
+	resultFailed   = "failed"
+	resultDropped  = "dropped"
+
+	journalSuffix = ".journal"
 )
 
-// dbCmd represents the db command
 var importCmd = &cobra.Command{
 	Use:   "import",
 	Short: "import HMS data",
 	Run:   importData,
 	Long: `
-Import HMS databases or tables from JSON dump produced by export command.
+Import HMS databases or tables from JSON or NDJSON dump produced by export command.
+Format and compression of the dump are detected automatically.
 All managed tables are converted to external tables during import and location points to the
-original location.
+original location. Use --keep-managed to preserve table types.
+
+Database locations are not imported, so HMS uses its default location for new databases.
+When data has moved, locations can be rewritten with --rewrite-location old=new.
+The flag can be repeated, the longest matching prefix is used. Rewrites apply to
+database, table and partition locations; databases with rewritten location keep it.
+
+Tables are imported concurrently by --workers workers, partitions are added in
+batches. Each batch is added atomically by HMS.
+
+Objects which already exist are handled according to --on-conflict:
+
+    skip     keep existing object (default)
+    replace  replace existing object with the imported one
+    fail     report existing object as a failure and skip its contents
+
+Completed databases, tables and partitions are recorded in the journal file (by
+default the input file name with .journal suffix). When import is repeated, objects
+recorded in the journal are skipped, so a failed import can be simply rerun.
+The journal is removed once the file is imported without failures, so a new file
+with the same name is imported from scratch. Remove the journal to import
+everything again after a failed import.
+
+Delta produced by export --since-event is applied on top of the previous import.
+Dropped objects are dropped first, without deleting their data. Objects which
+already exist are replaced unless --on-conflict is specified explicitly.
+
+Import ends with a summary of created, replaced, skipped and failed objects.
 
 Example:
 
     hmstool import tables.json
+    hmstool import tables.json --workers 8 --on-conflict replace
+    hmstool import tables.json --rewrite-location hdfs://old-nn:8020/data=s3a://bucket/data
+    hmstool import delta.ndjson.gz
 `,
 }
 
+// importOptions control how objects are transformed during import
+type importOptions struct {
+	rewriter    locationRewriter
+	keepManaged bool
+	onConflict  string
+	conflictSet bool // --on-conflict is specified explicitly
+	workers     int
+	batchSize   int
+}
+
+// importTarget is the metastore receiving imported objects
+type importTarget interface {
+	GetAllDatabases() ([]string, error)
+	GetDatabase(dbName string) (*hmsclient.Database, error)
+	CreateDatabase(db *hmsclient.Database) error
+	AlterDatabase(dbName string, db *hmsclient.Database) error
+	GetTable(dbName string, tableName string) (*hive_metastore.Table, error)
+	CreateTable(table *hive_metastore.Table) error
+	AlterTable(dbName string, tableName string, table *hive_metastore.Table) error
+	AddPartitions(newParts []*hive_metastore.Partition) error
+	AlterPartitions(dbName string, tableName string, partitions []*hive_metastore.Partition) error
+	DropDatabase(dbName string, deleteData bool, cascade bool) error
+	DropTable(dbName string, tableName string, deleteData bool) error
+	DropPartition(dbName string, tableName string, values []string, deleteData bool) (bool, error)
+	Close()
+}
+
+// tableJob is a unit of work for import workers - a table and batches of its partitions.
+// Table is nil when only partitions of the table are imported.
+type tableJob struct {
+	dbName    string
+	tableName string
+	table     *hive_metastore.Table
+	batches   chan []*hive_metastore.Partition
+}
+
+// importer imports objects into the target metastore
+type importer struct {
+	opts    *importOptions
+	target  importTarget
+	connect func() (importTarget, error) // Creates connections for workers
+	journal *importJournal
+	report  *importReport
+	delta   bool // Importing delta, existing objects are replaced by default
+
+	mu        sync.Mutex
+	databases map[string]bool // Databases available for tables
+}
+
 func importData(cmd *cobra.Command, args []string) {
-	client, err := getClient()
+	opts, err := newImportOptions(cmd)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer client.Close()
+	journalName, _ := cmd.Flags().GetString(optJournal)
 
-	dbs, err := getDatabases(client)
+	client, err := getClient()
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer client.Close()
 
+	report := newImportReport()
 	for _, arg := range args {
-		err = doImport(client, dbs, arg)
+		fileName := journalName
+		if fileName == "" {
+			fileName = arg + journalSuffix
+		}
+		journal, err := openJournal(fileName)
 		if err != nil {
-			log.Println("failed to import", arg, err)
+			log.Fatal(err)
 		}
+		newImporter(client, opts, journal, report).importJournaled(arg)
+	}
+	fmt.Print(report)
+	if report.failed() {
+		os.Exit(1)
 	}
 }
 
-func doImport(client *hmsclient.MetastoreClient, dbMap map[string]bool, fileName string) error {
-	raw, err := ioutil.ReadFile(fileName)
+// newImportOptions creates import options from command flags
+func newImportOptions(cmd *cobra.Command) (*importOptions, error) {
+	rewrites, _ := cmd.Flags().GetStringArray(optRewriteLocation)
+	rewriter, err := newLocationRewriter(rewrites)
 	if err != nil {
-		return fmt.Errorf("failed to read file%s: %s", fileName, err.Error())
+		return nil, err
 	}
-	var hms HmsObject
-	err = json.Unmarshal(raw, &hms)
-	if err != nil {
-		return fmt.Errorf("failed to parse file%s: %s", fileName, err.Error())
+	opts := &importOptions{rewriter: rewriter, batchSize: maxParts}
+	opts.keepManaged, _ = cmd.Flags().GetBool(optKeepManaged)
+	opts.workers, _ = cmd.Flags().GetInt(optWorkers)
+	opts.onConflict, _ = cmd.Flags().GetString(optOnConflict)
+	opts.conflictSet = cmd.Flags().Changed(optOnConflict)
+	switch opts.onConflict {
+	case conflictSkip, conflictReplace, conflictFail:
+	default:
+		return nil, fmt.Errorf("invalid --%s value %s, should be %s, %s or %s", optOnConflict,
+			opts.onConflict, conflictSkip, conflictReplace, conflictFail)
+	}
+	if opts.workers < 1 {
+		opts.workers = 1
 	}
+	return opts, nil
+}
+
+// newImporter creates importer which uses clones of the client for workers
+func newImporter(client *hmsclient.MetastoreClient, opts *importOptions,
+	journal *importJournal, report *importReport) *importer {
+	return &importer{
+		opts:   opts,
+		target: client,
+		connect: func() (importTarget, error) {
+			c, err := client.Clone()
+			if err != nil {
+				return nil, err
+			}
+			return c, nil
+		},
+		journal: journal,
+		report:  report,
+	}
+}
 
-	err = importDb(client, dbMap, hms.Databases)
+// importJournaled imports file and removes the journal when the file is imported
+// without failures. The journal is kept for resuming the import otherwise.
+func (im *importer) importJournaled(fileName string) {
+	failures := im.report.failureCount()
+	if err := im.importFile(fileName); err != nil {
+		im.report.fail("file", fileName, err)
+	}
+	if im.report.failureCount() != failures {
+		im.journal.Close()
+		return
+	}
+	if err := im.journal.remove(); err != nil {
+		log.Println(err)
+	}
+}
+
+// importFile imports objects from JSON or NDJSON dump produced by export.
+// Format and compression are detected automatically.
+func (im *importer) importFile(fileName string) error {
+	f, err := os.Open(fileName)
 	if err != nil {
-		return fmt.Errorf("failed to import databases from %s: %s", fileName, err.Error())
+		return fmt.Errorf("failed to read file %s: %s", fileName, err.Error())
 	}
-	// Cached table names
-	tableMap := make(map[string]bool)
-	err = importTables(client, dbMap, tableMap, hms.Tables)
+	defer f.Close()
+	r, err := newDecompressingReader(f)
 	if err != nil {
-		return fmt.Errorf("failed to import tables from %s: %s", fileName, err.Error())
+		return fmt.Errorf("failed to read file %s: %s", fileName, err.Error())
 	}
-	err = importPartitions(client, dbMap, tableMap, hms.Partitions)
+	if isNDJSON(r) {
+		if err = im.importStream(r); err != nil {
+			return fmt.Errorf("failed to import file %s: %s", fileName, err.Error())
+		}
+		return nil
+	}
+	var hms HmsObject
+	err = json.NewDecoder(r).Decode(&hms)
 	if err != nil {
-		return fmt.Errorf("failed to import partitions from %s: %s", fileName, err.Error())
+		return fmt.Errorf("failed to parse file %s: %s", fileName, err.Error())
 	}
-	return nil
+	return im.importObjects(&hms)
 }
 
-func importDb(client *hmsclient.MetastoreClient,
-	dbMap map[string]bool,
-	dbs []*hmsclient.Database) error {
-	for _, db := range dbs {
-		if !dbMap[db.Name] {
-			// There may be issues with re-using location, so drop our location
-			db.Location = ""
-			if err := client.CreateDatabase(db); err != nil {
-				return fmt.Errorf("failed to create database %s: %s",
-					db.Name, err.Error())
+// importObjects imports databases, then tables and partitions in parallel.
+func (im *importer) importObjects(hms *HmsObject) error {
+	if err := im.start(); err != nil {
+		return err
+	}
+	if hms.Snapshot != nil && hms.Snapshot.Delta {
+		im.delta = true
+	}
+	for _, t := range hms.Tombstones {
+		im.applyTombstone(t)
+	}
+	for _, db := range hms.Databases {
+		im.importDatabase(db)
+	}
+
+	jobs := make(chan *tableJob)
+	var wg sync.WaitGroup
+	if err := im.startWorkers(jobs, &wg); err != nil {
+		return err
+	}
+
+	// Group partitions by table, preserving the original order of tables
+	partitions := make(map[string][]*hive_metastore.Partition)
+	var partitionTables []string
+	for _, p := range hms.Partitions {
+		fullName := p.DbName + "." + p.TableName
+		if _, ok := partitions[fullName]; !ok {
+			partitionTables = append(partitionTables, fullName)
+		}
+		partitions[fullName] = append(partitions[fullName], p)
+	}
+	// All partitions are in memory already, so jobs are created with enough
+	// capacity for all batches and never block the feeder.
+	submit := func(dbName string, tableName string, table *hive_metastore.Table) {
+		fullName := dbName + "." + tableName
+		parts := partitions[fullName]
+		job := newTableJob(dbName, tableName, table, len(parts)/im.opts.batchSize+1)
+		jobs <- job
+		for start := 0; start < len(parts); start += im.opts.batchSize {
+			end := start + im.opts.batchSize
+			if end > len(parts) {
+				end = len(parts)
 			}
-			dbMap[db.Name] = true
+			job.batches <- parts[start:end]
+		}
+		delete(partitions, fullName)
+		close(job.batches)
+	}
+	for _, table := range hms.Tables {
+		submit(table.DbName, table.TableName, table)
+	}
+	// Partitions of tables which are not part of the dump
+	for _, fullName := range partitionTables {
+		if parts, ok := partitions[fullName]; ok {
+			submit(parts[0].DbName, parts[0].TableName, nil)
 		}
 	}
+	close(jobs)
+	wg.Wait()
+	return nil
+}
 
+func newTableJob(dbName string, tableName string, table *hive_metastore.Table, capacity int) *tableJob {
+	return &tableJob{
+		dbName:    dbName,
+		tableName: tableName,
+		table:     table,
+		batches:   make(chan []*hive_metastore.Partition, capacity),
+	}
+}
+
+// start initializes the set of available databases
+func (im *importer) start() error {
+	databases, err := getDatabases(im.target)
+	if err != nil {
+		return err
+	}
+	im.databases = databases
 	return nil
 }
 
-func importTables(client *hmsclient.MetastoreClient,
-	dbMap map[string]bool,
-	tableMap map[string]bool,
-	tables []*hive_metastore.Table) error {
-	for _, table := range tables {
-		dbName := table.DbName
-		tableName := table.TableName
-		if !dbMap[dbName] {
-			log.Println("skipping", dbName, ".", tableName, "db is not available")
-			continue
+// startWorkers starts workers processing table jobs, each with its own connection.
+func (im *importer) startWorkers(jobs <-chan *tableJob, wg *sync.WaitGroup) error {
+	targets := make([]importTarget, im.opts.workers)
+	for i := range targets {
+		target, err := im.connect()
+		if err != nil {
+			for _, t := range targets[:i] {
+				t.Close()
+			}
+			return fmt.Errorf("failed to connect to HMS: %v", err)
 		}
-		fullTblName := dbName + "." + tableName
-		if tableMap[fullTblName] {
-			log.Println("skipping", dbName, ".", tableName, ": table exist already")
-			continue
+		targets[i] = target
+	}
+	for _, target := range targets {
+		wg.Add(1)
+		go func(target importTarget) {
+			defer wg.Done()
+			defer target.Close()
+			for job := range jobs {
+				im.importTable(target, job)
+			}
+		}(target)
+	}
+	return nil
+}
+
+// conflictPolicy returns handling of existing objects. Delta replaces existing
+// objects unless the policy is specified explicitly.
+func (im *importer) conflictPolicy() string {
+	if im.delta && !im.opts.conflictSet {
+		return conflictReplace
+	}
+	return im.opts.onConflict
+}
+
+func (im *importer) dbAvailable(dbName string) bool {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	return im.databases[dbName]
+}
+
+func (im *importer) setDbAvailable(dbName string, available bool) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	im.databases[dbName] = available
+}
+
+func (im *importer) importDatabase(db *hmsclient.Database) {
+	if im.journal.done(kindDatabase, db.Name) {
+		im.report.add(kindDatabase, resultSkipped, 1)
+		im.setDbAvailable(db.Name, true)
+		return
+	}
+	// There may be issues with re-using location, so drop our location
+	// unless it was explicitly rewritten
+	location, rewritten := im.opts.rewriter.rewrite(db.Location)
+	if !rewritten {
+		location = ""
+	}
+	newDb := *db
+	newDb.Location = location
+
+	result := resultCreated
+	var err error
+	if !im.dbAvailable(db.Name) {
+		log.Println("Adding database", db.Name)
+		err = im.target.CreateDatabase(&newDb)
+	} else {
+		switch im.conflictPolicy() {
+		case conflictSkip:
+			result = resultSkipped
+		case conflictReplace:
+			result = resultReplaced
+			if newDb.Location == "" {
+				if existing, err1 := im.target.GetDatabase(db.Name); err1 == nil {
+					newDb.Location = existing.Location
+				}
+			}
+			err = im.target.AlterDatabase(db.Name, &newDb)
+		case conflictFail:
+			err = fmt.Errorf("database already exists")
+		}
+	}
+	if err != nil {
+		im.report.fail(kindDatabase, db.Name, err)
+		im.setDbAvailable(db.Name, false)
+		return
+	}
+	im.report.add(kindDatabase, result, 1)
+	im.setDbAvailable(db.Name, true)
+	im.journal.record(kindDatabase, db.Name)
+}
+
+// importTable imports table and its partitions. Table is recorded in the journal once
+// it is created, partitions are recorded after each batch, so a rerun only imports
+// partitions which were not imported before.
+func (im *importer) importTable(target importTarget, job *tableJob) {
+	fullName := job.dbName + "." + job.tableName
+	// discard skips all remaining partitions of the table
+	discard := func(result string) {
+		for batch := range job.batches {
+			im.report.add(kindPartition, result, len(batch))
+		}
+	}
+	if im.journal.done(kindTable, fullName) {
+		if job.table != nil {
+			im.report.add(kindTable, resultSkipped, 1)
+		}
+	} else {
+		if !im.dbAvailable(job.dbName) {
+			im.report.fail(kindTable, fullName, fmt.Errorf("database %s is not available", job.dbName))
+			discard(resultFailed)
+			return
+		}
+		if err := im.putTable(target, job); err != nil {
+			im.report.fail(kindTable, fullName, err)
+			discard(resultFailed)
+			return
+		}
+		im.journal.record(kindTable, fullName)
+	}
+	for batch := range job.batches {
+		var pending []*hive_metastore.Partition
+		for _, p := range batch {
+			if !im.journal.done(kindPartition, partitionJournalName(p)) {
+				pending = append(pending, p)
+			}
 		}
-		tbl, err := client.GetTable(dbName, tableName)
-		if tbl != nil {
-			tableMap[fullTblName] = true
-			log.Println("skipping", dbName, ".", tableName, ": table exist already")
+		im.report.add(kindPartition, resultSkipped, len(batch)-len(pending))
+		if len(pending) == 0 {
 			continue
 		}
+		if err := im.addPartitions(target, job.dbName, job.tableName, pending); err != nil {
+			im.report.failure(kindPartition, fullName, fmt.Errorf("failed to add partitions: %v", err))
+			discard(resultFailed)
+			return
+		}
+	}
+}
+
+// partitionJournalName returns name of the partition in the journal
+func partitionJournalName(p *hive_metastore.Partition) string {
+	values := make([]string, len(p.Values))
+	for i, v := range p.Values {
+		values[i] = hmsclient.EscapePathName(v)
+	}
+	return p.DbName + "." + p.TableName + "/" + strings.Join(values, "/")
+}
+
+// putTable creates table or handles conflict with the existing one.
+// For jobs without table it verifies that the table exists.
+func (im *importer) putTable(target importTarget, job *tableJob) error {
+	_, err := target.GetTable(job.dbName, job.tableName)
+	exists := err == nil
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	if job.table == nil {
+		if !exists {
+			return fmt.Errorf("table doesn't exist")
+		}
+		return nil
+	}
+
+	table := job.table
+	if !im.opts.keepManaged {
 		if table.Parameters == nil {
 			table.Parameters = make(map[string]string)
 		}
 		table.Parameters[externalTable] = trueValue
+		if table.TableType == hmsclient.TableTypeManaged.String() {
+			table.TableType = hmsclient.TableTypeExternal.String()
+		}
+	}
+	if table.Sd != nil {
+		table.Sd.Location = im.opts.rewriter.Rewrite(table.Sd.Location)
+	}
 
-		log.Println("Adding table", dbName+"."+tableName)
-		err = client.CreateTable(table)
-		if err != nil {
-			return fmt.Errorf("failed to create table %s.%s: %s",
-				dbName, tableName, err.Error())
+	if !exists {
+		log.Println("Adding table", job.dbName+"."+job.tableName)
+		if err = target.CreateTable(table); err != nil {
+			return err
+		}
+		im.report.add(kindTable, resultCreated, 1)
+		return nil
+	}
+	switch im.conflictPolicy() {
+	case conflictReplace:
+		if err = target.AlterTable(job.dbName, job.tableName, table); err != nil {
+			return err
 		}
-		tableMap[fullTblName] = true
+		im.report.add(kindTable, resultReplaced, 1)
+	case conflictFail:
+		return fmt.Errorf("table already exists")
+	default:
+		im.report.add(kindTable, resultSkipped, 1)
 	}
 	return nil
 }
 
-func importPartitions(client *hmsclient.MetastoreClient,
-	dbMap map[string]bool,
-	tableMap map[string]bool,
-	partitions []*hive_metastore.Partition) error {
-	for _, partition := range partitions {
-		dbName := partition.DbName
-		tableName := partition.TableName
-		if !dbMap[dbName] {
-			log.Println("skipping", dbName, ".", tableName, "db is not available")
+// addPartitions adds a batch of partitions. If some partitions already exist,
+// partitions are added one by one and existing ones are handled according to the
+// conflict policy. Partitions which were not added because of error are reported as failed,
+// all others are recorded in the journal.
+func (im *importer) addPartitions(target importTarget, dbName string, tableName string,
+	batch []*hive_metastore.Partition) error {
+	for _, p := range batch {
+		if p.Sd != nil {
+			p.Sd.Location = im.opts.rewriter.Rewrite(p.Sd.Location)
+		}
+	}
+	err := target.AddPartitions(batch)
+	if err == nil {
+		im.report.add(kindPartition, resultCreated, len(batch))
+		for _, p := range batch {
+			im.journal.record(kindPartition, partitionJournalName(p))
+		}
+		return nil
+	}
+	if _, ok := err.(*hive_metastore.AlreadyExistsException); !ok || im.conflictPolicy() == conflictFail {
+		im.report.add(kindPartition, resultFailed, len(batch))
+		return err
+	}
+	for i, p := range batch {
+		err = target.AddPartitions([]*hive_metastore.Partition{p})
+		if err == nil {
+			im.report.add(kindPartition, resultCreated, 1)
+			im.journal.record(kindPartition, partitionJournalName(p))
 			continue
 		}
-		fullTblName := dbName + "." + tableName
-		if !tableMap[fullTblName] {
-			_, err := client.GetTable(dbName, tableName)
-			if err != nil {
-				log.Println("skipping", dbName, ".", tableName, ": can't get table information")
-				continue
-			}
-			tableMap[fullTblName] = true
+		if _, ok := err.(*hive_metastore.AlreadyExistsException); !ok {
+			im.report.add(kindPartition, resultFailed, len(batch)-i)
+			return err
 		}
-		if _, err := client.AddPartition(partition); err != nil {
-			if _, ok := err.(*hive_metastore.AlreadyExistsException); ok {
-				log.Println("failed to add partition", partition.Values, "into",
-					fullTblName, ": partition already exists")
-
-			} else {
-				log.Println("failed to add partition", partition.Values, "into", fullTblName, err)
-			}
+		if im.conflictPolicy() == conflictSkip {
+			im.report.add(kindPartition, resultSkipped, 1)
+			im.journal.record(kindPartition, partitionJournalName(p))
+			continue
+		}
+		if err = target.AlterPartitions(dbName, tableName, []*hive_metastore.Partition{p}); err != nil {
+			im.report.add(kindPartition, resultFailed, len(batch)-i)
+			return err
 		}
+		im.report.add(kindPartition, resultReplaced, 1)
+		im.journal.record(kindPartition, partitionJournalName(p))
 	}
 	return nil
 }
 
-// Get list of databases as a map to allow quick check whether DB exists
-func getDatabases(client *hmsclient.MetastoreClient) (map[string]bool, error) {
+// applyTombstone drops object which was dropped since the previous export.
+// Data is never deleted. Objects which don't exist are reported as skipped.
+func (im *importer) applyTombstone(t *Tombstone) {
+	name := t.String()
+	if im.journal.done(kindTombstone, name) {
+		im.report.add(t.Kind, resultSkipped, 1)
+		return
+	}
+	var err error
+	switch t.Kind {
+	case kindDatabase:
+		log.Println("Dropping database", name)
+		if err = im.target.DropDatabase(t.Database, false, true); err == nil {
+			im.setDbAvailable(t.Database, false)
+		}
+	case kindTable:
+		log.Println("Dropping table", name)
+		err = im.target.DropTable(t.Database, t.Table, false)
+	case kindPartition:
+		err = im.dropPartition(t)
+	default:
+		err = fmt.Errorf("unknown tombstone kind %q", t.Kind)
+	}
+	result := resultDropped
+	if isNotFound(err) {
+		result, err = resultSkipped, nil
+	}
+	if err != nil {
+		im.report.fail(t.Kind, name, err)
+		return
+	}
+	im.report.add(t.Kind, result, 1)
+	im.journal.record(kindTombstone, name)
+}
+
+// dropPartition drops partition specified by tombstone
+func (im *importer) dropPartition(t *Tombstone) error {
+	table, err := im.target.GetTable(t.Database, t.Table)
+	if err != nil {
+		return err
+	}
+	values, err := partitionValues(table.PartitionKeys, []map[string]string{t.Partition})
+	if err != nil {
+		return err
+	}
+	_, err = im.target.DropPartition(t.Database, t.Table, values[0], false)
+	return err
+}
+
+func getDatabases(client importTarget) (map[string]bool, error) {
 	databases, err := client.GetAllDatabases()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get list of databases: %s",
@@ -184,6 +640,145 @@ func getDatabases(client *hmsclient.MetastoreClient) (map[string]bool, error) {
 	return dbMap, nil
 }
 
+// importJournal records completed objects so that repeated import can skip them
+type importJournal struct {
+	mu        sync.Mutex
+	fileName  string
+	file      *os.File
+	completed map[string]bool
+}
+
+// openJournal opens existing journal or creates a new one
+func openJournal(fileName string) (*importJournal, error) {
+	j := &importJournal{fileName: fileName, completed: make(map[string]bool)}
+	if f, err := os.Open(fileName); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			j.completed[scanner.Text()] = true
+		}
+		f.Close()
+		if err = scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read journal %s: %v", fileName, err)
+		}
+	}
+	f, err := os.OpenFile(fileName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal %s: %v", fileName, err)
+	}
+	j.file = f
+	return j, nil
+}
+
+func (j *importJournal) done(kind string, name string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.completed[kind+"\t"+name]
+}
+
+func (j *importJournal) record(kind string, name string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	key := kind + "\t" + name
+	j.completed[key] = true
+	if _, err := fmt.Fprintln(j.file, key); err != nil {
+		log.Println("failed to update journal:", err)
+	}
+}
+
+func (j *importJournal) Close() {
+	j.file.Close()
+}
+
+// remove closes and deletes the journal
+func (j *importJournal) remove() error {
+	j.file.Close()
+	if err := os.Remove(j.fileName); err != nil {
+		return fmt.Errorf("failed to remove journal %s: %v", j.fileName, err)
+	}
+	return nil
+}
+
+// importReport collects import statistics
+type importReport struct {
+	mu       sync.Mutex
+	counts   map[string]map[string]int // kind -> result -> count
+	failures []string
+}
+
+func newImportReport() *importReport {
+	return &importReport{counts: make(map[string]map[string]int)}
+}
+
+func (r *importReport) add(kind string, result string, count int) {
+	if count == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.counts[kind] == nil {
+		r.counts[kind] = make(map[string]int)
+	}
+	r.counts[kind][result] += count
+}
+
+// fail reports failure of a single object
+func (r *importReport) fail(kind string, name string, err error) {
+	r.add(kind, resultFailed, 1)
+	r.failure(kind, name, err)
+}
+
+// failure records the error without counting failed objects, for errors
+// affecting objects which are counted separately.
+func (r *importReport) failure(kind string, name string, err error) {
+	log.Printf("failed to import %s %s: %v", kind, name, err)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures = append(r.failures, fmt.Sprintf("%s %s: %v", kind, name, err))
+}
+
+func (r *importReport) failed() bool {
+	return r.failureCount() != 0
+}
+
+// failureCount returns the number of failures reported so far
+func (r *importReport) failureCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.failures)
+}
+
+func (r *importReport) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var b strings.Builder
+	b.WriteString("Import summary:\n")
+	for _, kind := range []string{kindDatabase, kindTable, kindPartition} {
+		c := r.counts[kind]
+		fmt.Fprintf(&b, "  %-11s %d created, %d replaced, %d dropped, %d skipped, %d failed\n", kind+"s:",
+			c[resultCreated], c[resultReplaced], c[resultDropped], c[resultSkipped], c[resultFailed])
+	}
+	if len(r.failures) != 0 {
+		failures := append([]string(nil), r.failures...)
+		sort.Strings(failures)
+		b.WriteString("Failures:\n")
+		for _, f := range failures {
+			fmt.Fprintf(&b, "  %s\n", f)
+		}
+	}
+	return b.String()
+}
+
+// addImportFlags adds flags controlling import of objects to the command
+func addImportFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArray(optRewriteLocation, nil, "rewrite location prefix, as old=new")
+	cmd.Flags().Bool(optKeepManaged, false, "keep managed tables managed")
+	cmd.Flags().Int(optWorkers, 4, "number of tables imported concurrently")
+	cmd.Flags().String(optOnConflict, conflictSkip,
+		"handling of existing objects: skip, replace or fail")
+}
+
 func init() {
+	addImportFlags(importCmd)
+	importCmd.Flags().String(optJournal, "", "journal file (default is <file>.journal)")
 	rootCmd.AddCommand(importCmd)
 }
@@ -0,0 +1,419 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+)
+
+// fakeTarget is in-memory importTarget
+type fakeTarget struct {
+	mu         sync.Mutex
+	databases  map[string]*hmsclient.Database
+	tables     map[string]*hive_metastore.Table
+	partitions map[string]*hive_metastore.Partition
+	altered    int
+	failTables map[string]bool // Tables failing to add partitions
+}
+
+func newFakeTarget() *fakeTarget {
+	return &fakeTarget{
+		databases:  make(map[string]*hmsclient.Database),
+		tables:     make(map[string]*hive_metastore.Table),
+		partitions: make(map[string]*hive_metastore.Partition),
+	}
+}
+
+func partitionKey(p *hive_metastore.Partition) string {
+	return p.DbName + "." + p.TableName + "/" + strings.Join(p.Values, "/")
+}
+
+func (f *fakeTarget) GetAllDatabases() ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var names []string
+	for name := range f.databases {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (f *fakeTarget) GetDatabase(dbName string) (*hmsclient.Database, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if db, ok := f.databases[dbName]; ok {
+		return db, nil
+	}
+	return nil, &hive_metastore.NoSuchObjectException{}
+}
+
+func (f *fakeTarget) CreateDatabase(db *hmsclient.Database) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.databases[db.Name] = db
+	return nil
+}
+
+func (f *fakeTarget) AlterDatabase(dbName string, db *hmsclient.Database) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.databases[dbName] = db
+	f.altered++
+	return nil
+}
+
+func (f *fakeTarget) GetTable(dbName string, tableName string) (*hive_metastore.Table, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if t, ok := f.tables[dbName+"."+tableName]; ok {
+		return t, nil
+	}
+	return nil, &hive_metastore.NoSuchObjectException{}
+}
+
+func (f *fakeTarget) CreateTable(table *hive_metastore.Table) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tables[table.DbName+"."+table.TableName] = table
+	return nil
+}
+
+// AlterTable renames the table together with its partitions, like HMS
+func (f *fakeTarget) AlterTable(dbName string, tableName string, table *hive_metastore.Table) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.tables, dbName+"."+tableName)
+	f.tables[table.DbName+"."+table.TableName] = table
+	for name, p := range f.partitions {
+		if p.DbName == dbName && p.TableName == tableName {
+			renamed := *p
+			renamed.DbName, renamed.TableName = table.DbName, table.TableName
+			delete(f.partitions, name)
+			f.partitions[partitionKey(&renamed)] = &renamed
+		}
+	}
+	f.altered++
+	return nil
+}
+
+func (f *fakeTarget) AddPartitions(newParts []*hive_metastore.Partition) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, p := range newParts {
+		if f.failTables[p.DbName+"."+p.TableName] {
+			return fmt.Errorf("can't add partitions")
+		}
+		if _, ok := f.partitions[partitionKey(p)]; ok {
+			return &hive_metastore.AlreadyExistsException{}
+		}
+	}
+	for _, p := range newParts {
+		f.partitions[partitionKey(p)] = p
+	}
+	return nil
+}
+
+func (f *fakeTarget) AddPartition(partition *hive_metastore.Partition) (*hive_metastore.Partition, error) {
+	if err := f.AddPartitions([]*hive_metastore.Partition{partition}); err != nil {
+		return nil, err
+	}
+	return partition, nil
+}
+
+func (f *fakeTarget) AlterPartitions(dbName string, tableName string,
+	partitions []*hive_metastore.Partition) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, p := range partitions {
+		f.partitions[partitionKey(p)] = p
+	}
+	f.altered += len(partitions)
+	return nil
+}
+
+func (f *fakeTarget) DropDatabase(dbName string, deleteData bool, cascade bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.databases[dbName]; !ok {
+		return &hive_metastore.NoSuchObjectException{}
+	}
+	delete(f.databases, dbName)
+	for name, t := range f.tables {
+		if t.DbName == dbName {
+			delete(f.tables, name)
+		}
+	}
+	for name, p := range f.partitions {
+		if p.DbName == dbName {
+			delete(f.partitions, name)
+		}
+	}
+	return nil
+}
+
+func (f *fakeTarget) DropTable(dbName string, tableName string, deleteData bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.tables[dbName+"."+tableName]; !ok {
+		return &hive_metastore.NoSuchObjectException{}
+	}
+	delete(f.tables, dbName+"."+tableName)
+	for name, p := range f.partitions {
+		if p.DbName == dbName && p.TableName == tableName {
+			delete(f.partitions, name)
+		}
+	}
+	return nil
+}
+
+func (f *fakeTarget) DropPartition(dbName string, tableName string,
+	values []string, deleteData bool) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := partitionKey(&hive_metastore.Partition{DbName: dbName, TableName: tableName, Values: values})
+	if _, ok := f.partitions[key]; !ok {
+		return false, &hive_metastore.NoSuchObjectException{}
+	}
+	delete(f.partitions, key)
+	return true, nil
+}
+
+func (f *fakeTarget) Close() {}
+
+func testDump() *HmsObject {
+	hms := &HmsObject{Databases: []*hmsclient.Database{{Name: "sales", Location: "hdfs://old/sales"}}}
+	for _, name := range []string{"orders", "items"} {
+		hms.Tables = append(hms.Tables, &hive_metastore.Table{DbName: "sales", TableName: name,
+			Sd: &hive_metastore.StorageDescriptor{Location: "hdfs://old/sales/" + name}})
+		for i := 0; i < 5; i++ {
+			hms.Partitions = append(hms.Partitions, &hive_metastore.Partition{
+				DbName: "sales", TableName: name, Values: []string{fmt.Sprint(i)},
+				Sd: &hive_metastore.StorageDescriptor{Location: fmt.Sprintf("hdfs://old/sales/%s/ds=%d", name, i)},
+			})
+		}
+	}
+	return hms
+}
+
+func newTestImporter(t *testing.T, target *fakeTarget, journalName string, onConflict string) *importer {
+	journal, err := openJournal(journalName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(journal.Close)
+	rewriter, _ := newLocationRewriter([]string{"hdfs://old=s3a://new"})
+	return &importer{
+		opts: &importOptions{rewriter: rewriter, onConflict: onConflict,
+			workers: 3, batchSize: 2},
+		target:  target,
+		connect: func() (importTarget, error) { return target, nil },
+		journal: journal,
+		report:  newImportReport(),
+	}
+}
+
+func runImport(t *testing.T, target *fakeTarget, journalName string, onConflict string) *importReport {
+	im := newTestImporter(t, target, journalName, onConflict)
+	if err := im.importObjects(testDump()); err != nil {
+		t.Fatal(err)
+	}
+	return im.report
+}
+
+func checkCounts(t *testing.T, report *importReport, kind string, expected map[string]int) {
+	t.Helper()
+	for result, count := range expected {
+		if got := report.counts[kind][result]; got != count {
+			t.Errorf("%s %s: expected %d, got %d\n%s", kind, result, count, got, report)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	dir := t.TempDir()
+	target := newFakeTarget()
+	report := runImport(t, target, filepath.Join(dir, "first"), conflictSkip)
+	checkCounts(t, report, kindDatabase, map[string]int{resultCreated: 1})
+	checkCounts(t, report, kindTable, map[string]int{resultCreated: 2})
+	checkCounts(t, report, kindPartition, map[string]int{resultCreated: 10})
+	if report.failed() {
+		t.Errorf("unexpected failures\n%s", report)
+	}
+	if location := target.databases["sales"].Location; location != "s3a://new/sales" {
+		t.Errorf("database location is not rewritten: %s", location)
+	}
+	orders := target.tables["sales.orders"]
+	if orders.Parameters[externalTable] != trueValue || orders.Sd.Location != "s3a://new/sales/orders" {
+		t.Errorf("invalid table %v", orders)
+	}
+	if p := target.partitions["sales.items/3"]; p.Sd.Location != "s3a://new/sales/items/ds=3" {
+		t.Errorf("partition location is not rewritten: %s", p.Sd.Location)
+	}
+
+	// Rerun with the same journal skips everything
+	report = runImport(t, target, filepath.Join(dir, "first"), conflictFail)
+	checkCounts(t, report, kindDatabase, map[string]int{resultSkipped: 1})
+	checkCounts(t, report, kindTable, map[string]int{resultSkipped: 2})
+	checkCounts(t, report, kindPartition, map[string]int{resultSkipped: 10})
+
+	// Partially existing partitions are handled by conflict policy
+	delete(target.partitions, "sales.orders/1")
+	report = runImport(t, target, filepath.Join(dir, "skip"), conflictSkip)
+	checkCounts(t, report, kindTable, map[string]int{resultSkipped: 2})
+	checkCounts(t, report, kindPartition, map[string]int{resultCreated: 1, resultSkipped: 9})
+
+	report = runImport(t, target, filepath.Join(dir, "replace"), conflictReplace)
+	checkCounts(t, report, kindDatabase, map[string]int{resultReplaced: 1})
+	checkCounts(t, report, kindTable, map[string]int{resultReplaced: 2})
+	checkCounts(t, report, kindPartition, map[string]int{resultReplaced: 10})
+
+	report = runImport(t, target, filepath.Join(dir, "fail"), conflictFail)
+	checkCounts(t, report, kindDatabase, map[string]int{resultFailed: 1})
+	checkCounts(t, report, kindTable, map[string]int{resultFailed: 2})
+	checkCounts(t, report, kindPartition, map[string]int{resultFailed: 10})
+	if !report.failed() {
+		t.Error("conflicts should be reported as failures")
+	}
+}
+
+func TestImportResume(t *testing.T) {
+	journalName := filepath.Join(t.TempDir(), "journal")
+	target := newFakeTarget()
+	target.failTables = map[string]bool{"sales.items": true}
+	report := runImport(t, target, journalName, conflictFail)
+	checkCounts(t, report, kindTable, map[string]int{resultCreated: 2, resultFailed: 0})
+	checkCounts(t, report, kindPartition, map[string]int{resultCreated: 5, resultFailed: 5})
+	if !report.failed() {
+		t.Error("partition failures should be reported")
+	}
+
+	// Rerun creates only missing partitions, even when conflicts are failures
+	target.failTables = nil
+	report = runImport(t, target, journalName, conflictFail)
+	checkCounts(t, report, kindDatabase, map[string]int{resultSkipped: 1})
+	checkCounts(t, report, kindTable, map[string]int{resultSkipped: 2})
+	checkCounts(t, report, kindPartition, map[string]int{resultCreated: 5, resultSkipped: 5})
+	if report.failed() {
+		t.Errorf("unexpected failures\n%s", report)
+	}
+}
+
+func TestImportJournalRemoved(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "dump.json")
+	raw, err := json.Marshal(testDump())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(fileName, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+	journalName := fileName + journalSuffix
+
+	// Journal is kept after failures
+	target := newFakeTarget()
+	target.failTables = map[string]bool{"sales.items": true}
+	newTestImporter(t, target, journalName, conflictSkip).importJournaled(fileName)
+	if _, err = os.Stat(journalName); err != nil {
+		t.Errorf("journal should be kept after failures: %v", err)
+	}
+
+	// Journal is removed after successful import
+	target.failTables = nil
+	im := newTestImporter(t, target, journalName, conflictSkip)
+	im.importJournaled(fileName)
+	if im.report.failed() {
+		t.Fatalf("unexpected failures\n%s", im.report)
+	}
+	if _, err = os.Stat(journalName); !os.IsNotExist(err) {
+		t.Errorf("journal should be removed after successful import: %v", err)
+	}
+
+	// File with the same name is imported from scratch
+	im = newTestImporter(t, newFakeTarget(), journalName, conflictSkip)
+	im.importJournaled(fileName)
+	checkCounts(t, im.report, kindTable, map[string]int{resultCreated: 2})
+	checkCounts(t, im.report, kindPartition, map[string]int{resultCreated: 10})
+}
+
+func TestImportLocations(t *testing.T) {
+	// Location of hr database shares prefix with the rewrite rule but not the path
+	dump := func() *HmsObject {
+		hms := &HmsObject{}
+		for db, location := range map[string]string{"sales": "hdfs://old/sales", "hr": "hdfs://older/hr"} {
+			hms.Databases = append(hms.Databases, &hmsclient.Database{Name: db, Location: location})
+			hms.Tables = append(hms.Tables, &hive_metastore.Table{DbName: db, TableName: "t",
+				TableType: hmsclient.TableTypeManaged.String(),
+				Sd:        &hive_metastore.StorageDescriptor{Location: location + "/t"}})
+			hms.Partitions = append(hms.Partitions, &hive_metastore.Partition{DbName: db, TableName: "t",
+				Values: []string{"1"}, Sd: &hive_metastore.StorageDescriptor{Location: location + "/t/ds=1"}})
+		}
+		return hms
+	}
+	expected := map[string]string{
+		"database sales":  "s3a://new/sales",
+		"database hr":     "",
+		"table sales.t":   "s3a://new/sales/t",
+		"table hr.t":      "hdfs://older/hr/t",
+		"partition sales": "s3a://new/sales/t/ds=1",
+		"partition hr":    "hdfs://older/hr/t/ds=1",
+	}
+
+	for _, keepManaged := range []bool{false, true} {
+		target := newFakeTarget()
+		im := newTestImporter(t, target, filepath.Join(t.TempDir(), "journal"), conflictSkip)
+		im.opts.keepManaged = keepManaged
+		if err := im.importObjects(dump()); err != nil {
+			t.Fatal(err)
+		}
+		if report := im.report; report.failed() {
+			t.Fatalf("unexpected failures\n%s", report)
+		}
+		locations := map[string]string{
+			"database sales":  target.databases["sales"].Location,
+			"database hr":     target.databases["hr"].Location,
+			"table sales.t":   target.tables["sales.t"].Sd.Location,
+			"table hr.t":      target.tables["hr.t"].Sd.Location,
+			"partition sales": target.partitions["sales.t/1"].Sd.Location,
+			"partition hr":    target.partitions["hr.t/1"].Sd.Location,
+		}
+		for name, location := range expected {
+			if locations[name] != location {
+				t.Errorf("%s: expected location %q, got %q", name, location, locations[name])
+			}
+		}
+
+		tableType := hmsclient.TableTypeExternal.String()
+		if keepManaged {
+			tableType = hmsclient.TableTypeManaged.String()
+		}
+		for name, table := range target.tables {
+			external := table.Parameters[externalTable] == trueValue
+			if table.TableType != tableType || external == keepManaged {
+				t.Errorf("keep managed %v: unexpected type %s of %s, parameters %v",
+					keepManaged, table.TableType, name, table.Parameters)
+			}
+		}
+	}
+}
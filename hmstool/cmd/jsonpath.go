@@ -0,0 +1,138 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonPathStep is a single step of JSONPath expression: field name, array index
+// or wildcard matching all fields or array elements.
+type jsonPathStep struct {
+	field    string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// jsonPath is a parsed JSONPath expression. Only a subset of JSONPath is
+// supported: fields (.name or ['name']), array indexes ([0], negative indexes
+// count from the end) and wildcards (.* or [*]).
+// The expression may be enclosed in braces, as in kubectl: {.spec.name}
+type jsonPath []jsonPathStep
+
+// parseJSONPath parses JSONPath expression
+func parseJSONPath(expr string) (jsonPath, error) {
+	s := strings.TrimSpace(expr)
+	if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+		s = s[1 : len(s)-1]
+	}
+	s = strings.TrimPrefix(s, "$")
+	var path jsonPath
+	for len(s) != 0 {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			name := s[:end]
+			s = s[end:]
+			switch name {
+			case "":
+				return nil, fmt.Errorf("invalid JSONPath %s: empty field name", expr)
+			case "*":
+				path = append(path, jsonPathStep{wildcard: true})
+			default:
+				path = append(path, jsonPathStep{field: name})
+			}
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSONPath %s: missing ]", expr)
+			}
+			selector := s[1:end]
+			s = s[end+1:]
+			switch {
+			case selector == "*":
+				path = append(path, jsonPathStep{wildcard: true})
+			case len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') &&
+				selector[len(selector)-1] == selector[0]:
+				path = append(path, jsonPathStep{field: selector[1 : len(selector)-1]})
+			default:
+				index, err := strconv.Atoi(selector)
+				if err != nil {
+					return nil, fmt.Errorf("invalid JSONPath %s: invalid index %s", expr, selector)
+				}
+				path = append(path, jsonPathStep{index: index, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("invalid JSONPath %s: unexpected %q", expr, s[0])
+		}
+	}
+	return path, nil
+}
+
+// eval returns all values matching the path in the generic JSON data
+func (path jsonPath) eval(data interface{}) []interface{} {
+	current := []interface{}{data}
+	for _, step := range path {
+		var next []interface{}
+		for _, value := range current {
+			next = append(next, step.apply(value)...)
+		}
+		current = next
+	}
+	return current
+}
+
+func (step jsonPathStep) apply(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if step.wildcard {
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			result := make([]interface{}, len(keys))
+			for i, k := range keys {
+				result[i] = v[k]
+			}
+			return result
+		}
+		if field, ok := v[step.field]; ok && !step.isIndex {
+			return []interface{}{field}
+		}
+	case []interface{}:
+		if step.wildcard {
+			return v
+		}
+		if step.isIndex {
+			index := step.index
+			if index < 0 {
+				index += len(v)
+			}
+			if index >= 0 && index < len(v) {
+				return []interface{}{v[index]}
+			}
+		}
+	}
+	return nil
+}
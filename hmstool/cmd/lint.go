@@ -0,0 +1,567 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+	"github.com/gobwas/glob"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	optRules = "rules"
+
+	formatJUnit = "junit"
+
+	severityError   = "error"
+	severityWarning = "warning"
+	severityInfo    = "info"
+	severityOff     = "off"
+
+	textInputFormat = "org.apache.hadoop.mapred.TextInputFormat"
+)
+
+var lintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "check metadata against policy rules",
+	Run:   lintCatalog,
+	Long: `Check databases, tables and partitions against policy rules.
+
+Built-in rules:
+
+    owner-missing               database or table has no owner (error)
+    managed-outside-warehouse   managed table is outside the warehouse (error)
+    partition-serde-mismatch    partition SerDe or input format differs from the table (warning)
+    text-format                 table is stored as text (warning)
+    column-comment-missing      table columns have no comments (info)
+    required-parameters         table lacks required parameters (error, needs configuration)
+
+Rules can be configured with a YAML file specified by --rules. Each rule can have
+severity (error, warning, info or off) and include and exclude glob patterns matching
+database names for database rules and table names (tableName or dbName.tableName)
+for table and partition rules. The warehouse location is used by the
+managed-outside-warehouse rule, when it isn't set the database location is used.
+For example:
+
+    warehouse: hdfs://namenode:8020/user/hive/warehouse
+    rules:
+      text-format:
+        severity: error
+        include: ["prod.*"]
+      column-comment-missing:
+        severity: off
+      required-parameters:
+        parameters: [owner_team, retention_days]
+        exclude: ["*.tmp_*"]
+
+The findings are shown as a table by default, --format json and --format junit
+produce JSON or JUnit XML reports. The command exits with non-zero status when
+any error is found.
+
+Examples:
+
+    hmstool lint -d sales
+    hmstool lint --rules lint.yaml --format junit -o lint.xml
+`,
+}
+
+// lintRule is a built-in rule. Each check returns problems found in the object.
+type lintRule struct {
+	name           string
+	severity       string
+	checkDatabase  func(l *linter, db *hmsclient.Database) []string
+	checkTable     func(l *linter, table *hive_metastore.Table) []string
+	checkPartition func(l *linter, table *hive_metastore.Table, partition *hive_metastore.Partition) []string
+}
+
+var lintRules = []*lintRule{
+	{
+		name:     "owner-missing",
+		severity: severityError,
+		checkDatabase: func(_ *linter, db *hmsclient.Database) []string {
+			if db.Owner == "" {
+				return []string{"database has no owner"}
+			}
+			return nil
+		},
+		checkTable: func(_ *linter, table *hive_metastore.Table) []string {
+			if table.Owner == "" {
+				return []string{"table has no owner"}
+			}
+			return nil
+		},
+	},
+	{
+		name:     "managed-outside-warehouse",
+		severity: severityError,
+		checkTable: func(l *linter, table *hive_metastore.Table) []string {
+			if table.TableType != hmsclient.TableTypeManaged.String() {
+				return nil
+			}
+			warehouse := l.config.Warehouse
+			if warehouse == "" {
+				warehouse = l.dbLocations[table.DbName]
+			}
+			location := sdLocation(table.Sd)
+			if warehouse == "" || location == "" {
+				return nil
+			}
+			if !isSubLocation(location, warehouse) {
+				return []string{fmt.Sprintf("managed table location %s is outside of %s", location, warehouse)}
+			}
+			return nil
+		},
+	},
+	{
+		name:     "partition-serde-mismatch",
+		severity: severityWarning,
+		checkPartition: func(_ *linter, table *hive_metastore.Table, partition *hive_metastore.Partition) []string {
+			if table.Sd == nil || partition.Sd == nil {
+				return nil
+			}
+			var problems []string
+			tableSerde, partSerde := serdeLib(table.Sd), serdeLib(partition.Sd)
+			if tableSerde != partSerde {
+				problems = append(problems,
+					fmt.Sprintf("partition SerDe %s differs from table SerDe %s", partSerde, tableSerde))
+			}
+			if table.Sd.InputFormat != partition.Sd.InputFormat {
+				problems = append(problems, fmt.Sprintf("partition input format %s differs from table input format %s",
+					partition.Sd.InputFormat, table.Sd.InputFormat))
+			}
+			return problems
+		},
+	},
+	{
+		name:     "text-format",
+		severity: severityWarning,
+		checkTable: func(_ *linter, table *hive_metastore.Table) []string {
+			if table.Sd != nil && table.Sd.InputFormat == textInputFormat &&
+				table.TableType != hmsclient.TableTypeView.String() {
+				return []string{"table is stored as text"}
+			}
+			return nil
+		},
+	},
+	{
+		name:     "column-comment-missing",
+		severity: severityInfo,
+		checkTable: func(_ *linter, table *hive_metastore.Table) []string {
+			var columns []string
+			if table.Sd != nil {
+				for _, c := range table.Sd.Cols {
+					if c.Comment == "" {
+						columns = append(columns, c.Name)
+					}
+				}
+			}
+			if len(columns) == 0 {
+				return nil
+			}
+			return []string{"columns without comments: " + strings.Join(columns, ", ")}
+		},
+	},
+	{
+		name:     "required-parameters",
+		severity: severityError,
+		checkTable: func(l *linter, table *hive_metastore.Table) []string {
+			var missing []string
+			for _, p := range l.config.Rules["required-parameters"].getParameters() {
+				if _, ok := table.Parameters[p]; !ok {
+					missing = append(missing, p)
+				}
+			}
+			if len(missing) == 0 {
+				return nil
+			}
+			return []string{"missing parameters: " + strings.Join(missing, ", ")}
+		},
+	},
+}
+
+// lintConfig is the YAML configuration of lint rules
+type lintConfig struct {
+	Warehouse string                     `yaml:"warehouse"`
+	Rules     map[string]*lintRuleConfig `yaml:"rules"`
+}
+
+// lintRuleConfig configures a single rule
+type lintRuleConfig struct {
+	Severity   string   `yaml:"severity"`
+	Include    []string `yaml:"include"`
+	Exclude    []string `yaml:"exclude"`
+	Parameters []string `yaml:"parameters"` // Used by required-parameters rule
+}
+
+func (c *lintRuleConfig) getParameters() []string {
+	if c == nil {
+		return nil
+	}
+	return c.Parameters
+}
+
+// activeRule is a rule with its configuration applied
+type activeRule struct {
+	*lintRule
+	severity string
+	include  []glob.Glob
+	exclude  []glob.Glob
+}
+
+// lintResult is the result of checking a single object by a single rule.
+// Results without problems are successful checks.
+type lintResult struct {
+	Rule     string   `json:"rule"`
+	Severity string   `json:"severity"`
+	Kind     string   `json:"kind"`
+	Name     string   `json:"name"`
+	Problems []string `json:"problems"`
+}
+
+var lintColumns = []column{
+	{"SEVERITY", func(item interface{}) string { return item.(*lintResult).Severity }},
+	{"RULE", func(item interface{}) string { return item.(*lintResult).Rule }},
+	{"KIND", func(item interface{}) string { return item.(*lintResult).Kind }},
+	{"NAME", func(item interface{}) string { return item.(*lintResult).Name }},
+	{"PROBLEM", func(item interface{}) string { return strings.Join(item.(*lintResult).Problems, "; ") }},
+}
+
+// linter runs active rules over HMS objects
+type linter struct {
+	config      *lintConfig
+	rules       []*activeRule
+	dbLocations map[string]string
+	results     []*lintResult
+}
+
+// newLinter creates linter with rules configured by config
+func newLinter(config *lintConfig) (*linter, error) {
+	if config == nil {
+		config = &lintConfig{}
+	}
+	known := make(map[string]bool)
+	for _, r := range lintRules {
+		known[r.name] = true
+	}
+	for name := range config.Rules {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown lint rule %s", name)
+		}
+	}
+	l := &linter{config: config, dbLocations: make(map[string]string)}
+	for _, r := range lintRules {
+		rule := &activeRule{lintRule: r, severity: r.severity}
+		if c := config.Rules[r.name]; c != nil {
+			if c.Severity != "" {
+				rule.severity = strings.ToLower(c.Severity)
+			}
+			switch rule.severity {
+			case severityError, severityWarning, severityInfo, severityOff:
+			default:
+				return nil, fmt.Errorf("invalid severity %s of rule %s", c.Severity, r.name)
+			}
+			var err error
+			if rule.include, err = compileGlobs(c.Include); err != nil {
+				return nil, fmt.Errorf("rule %s: %v", r.name, err)
+			}
+			if rule.exclude, err = compileGlobs(c.Exclude); err != nil {
+				return nil, fmt.Errorf("rule %s: %v", r.name, err)
+			}
+		}
+		// Required parameters rule does nothing unless parameters are configured
+		if r.name == "required-parameters" && len(config.Rules[r.name].getParameters()) == 0 {
+			continue
+		}
+		if rule.severity != severityOff {
+			l.rules = append(l.rules, rule)
+		}
+	}
+	return l, nil
+}
+
+// readLintConfig reads YAML configuration of lint rules
+func readLintConfig(fileName string) (*lintConfig, error) {
+	raw, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %v", fileName, err)
+	}
+	config := new(lintConfig)
+	if err = yaml.UnmarshalStrict(raw, config); err != nil {
+		return nil, fmt.Errorf("failed to parse file %s: %v", fileName, err)
+	}
+	return config, nil
+}
+
+// applies returns true if the rule should check object in the database and table.
+// Database rules are matched with empty table name.
+func (r *activeRule) applies(dbName string, tableName string) bool {
+	match := func(globs []glob.Glob) bool {
+		if tableName == "" {
+			for _, g := range globs {
+				if g.Match(dbName) {
+					return true
+				}
+			}
+			return false
+		}
+		return matchAny(globs, dbName, tableName)
+	}
+	if len(r.include) != 0 && !match(r.include) {
+		return false
+	}
+	return !match(r.exclude)
+}
+
+func (l *linter) record(rule *activeRule, kind string, name string, problems []string) {
+	l.results = append(l.results, &lintResult{Rule: rule.name, Severity: rule.severity,
+		Kind: kind, Name: name, Problems: problems})
+}
+
+// run checks databases, tables and, unless noPartitions is set, partitions
+func (l *linter) run(client metastoreReader, dbNames []string, noPartitions bool) error {
+	for _, dbName := range dbNames {
+		db, err := client.GetDatabase(dbName)
+		if err != nil {
+			return fmt.Errorf("failed to get database %s: %v", dbName, err)
+		}
+		l.dbLocations[dbName] = db.Location
+		for _, r := range l.rules {
+			if r.checkDatabase != nil && r.applies(dbName, "") {
+				l.record(r, kindDatabase, dbName, r.checkDatabase(l, db))
+			}
+		}
+		tableNames, err := client.GetAllTables(dbName)
+		if err != nil {
+			return fmt.Errorf("failed to get tables for %s: %v", dbName, err)
+		}
+		sort.Strings(tableNames)
+		for _, tableName := range tableNames {
+			table, err := client.GetTable(dbName, tableName)
+			if err != nil {
+				return fmt.Errorf("failed to get table %s.%s: %v", dbName, tableName, err)
+			}
+			if err = l.checkTable(client, table, noPartitions); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (l *linter) checkTable(client metastoreReader, table *hive_metastore.Table, noPartitions bool) error {
+	name := table.DbName + "." + table.TableName
+	var partitionRules []*activeRule
+	for _, r := range l.rules {
+		if !r.applies(table.DbName, table.TableName) {
+			continue
+		}
+		if r.checkTable != nil {
+			l.record(r, kindTable, name, r.checkTable(l, table))
+		}
+		if r.checkPartition != nil {
+			partitionRules = append(partitionRules, r)
+		}
+	}
+	if len(partitionRules) == 0 || len(table.PartitionKeys) == 0 || noPartitions {
+		return nil
+	}
+	partitions, err := tablePartitions(client, table.DbName, table.TableName)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, len(table.PartitionKeys))
+	for i, k := range table.PartitionKeys {
+		keys[i] = k.Name
+	}
+	for _, p := range partitions {
+		partName := name + "/" + hmsclient.MakePartName(keys, p.Values)
+		for _, r := range partitionRules {
+			l.record(r, kindPartition, partName, r.checkPartition(l, table, p))
+		}
+	}
+	return nil
+}
+
+// findings returns results with problems
+func (l *linter) findings() []*lintResult {
+	findings := []*lintResult{}
+	for _, r := range l.results {
+		if len(r.Problems) != 0 {
+			findings = append(findings, r)
+		}
+	}
+	return findings
+}
+
+// errorCount returns number of findings with error severity
+func (l *linter) errorCount() int {
+	count := 0
+	for _, r := range l.findings() {
+		if r.Severity == severityError {
+			count++
+		}
+	}
+	return count
+}
+
+// JUnit XML report. Each rule is a test suite and each checked object is a test case.
+// Errors are reported as failures, other findings as test output.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junitReport returns JUnit XML report of all checks
+func (l *linter) junitReport() (string, error) {
+	report := junitTestSuites{Name: "hmstool lint"}
+	suites := make(map[string]*junitTestSuite)
+	var order []string
+	for _, r := range l.results {
+		suite, ok := suites[r.Rule]
+		if !ok {
+			suite = &junitTestSuite{Name: r.Rule}
+			suites[r.Rule] = suite
+			order = append(order, r.Rule)
+		}
+		c := junitTestCase{Name: r.Name, ClassName: r.Rule + "." + r.Kind}
+		if len(r.Problems) != 0 {
+			text := strings.Join(r.Problems, "\n")
+			if r.Severity == severityError {
+				c.Failure = &junitFailure{Message: r.Problems[0], Type: r.Severity, Text: text}
+				suite.Failures++
+			} else {
+				c.SystemOut = r.Severity + ": " + text
+			}
+		}
+		suite.Cases = append(suite.Cases, c)
+		suite.Tests++
+	}
+	for _, name := range order {
+		report.Suites = append(report.Suites, *suites[name])
+		report.Tests += suites[name].Tests
+		report.Failures += suites[name].Failures
+	}
+	b, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return xml.Header + string(b) + "\n", nil
+}
+
+func lintCatalog(cmd *cobra.Command, _ []string) {
+	var config *lintConfig
+	if fileName, _ := cmd.Flags().GetString(optRules); fileName != "" {
+		var err error
+		if config, err = readLintConfig(fileName); err != nil {
+			log.Fatal(err)
+		}
+	}
+	l, err := newLinter(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	client, err := getClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+
+	dbNames, _ := cmd.Flags().GetStringSlice(optDbName)
+	if len(dbNames) == 0 {
+		if dbNames, err = client.GetAllDatabases(); err != nil {
+			log.Fatal(err)
+		}
+		sort.Strings(dbNames)
+	}
+	noPartitions, _ := cmd.Flags().GetBool(optNoPartitions)
+	if err = l.run(client, dbNames, noPartitions); err != nil {
+		log.Fatal(err)
+	}
+
+	if outputFormat(cmd, formatTable) == formatJUnit {
+		report, err := l.junitReport()
+		if err != nil {
+			log.Fatal(err)
+		}
+		displayText(report)
+	} else {
+		findings := l.findings()
+		items := make([]interface{}, len(findings))
+		for i, f := range findings {
+			items[i] = f
+		}
+		data := &displayData{object: findings, sections: []displaySection{{items: items, columns: lintColumns}}}
+		if err = display(cmd, data, formatTable); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if count := l.errorCount(); count != 0 {
+		log.Fatalf("lint found %d errors", count)
+	}
+}
+
+// isSubLocation returns true if location is inside parent location
+func isSubLocation(location string, parent string) bool {
+	l := locationPath(location)
+	p := locationPath(parent)
+	return l == p || strings.HasPrefix(l, strings.TrimSuffix(p, "/")+"/")
+}
+
+// serdeLib returns SerDe library of the storage descriptor
+func serdeLib(sd *hive_metastore.StorageDescriptor) string {
+	if sd.SerdeInfo == nil {
+		return ""
+	}
+	return sd.SerdeInfo.SerializationLib
+}
+
+func init() {
+	lintCmd.Flags().StringSliceP(optDbName, "d", nil, "databases to check (default all)")
+	lintCmd.Flags().String(optRules, "", "YAML file with rule configuration")
+	lintCmd.Flags().Bool(optNoPartitions, false, "do not check partitions")
+	rootCmd.AddCommand(lintCmd)
+}
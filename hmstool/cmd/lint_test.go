@@ -0,0 +1,124 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+)
+
+const lintTestConfig = `
+rules:
+  text-format:
+    severity: error
+    include: ["prod.*"]
+  column-comment-missing:
+    severity: off
+  required-parameters:
+    parameters: [retention]
+    exclude: ["*.tmp_*"]
+`
+
+func TestLint(t *testing.T) {
+	textSd := func(location string) *hive_metastore.StorageDescriptor {
+		return &hive_metastore.StorageDescriptor{Location: location, InputFormat: textInputFormat,
+			SerdeInfo: &hive_metastore.SerDeInfo{SerializationLib: "LazySimpleSerDe"}}
+	}
+	orders, ordersParts := deltaTestTable("orders", "1", "2")
+	orders.DbName, orders.Owner = "prod", "etl"
+	orders.TableType = hmsclient.TableTypeManaged.String()
+	orders.Parameters = map[string]string{"retention": "30"}
+	orders.Sd = textSd("hdfs://nn/warehouse/prod.db/orders")
+	for _, p := range ordersParts {
+		p.DbName = "prod"
+		p.Sd = textSd(orders.Sd.Location + "/ds=" + p.Values[0])
+	}
+	ordersParts[1].Sd.SerdeInfo.SerializationLib = "OrcSerde"
+	scratch := &hive_metastore.Table{DbName: "prod", TableName: "tmp_scratch",
+		TableType: hmsclient.TableTypeManaged.String(),
+		Sd:        &hive_metastore.StorageDescriptor{Location: "hdfs://nn/tmp/scratch"}}
+	dev := &hive_metastore.Table{DbName: "dev", TableName: "logs", Owner: "dev",
+		TableType: hmsclient.TableTypeExternal.String(), Sd: textSd("hdfs://nn/data/logs")}
+	catalog := &fakeCatalog{
+		databases: map[string]*hmsclient.Database{
+			"prod": {Name: "prod", Owner: "admin", Location: "hdfs://nn/warehouse/prod.db"},
+			"dev":  {Name: "dev", Location: "hdfs://nn/warehouse/dev.db"},
+		},
+		tables: map[string]map[string]*hive_metastore.Table{
+			"prod": {"orders": orders, "tmp_scratch": scratch},
+			"dev":  {"logs": dev},
+		},
+		partitions: map[string][]*hive_metastore.Partition{"prod.orders": ordersParts},
+	}
+
+	configFile := filepath.Join(t.TempDir(), "lint.yaml")
+	if err := ioutil.WriteFile(configFile, []byte(lintTestConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := readLintConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := newLinter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = l.run(catalog, []string{"dev", "prod"}, false); err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	for _, f := range l.findings() {
+		found = append(found, f.Severity+" "+f.Rule+" "+f.Name)
+	}
+	sort.Strings(found)
+	expected := []string{
+		"error managed-outside-warehouse prod.tmp_scratch",
+		"error owner-missing dev",
+		"error owner-missing prod.tmp_scratch",
+		"error required-parameters dev.logs",
+		"error text-format prod.orders",
+		"warning partition-serde-mismatch prod.orders/ds=2",
+	}
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("expected findings\n%v\ngot\n%v", expected, found)
+	}
+	if count := l.errorCount(); count != 5 {
+		t.Errorf("expected 5 errors, got %d", count)
+	}
+
+	report, err := l.junitReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var suites junitTestSuites
+	if err = xml.Unmarshal([]byte(report), &suites); err != nil {
+		t.Fatal(err)
+	}
+	if suites.Failures != 5 || suites.Tests != len(l.results) {
+		t.Errorf("unexpected JUnit totals: %d tests, %d failures", suites.Tests, suites.Failures)
+	}
+
+	config.Rules["no-such-rule"] = &lintRuleConfig{}
+	if _, err = newLinter(config); err == nil {
+		t.Error("expected error for unknown rule")
+	}
+}
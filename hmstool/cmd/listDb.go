@@ -15,7 +15,6 @@
 package cmd
 
 import (
-	"fmt"
 	"log"
 
 	"github.com/gobwas/glob"
@@ -85,9 +84,7 @@ func listDbs(cmd *cobra.Command, args []string) {
 	}
 
 	if isLong, _ := cmd.Flags().GetBool("long"); !isLong {
-		for _, name := range dbNames {
-			fmt.Println(name)
-		}
+		displayNames(cmd, dbNames)
 	} else {
 		showDB(cmd, dbNames)
 	}
@@ -15,7 +15,6 @@
 package cmd
 
 import (
-	"fmt"
 	"log"
 	"strings"
 
@@ -106,9 +105,7 @@ func listTables(cmd *cobra.Command, args []string) {
 		}
 	}
 
-	for _, t := range filteredTables {
-		fmt.Println(t)
-	}
+	displayNames(cmd, filteredTables)
 }
 
 // selectTables finds tables using server-side filtering
@@ -135,9 +132,11 @@ func selectTables(cmd *cobra.Command, args []string) {
 	if err != nil {
 		log.Fatalln(err)
 	}
-	for _, t := range tableData {
-		fmt.Printf("%s.%s\n", t.DbName, t.TableName)
+	names := make([]string, len(tableData))
+	for i, t := range tableData {
+		names[i] = t.DbName + "." + t.TableName
 	}
+	displayNames(cmd, names)
 }
 
 func init() {
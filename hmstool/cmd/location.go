@@ -0,0 +1,71 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const optRewriteLocation = "rewrite-location"
+
+// locationRule replaces location prefix From with To
+type locationRule struct {
+	From string
+	To   string
+}
+
+// locationRewriter rewrites location prefixes. Prefixes only match whole path
+// components, so /data matches /data/t but not /database. When multiple rules
+// match, the one with the longest prefix wins.
+type locationRewriter []locationRule
+
+// newLocationRewriter creates rewriter from a list of old=new prefix specifications.
+func newLocationRewriter(specs []string) (locationRewriter, error) {
+	var rules locationRewriter
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid location rewrite %q, should be old=new", spec)
+		}
+		rules = append(rules, locationRule{From: parts[0], To: parts[1]})
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		return len(rules[i].From) > len(rules[j].From)
+	})
+	return rules, nil
+}
+
+// Rewrite returns location with the longest matching prefix replaced.
+// Locations without matching prefix are returned unchanged.
+func (r locationRewriter) Rewrite(location string) string {
+	newLocation, _ := r.rewrite(location)
+	return newLocation
+}
+
+// rewrite is similar to Rewrite but also reports whether any rule matched.
+func (r locationRewriter) rewrite(location string) (string, bool) {
+	for _, rule := range r {
+		if !strings.HasPrefix(location, rule.From) {
+			continue
+		}
+		rest := strings.TrimPrefix(location, rule.From)
+		if rest == "" || strings.HasPrefix(rest, "/") || strings.HasSuffix(rule.From, "/") {
+			return rule.To + rest, true
+		}
+	}
+	return location, false
+}
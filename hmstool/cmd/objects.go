@@ -1,32 +1,50 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"time"
 
 	"github.com/akolb1/gometastore/hmsclient"
 	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 type HmsObject struct {
+	Snapshot   *SnapshotInfo               `json:"snapshot,omitempty"`
 	Databases  []*hmsclient.Database       `json:"databases,omitempty"`
 	Tables     []*hive_metastore.Table     `json:"tables,omitempty"`
 	Partitions []*hive_metastore.Partition `json:"partitions,omitempty"`
+	Tombstones []*Tombstone                `json:"tombstones,omitempty"`
 }
 
-func displayObject(hmsObject *HmsObject) {
+// SnapshotInfo describes the state of HMS at the time of export.
+// BeforeEventID and AfterEventID are IDs of the last notification event before and after
+// the export. If they are different, HMS was modified during the export.
+type SnapshotInfo struct {
+	Host          string    `json:"host"`
+	Time          time.Time `json:"time"`
+	BeforeEventID int64     `json:"beforeEventId"`
+	AfterEventID  int64     `json:"afterEventId"`
+	Delta         bool      `json:"delta,omitempty"`        // Export contains only changes
+	SinceEventID  int64     `json:"sinceEventId,omitempty"` // Delta contains events after this one
+}
+
+// displayObject displays HMS objects in the format selected by --format, JSON by default.
+func displayObject(cmd *cobra.Command, hmsObject *HmsObject) {
+	if err := display(cmd, objectData(hmsObject), formatJSON); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// displayText writes text to the output file if it is specified or to stdout otherwise.
+func displayText(text string) {
 	outputFileName := viper.GetString(outputOpt)
 	if outputFileName == "" {
-		b, _ := json.MarshalIndent(hmsObject, "", "  ")
-		fmt.Println(string(b))
-	} else {
-		b, _ := json.Marshal(hmsObject)
-		if err := ioutil.WriteFile(outputFileName, b, 0644); err != nil {
-			log.Println("failed to write data to file", outputFileName, err)
-		}
+		fmt.Print(text)
+	} else if err := ioutil.WriteFile(outputFileName, []byte(text), 0644); err != nil {
+		log.Println("failed to write data to file", outputFileName, err)
 	}
-
 }
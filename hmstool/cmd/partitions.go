@@ -19,6 +19,7 @@ import (
 	"log"
 	"strings"
 
+	"github.com/akolb1/gometastore/hmsclient"
 	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
 	"github.com/akolb1/gometastore/hmstool/hmsutil"
 	"github.com/spf13/cobra"
@@ -79,9 +80,7 @@ func showPartitions(cmd *cobra.Command, args []string) {
 	if err != nil {
 		log.Fatal(err)
 	}
-	for _, p := range partitions {
-		fmt.Println(p)
-	}
+	displayNames(cmd, partitions)
 }
 
 func showPartition(cmd *cobra.Command, args []string) {
@@ -123,7 +122,7 @@ func showPartition(cmd *cobra.Command, args []string) {
 	if listFiles {
 		displayPartitionFiles(partitions)
 	} else {
-		displayObject(&HmsObject{Partitions: partitions})
+		displayObject(cmd, &HmsObject{Partitions: partitions})
 	}
 }
 
@@ -150,14 +149,18 @@ func dropPartition(cmd *cobra.Command, args []string) {
 	if err != nil {
 		log.Fatal(err)
 	}
+	// Arguments are either plain values or escaped partition names like key=value
 	var values []string
 	for _, arg := range args {
-		parts := strings.Split(arg, "=")
-		value := parts[0]
-		if len(parts) > 1 {
-			value = parts[1]
+		if !strings.Contains(arg, "=") {
+			values = append(values, arg)
+			continue
+		}
+		_, partValues, err := hmsclient.ParsePartName(arg)
+		if err != nil {
+			log.Fatal(err)
 		}
-		values = append(values, value)
+		values = append(values, partValues...)
 	}
 	_, err = client.DropPartition(dbName, tableName, values, true)
 	if err != nil {
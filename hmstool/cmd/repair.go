@@ -0,0 +1,276 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+	"github.com/akolb1/gometastore/hmstool/hmsutil"
+	"github.com/spf13/cobra"
+)
+
+const (
+	optAdd  = "add"
+	optDrop = "drop"
+
+	missingInMetastore = "missing in metastore"
+	missingOnStorage   = "missing on storage"
+)
+
+var tableRepairCmd = &cobra.Command{
+	Use:   "repair",
+	Short: "reconcile partitions with storage",
+	Run:   repairTable,
+	Long: `Compare partitions of a table with partition directories on storage, the same
+way as Hive MSCK REPAIR TABLE does.
+
+The table location is walked and directories of the form key=value are matched
+against the partition keys of the table. Directories that don't match partition keys
+and hidden directories (starting with '.' or '_') are ignored. The partitions found
+on storage are compared with partitions in HMS and the differences are reported.
+
+With --add partitions missing in HMS are added, with --drop partitions missing on
+storage are dropped from HMS. Data is never deleted.
+
+Examples:
+
+    hmstool table repair default.web_logs
+    hmstool table repair default.web_logs --add --drop
+`,
+}
+
+// repairTarget is the part of the metastore client used by repair
+type repairTarget interface {
+	GetTable(dbName string, tableName string) (*hive_metastore.Table, error)
+	GetPartitionNames(dbName string, tableName string, max int) ([]string, error)
+	AddPartitions(newParts []*hive_metastore.Partition) error
+	DropPartitions(dbName string, tableName string, partNames []string) error
+}
+
+// repairEntry is a single difference between HMS and storage
+type repairEntry struct {
+	Partition string `json:"partition"`
+	Status    string `json:"status"`
+}
+
+var repairColumns = []column{
+	{"PARTITION", func(item interface{}) string { return item.(*repairEntry).Partition }},
+	{"STATUS", func(item interface{}) string { return item.(*repairEntry).Status }},
+}
+
+// partitionRepair describes differences between partitions in HMS and partition
+// directories on storage.
+type partitionRepair struct {
+	table              *hive_metastore.Table
+	missingInMetastore []string
+	missingOnStorage   []string
+}
+
+func repairTable(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		log.Fatal("table name should be specified")
+	}
+	dbName, tableName := getDbTableName(cmd, args[0])
+	if dbName == "" {
+		log.Fatal("missing database name")
+	}
+	client, err := getClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+
+	repair, err := checkPartitions(client, dbName, tableName, hmsutil.ListDirectories)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = display(cmd, repair.data(), formatText); err != nil {
+		log.Fatal(err)
+	}
+	if add, _ := cmd.Flags().GetBool(optAdd); add && len(repair.missingInMetastore) != 0 {
+		if err = repair.addPartitions(client); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("added %d partitions", len(repair.missingInMetastore))
+	}
+	if drop, _ := cmd.Flags().GetBool(optDrop); drop && len(repair.missingOnStorage) != 0 {
+		if err = repair.dropPartitions(client); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("dropped %d partitions", len(repair.missingOnStorage))
+	}
+}
+
+// checkPartitions compares partitions of the table with partition directories
+// found by walking the table location with listDirs.
+func checkPartitions(client repairTarget, dbName string, tableName string,
+	listDirs func(location string) ([]string, error)) (*partitionRepair, error) {
+	table, err := client.GetTable(dbName, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get table %s.%s: %v", dbName, tableName, err)
+	}
+	if len(table.PartitionKeys) == 0 {
+		return nil, fmt.Errorf("table %s.%s is not partitioned", dbName, tableName)
+	}
+	location := sdLocation(table.Sd)
+	if location == "" {
+		return nil, fmt.Errorf("table %s.%s has no location", dbName, tableName)
+	}
+	onStorage, err := storagePartitions(location, table.PartitionKeys, listDirs)
+	if err != nil {
+		return nil, err
+	}
+	inMetastore, err := client.GetPartitionNames(dbName, tableName, -1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get partitions for %s.%s: %v", dbName, tableName, err)
+	}
+	storageSet := stringSet(onStorage)
+	metastoreSet := stringSet(inMetastore)
+	repair := &partitionRepair{table: table}
+	for _, name := range onStorage {
+		if !metastoreSet[name] {
+			repair.missingInMetastore = append(repair.missingInMetastore, name)
+		}
+	}
+	for _, name := range inMetastore {
+		if !storageSet[name] {
+			repair.missingOnStorage = append(repair.missingOnStorage, name)
+		}
+	}
+	sort.Strings(repair.missingInMetastore)
+	sort.Strings(repair.missingOnStorage)
+	return repair, nil
+}
+
+// storagePartitions walks the location and returns names of partition directories.
+// Each level of directories should match the corresponding partition key.
+func storagePartitions(location string, keys []*hive_metastore.FieldSchema,
+	listDirs func(location string) ([]string, error)) ([]string, error) {
+	location = strings.TrimSuffix(location, "/")
+	dirs, err := listDirs(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %v", location, err)
+	}
+	var names []string
+	for _, dir := range dirs {
+		if strings.HasPrefix(dir, ".") || strings.HasPrefix(dir, "_") {
+			continue
+		}
+		parts := strings.SplitN(dir, "=", 2)
+		if len(parts) != 2 || parts[1] == "" || !strings.EqualFold(hmsclient.UnescapePathName(parts[0]), keys[0].Name) {
+			log.Printf("ignoring %s/%s: does not match partition key %s", location, dir, keys[0].Name)
+			continue
+		}
+		name := keys[0].Name + "=" + parts[1]
+		if len(keys) == 1 {
+			names = append(names, name)
+			continue
+		}
+		children, err := storagePartitions(location+"/"+dir, keys[1:], listDirs)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			names = append(names, name+"/"+child)
+		}
+	}
+	return names, nil
+}
+
+// data returns display data for the differences
+func (r *partitionRepair) data() *displayData {
+	entries := make([]*repairEntry, 0, len(r.missingInMetastore)+len(r.missingOnStorage))
+	for _, name := range r.missingInMetastore {
+		entries = append(entries, &repairEntry{Partition: name, Status: missingInMetastore})
+	}
+	for _, name := range r.missingOnStorage {
+		entries = append(entries, &repairEntry{Partition: name, Status: missingOnStorage})
+	}
+	items := make([]interface{}, len(entries))
+	for i, e := range entries {
+		items[i] = e
+	}
+	return &displayData{
+		object:   entries,
+		sections: []displaySection{{items: items, columns: repairColumns}},
+		text: func() string {
+			if len(entries) == 0 {
+				return fmt.Sprintf("Partitions of %s.%s match storage\n",
+					r.table.DbName, r.table.TableName)
+			}
+			var b strings.Builder
+			for _, e := range entries {
+				fmt.Fprintf(&b, "%s: %s\n", e.Status, e.Partition)
+			}
+			return b.String()
+		},
+	}
+}
+
+// addPartitions adds partitions missing in HMS in batches
+func (r *partitionRepair) addPartitions(client repairTarget) error {
+	names := r.missingInMetastore
+	for start := 0; start < len(names); start += maxParts {
+		end := start + maxParts
+		if end > len(names) {
+			end = len(names)
+		}
+		partitions := make([]*hive_metastore.Partition, 0, end-start)
+		for _, name := range names[start:end] {
+			_, values, err := hmsclient.ParsePartName(name)
+			if err != nil {
+				return err
+			}
+			partition, err := hmsclient.MakePartition(r.table, values, nil,
+				strings.TrimSuffix(sdLocation(r.table.Sd), "/")+"/"+name)
+			if err != nil {
+				return fmt.Errorf("invalid partition %s: %v", name, err)
+			}
+			partitions = append(partitions, partition)
+		}
+		if err := client.AddPartitions(partitions); err != nil {
+			return fmt.Errorf("failed to add partitions to %s.%s: %v",
+				r.table.DbName, r.table.TableName, err)
+		}
+	}
+	return nil
+}
+
+// dropPartitions drops partitions missing on storage in batches
+func (r *partitionRepair) dropPartitions(client repairTarget) error {
+	names := r.missingOnStorage
+	for start := 0; start < len(names); start += maxParts {
+		end := start + maxParts
+		if end > len(names) {
+			end = len(names)
+		}
+		if err := client.DropPartitions(r.table.DbName, r.table.TableName, names[start:end]); err != nil {
+			return fmt.Errorf("failed to drop partitions from %s.%s: %v",
+				r.table.DbName, r.table.TableName, err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	tablesCmd.AddCommand(tableRepairCmd)
+	tableRepairCmd.Flags().Bool(optAdd, false, "add partitions missing in HMS")
+	tableRepairCmd.Flags().Bool(optDrop, false, "drop partitions missing on storage from HMS")
+}
@@ -0,0 +1,106 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+	"github.com/akolb1/gometastore/hmstool/hmsutil"
+)
+
+func (f *fakeCatalog) AddPartitions(newParts []*hive_metastore.Partition) error {
+	for _, p := range newParts {
+		key := p.DbName + "." + p.TableName
+		f.partitions[key] = append(f.partitions[key], p)
+	}
+	return nil
+}
+
+func (f *fakeCatalog) DropPartitions(dbName string, tableName string, partNames []string) error {
+	names, _ := f.GetPartitionNames(dbName, tableName, -1)
+	dropped := stringSet(partNames)
+	key := dbName + "." + tableName
+	var kept []*hive_metastore.Partition
+	for i, name := range names {
+		if !dropped[name] {
+			kept = append(kept, f.partitions[key][i])
+		}
+	}
+	f.partitions[key] = kept
+	return nil
+}
+
+func TestRepairPartitions(t *testing.T) {
+	dir := t.TempDir()
+	for _, d := range []string{"ds=1/hr=00", "ds=1/hr=01", "ds=2/hr=00", "ds=2/_tmp", "ds=3", "ds=a%3Ab/hr=00", "other/hr=00", ".hive-staging"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.FromSlash(d)), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	location := "file://" + dir
+	table := &hive_metastore.Table{DbName: "web", TableName: "logs",
+		PartitionKeys: []*hive_metastore.FieldSchema{{Name: "ds", Type: "string"}, {Name: "hr", Type: "string"}},
+		Sd:            &hive_metastore.StorageDescriptor{Location: location}}
+	catalog := &fakeCatalog{
+		tables: map[string]map[string]*hive_metastore.Table{"web": {"logs": table}},
+		partitions: map[string][]*hive_metastore.Partition{"web.logs": {
+			{DbName: "web", TableName: "logs", Values: []string{"1", "00"}},
+			{DbName: "web", TableName: "logs", Values: []string{"4", "00"}},
+		}},
+	}
+	repair, err := checkPartitions(catalog, "web", "logs", hmsutil.ListDirectories)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"ds=1/hr=01", "ds=2/hr=00", "ds=a%3Ab/hr=00"}
+	if !reflect.DeepEqual(repair.missingInMetastore, expected) {
+		t.Errorf("expected missing in metastore %v, got %v", expected, repair.missingInMetastore)
+	}
+	if expected := []string{"ds=4/hr=00"}; !reflect.DeepEqual(repair.missingOnStorage, expected) {
+		t.Errorf("expected missing on storage %v, got %v", expected, repair.missingOnStorage)
+	}
+
+	if err = repair.addPartitions(catalog); err != nil {
+		t.Fatal(err)
+	}
+	if err = repair.dropPartitions(catalog); err != nil {
+		t.Fatal(err)
+	}
+	names, _ := catalog.GetPartitionNames("web", "logs", -1)
+	if expected := []string{"ds=1/hr=00", "ds=1/hr=01", "ds=2/hr=00", "ds=a%3Ab/hr=00"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected partitions %v after repair, got %v", expected, names)
+	}
+	added := catalog.partitions["web.logs"][1]
+	if loc := added.Sd.Location; loc != location+"/ds=1/hr=01" {
+		t.Errorf("unexpected location %s of added partition", loc)
+	}
+	escaped := catalog.partitions["web.logs"][3]
+	if escaped.Values[0] != "a:b" || escaped.Sd.Location != location+"/ds=a%3Ab/hr=00" {
+		t.Errorf("unexpected partition %v at %s", escaped.Values, escaped.Sd.Location)
+	}
+
+	repair, err = checkPartitions(catalog, "web", "logs", hmsutil.ListDirectories)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repair.missingInMetastore) != 0 || len(repair.missingOnStorage) != 0 {
+		t.Errorf("expected no differences after repair, got %v and %v",
+			repair.missingInMetastore, repair.missingOnStorage)
+	}
+}
@@ -0,0 +1,540 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	optCheckpoint = "checkpoint"
+	optInterval   = "interval"
+	optBatchSize  = "batch-size"
+	optOnce       = "once"
+	optSkipErrors = "skip-errors"
+
+	defaultCheckpointFile = "hmstool-replicate.json"
+)
+
+var replicateCmd = &cobra.Command{
+	Use:   "replicate",
+	Short: "replicate metastore objects to another metastore",
+	Run:   replicate,
+	Long: `Continuously replicate databases, tables and partitions from source to target metastore.
+
+On the first run the tool copies all objects from the source (or only databases
+specified with -d) and records the ID of the last source notification event in
+the checkpoint file. After that it tails notification events on the source
+and replays CREATE, ALTER and DROP events for databases, tables and partitions
+on the target. Objects are re-read from the source when events are replayed, so
+replaying the same event more than once is safe. Renamed tables are renamed on the
+target, tables moved by a rename out of the replicated databases are dropped there.
+
+The checkpoint is updated after each batch of events, so the replication can be
+restarted after a failure and resumes from the last applied event. To start
+from scratch, remove the checkpoint file.
+
+As with import, managed tables become external tables on the target, and data
+is never deleted on the target when objects are dropped.
+
+Examples:
+
+    hmstool replicate --source old-hms --target new-hms \
+        --rewrite-location hdfs://old-nn:8020=hdfs://new-nn:8020
+    hmstool replicate --source old-hms --target new-hms -d sales --once
+`,
+}
+
+// replicationCheckpoint keeps replication state between runs
+type replicationCheckpoint struct {
+	Source      string    `json:"source"`
+	Target      string    `json:"target"`
+	LastEventID int64     `json:"lastEventId"`
+	Updated     time.Time `json:"updated"`
+}
+
+// replicationSource is the part of the metastore client used to read replicated objects
+type replicationSource interface {
+	exportSource
+	notificationSource
+}
+
+// replicationTarget is the part of the metastore client used to write replicated objects
+type replicationTarget interface {
+	importTarget
+	AddPartition(partition *hive_metastore.Partition) (*hive_metastore.Partition, error)
+}
+
+// replicator copies objects from source to target metastore
+type replicator struct {
+	source    replicationSource
+	target    replicationTarget
+	rewriter  locationRewriter
+	databases map[string]bool // Replicated databases, all if empty
+}
+
+func replicate(cmd *cobra.Command, _ []string) {
+	sourceHost, _ := cmd.Flags().GetString(optSource)
+	targetHost, _ := cmd.Flags().GetString(optTarget)
+	if sourceHost == "" || targetHost == "" {
+		log.Fatal("both --source and --target should be specified")
+	}
+	checkpointFile, _ := cmd.Flags().GetString(optCheckpoint)
+	interval, _ := cmd.Flags().GetDuration(optInterval)
+	batchSize, _ := cmd.Flags().GetInt32(optBatchSize)
+	once, _ := cmd.Flags().GetBool(optOnce)
+	skipErrors, _ := cmd.Flags().GetBool(optSkipErrors)
+	rewrites, _ := cmd.Flags().GetStringArray(optRewriteLocation)
+	rewriter, err := newLocationRewriter(rewrites)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dbNames, _ := cmd.Flags().GetStringSlice(optDbName)
+
+	source, err := hmsclient.Open(sourceHost, viper.GetInt(portOpt))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer source.Close()
+	target, err := hmsclient.Open(targetHost, viper.GetInt(portOpt))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer target.Close()
+
+	r := &replicator{
+		source:    source,
+		target:    target,
+		rewriter:  rewriter,
+		databases: stringSet(dbNames),
+	}
+
+	checkpoint, err := readCheckpoint(checkpointFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if checkpoint == nil {
+		log.Println("Bootstrapping replication from", sourceHost, "to", targetHost)
+		eventID, err := r.bootstrap()
+		if err != nil {
+			log.Fatal(err)
+		}
+		checkpoint = &replicationCheckpoint{Source: sourceHost, Target: targetHost, LastEventID: eventID}
+		if err = checkpoint.save(checkpointFile); err != nil {
+			log.Fatal(err)
+		}
+		log.Println("Bootstrap complete at event", eventID)
+	} else if checkpoint.Source != sourceHost || checkpoint.Target != targetHost {
+		log.Fatalf("checkpoint %s belongs to replication from %s to %s",
+			checkpointFile, checkpoint.Source, checkpoint.Target)
+	}
+
+	for {
+		events, err := source.GetNextNotification(checkpoint.LastEventID, batchSize)
+		if err != nil {
+			log.Fatal("failed to get notifications: ", err)
+		}
+		if len(events) != 0 && events[0].EventId > checkpoint.LastEventID+1 {
+			log.Fatalf("events %d-%d are no longer available on source, "+
+				"remove %s to bootstrap again",
+				checkpoint.LastEventID+1, events[0].EventId-1, checkpointFile)
+		}
+		for _, event := range events {
+			if err = r.apply(event); err != nil {
+				if !skipErrors {
+					if saveErr := checkpoint.save(checkpointFile); saveErr != nil {
+						log.Println(saveErr)
+					}
+					log.Fatalf("failed to apply event %d (%s): %v", event.EventId, event.EventType, err)
+				}
+				log.Printf("skipping event %d (%s): %v", event.EventId, event.EventType, err)
+			}
+			checkpoint.LastEventID = event.EventId
+		}
+		if len(events) != 0 {
+			if err = checkpoint.save(checkpointFile); err != nil {
+				log.Fatal(err)
+			}
+			log.Println("Applied events up to", checkpoint.LastEventID)
+		}
+		if len(events) < int(batchSize) {
+			if once {
+				return
+			}
+			time.Sleep(interval)
+		}
+	}
+}
+
+// readCheckpoint reads checkpoint from file. It returns nil if the file doesn't exist.
+func readCheckpoint(fileName string) (*replicationCheckpoint, error) {
+	raw, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read checkpoint %s: %v", fileName, err)
+	}
+	checkpoint := new(replicationCheckpoint)
+	if err = json.Unmarshal(raw, checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint %s: %v", fileName, err)
+	}
+	return checkpoint, nil
+}
+
+// save atomically writes checkpoint to file
+func (c *replicationCheckpoint) save(fileName string) error {
+	c.Updated = time.Now().UTC()
+	b, _ := json.MarshalIndent(c, "", "  ")
+	tmpName := fileName + ".tmp"
+	if err := ioutil.WriteFile(tmpName, b, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint %s: %v", tmpName, err)
+	}
+	if err := os.Rename(tmpName, fileName); err != nil {
+		return fmt.Errorf("failed to write checkpoint %s: %v", fileName, err)
+	}
+	return nil
+}
+
+// accept returns true if the database should be replicated
+func (r *replicator) accept(dbName string) bool {
+	return len(r.databases) == 0 || r.databases[dbName]
+}
+
+// bootstrap copies all replicated objects from source to target and returns
+// the ID of the last event preceding the copy.
+func (r *replicator) bootstrap() (int64, error) {
+	// Events happening during the copy are replayed later
+	eventID, err := r.source.GetCurrentNotificationId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get current notification id: %v", err)
+	}
+	dbNames, err := r.source.GetAllDatabases()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get list of databases: %v", err)
+	}
+	for _, dbName := range dbNames {
+		if !r.accept(dbName) {
+			continue
+		}
+		hmsObject := new(HmsObject)
+		if err = exportDatabase(r.source, hmsObject, dbName, true, nil); err != nil {
+			return 0, err
+		}
+		for _, db := range hmsObject.Databases {
+			if err = r.putDatabase(db); err != nil {
+				return 0, err
+			}
+		}
+		for _, table := range hmsObject.Tables {
+			if err = r.putTable(table); err != nil {
+				return 0, err
+			}
+		}
+		partitions := make(map[string][]*hive_metastore.Partition)
+		for _, p := range hmsObject.Partitions {
+			partitions[p.TableName] = append(partitions[p.TableName], p)
+		}
+		for tableName, parts := range partitions {
+			if err = r.putPartitions(dbName, tableName, parts); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return eventID, nil
+}
+
+// apply replays single notification event on the target
+func (r *replicator) apply(event *hive_metastore.NotificationEvent) error {
+	dbName, tableName := event.GetDbName(), event.GetTableName()
+	// Renamed tables may move between replicated and other databases
+	if !r.accept(dbName) && event.EventType != eventAlterTable {
+		return nil
+	}
+	switch event.EventType {
+	case eventCreateDatabase, eventAlterDatabase:
+		db, err := r.source.GetDatabase(dbName)
+		if err != nil {
+			return ignoreNotFound(err)
+		}
+		return r.putDatabase(db)
+	case eventDropDatabase:
+		return ignoreNotFound(r.target.DropDatabase(dbName, false, true))
+	case eventCreateTable:
+		return r.syncTable(dbName, tableName)
+	case eventAlterTable:
+		message, err := decodeEventMessage(event)
+		if err != nil {
+			return err
+		}
+		before, after, err := message.renamed()
+		if err != nil {
+			return err
+		}
+		if after != nil {
+			return r.renameTable(before, after)
+		}
+		if !r.accept(dbName) {
+			return nil
+		}
+		return r.syncTable(dbName, tableName)
+	case eventDropTable:
+		return ignoreNotFound(r.target.DropTable(dbName, tableName, false))
+	case eventAddPartition, eventAlterPartition:
+		message, err := decodeEventMessage(event)
+		if err != nil {
+			return err
+		}
+		specs := message.Partitions
+		if message.KeyValues != nil {
+			specs = append(specs, message.KeyValues)
+		}
+		return r.syncPartitions(dbName, tableName, specs)
+	case eventDropPartition:
+		message, err := decodeEventMessage(event)
+		if err != nil {
+			return err
+		}
+		return r.dropPartitions(dbName, tableName, message.Partitions)
+	}
+	return nil
+}
+
+// putDatabase creates or updates database on the target
+func (r *replicator) putDatabase(db *hmsclient.Database) error {
+	newDb := *db
+	newDb.Location = r.rewriter.Rewrite(db.Location)
+	_, err := r.target.GetDatabase(db.Name)
+	if err != nil {
+		if !isNotFound(err) {
+			return fmt.Errorf("failed to get database %s: %v", db.Name, err)
+		}
+		log.Println("Creating database", db.Name)
+		if err = r.target.CreateDatabase(&newDb); err != nil {
+			return fmt.Errorf("failed to create database %s: %v", db.Name, err)
+		}
+		return nil
+	}
+	if err = r.target.AlterDatabase(db.Name, &newDb); err != nil {
+		return fmt.Errorf("failed to alter database %s: %v", db.Name, err)
+	}
+	return nil
+}
+
+// replicaTable returns copy of the source table suitable for the target
+func (r *replicator) replicaTable(table *hive_metastore.Table) *hive_metastore.Table {
+	newTable := *table
+	if table.Sd != nil {
+		sd := *table.Sd
+		sd.Location = r.rewriter.Rewrite(sd.Location)
+		newTable.Sd = &sd
+	}
+	if table.TableType == hmsclient.TableTypeManaged.String() {
+		newTable.Parameters = mergeParameters(table.Parameters,
+			map[string]string{externalTable: trueValue})
+		newTable.TableType = hmsclient.TableTypeExternal.String()
+	}
+	return &newTable
+}
+
+// putTable creates or updates table on the target
+func (r *replicator) putTable(table *hive_metastore.Table) error {
+	fullName := table.DbName + "." + table.TableName
+	newTable := r.replicaTable(table)
+	_, err := r.target.GetTable(table.DbName, table.TableName)
+	if err != nil {
+		if !isNotFound(err) {
+			return fmt.Errorf("failed to get table %s: %v", fullName, err)
+		}
+		log.Println("Creating table", fullName)
+		if err = r.target.CreateTable(newTable); err != nil {
+			return fmt.Errorf("failed to create table %s: %v", fullName, err)
+		}
+		return nil
+	}
+	if err = r.target.AlterTable(table.DbName, table.TableName, newTable); err != nil {
+		return fmt.Errorf("failed to alter table %s: %v", fullName, err)
+	}
+	return nil
+}
+
+// syncTable copies current state of the source table to the target.
+// Tables which no longer exist on the source are ignored, their drop event follows.
+func (r *replicator) syncTable(dbName string, tableName string) error {
+	table, err := r.source.GetTable(dbName, tableName)
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+	return r.putTable(table)
+}
+
+// renameTable renames table on the target and updates it from the source.
+// Tables moved out of replicated databases are dropped on the target, keeping the data.
+func (r *replicator) renameTable(before *hive_metastore.Table, after *hive_metastore.Table) error {
+	oldName := before.DbName + "." + before.TableName
+	newName := after.DbName + "." + after.TableName
+	if !r.accept(after.DbName) {
+		if !r.accept(before.DbName) {
+			return nil
+		}
+		log.Println("Dropping table", oldName, "renamed to", newName)
+		return ignoreNotFound(r.target.DropTable(before.DbName, before.TableName, false))
+	}
+	// The table may be changed or dropped on the source later, its events follow
+	table, err := r.source.GetTable(after.DbName, after.TableName)
+	if err != nil {
+		if !isNotFound(err) {
+			return err
+		}
+		table = after
+	}
+	if r.accept(before.DbName) {
+		_, err = r.target.GetTable(before.DbName, before.TableName)
+		if err == nil {
+			log.Println("Renaming table", oldName, "to", newName)
+			return r.target.AlterTable(before.DbName, before.TableName, r.replicaTable(table))
+		}
+		if !isNotFound(err) {
+			return err
+		}
+	}
+	return r.putTable(table)
+}
+
+// putPartitions adds partitions to the target table, updating existing ones.
+func (r *replicator) putPartitions(dbName string, tableName string,
+	partitions []*hive_metastore.Partition) error {
+	fullName := dbName + "." + tableName
+	newParts := make([]*hive_metastore.Partition, len(partitions))
+	for i, p := range partitions {
+		newPart := *p
+		if p.Sd != nil {
+			sd := *p.Sd
+			sd.Location = r.rewriter.Rewrite(sd.Location)
+			newPart.Sd = &sd
+		}
+		newParts[i] = &newPart
+	}
+	for start := 0; start < len(newParts); start += maxParts {
+		end := start + maxParts
+		if end > len(newParts) {
+			end = len(newParts)
+		}
+		batch := newParts[start:end]
+		err := r.target.AddPartitions(batch)
+		if err == nil {
+			continue
+		}
+		if _, ok := err.(*hive_metastore.AlreadyExistsException); !ok {
+			return fmt.Errorf("failed to add partitions to %s: %v", fullName, err)
+		}
+		// Some partitions exist already, add or update them one by one
+		for _, p := range batch {
+			if _, err = r.target.AddPartition(p); err == nil {
+				continue
+			}
+			if _, ok := err.(*hive_metastore.AlreadyExistsException); !ok {
+				return fmt.Errorf("failed to add partition %v to %s: %v", p.Values, fullName, err)
+			}
+			if err = r.target.AlterPartitions(dbName, tableName,
+				[]*hive_metastore.Partition{p}); err != nil {
+				return fmt.Errorf("failed to alter partition %v of %s: %v", p.Values, fullName, err)
+			}
+		}
+	}
+	return nil
+}
+
+// syncPartitions copies current state of the given source partitions to the target.
+func (r *replicator) syncPartitions(dbName string, tableName string, specs []map[string]string) error {
+	table, err := r.source.GetTable(dbName, tableName)
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+	values, err := partitionValues(table.PartitionKeys, specs)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, len(table.PartitionKeys))
+	for i, k := range table.PartitionKeys {
+		keys[i] = k.Name
+	}
+	names := make([]string, len(values))
+	for i, v := range values {
+		names[i] = hmsclient.MakePartName(keys, v)
+	}
+	partitions, err := r.source.GetPartitionsByNames(dbName, tableName, names)
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+	return r.putPartitions(dbName, tableName, partitions)
+}
+
+// dropPartitions drops partitions from the target table, keeping the data.
+func (r *replicator) dropPartitions(dbName string, tableName string, specs []map[string]string) error {
+	table, err := r.target.GetTable(dbName, tableName)
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+	values, err := partitionValues(table.PartitionKeys, specs)
+	if err != nil {
+		return err
+	}
+	for _, v := range values {
+		if _, err = r.target.DropPartition(dbName, tableName, v, false); ignoreNotFound(err) != nil {
+			return fmt.Errorf("failed to drop partition %v of %s.%s: %v", v, dbName, tableName, err)
+		}
+	}
+	return nil
+}
+
+// isNotFound returns true if the error means that the object doesn't exist
+func isNotFound(err error) bool {
+	_, ok := err.(*hive_metastore.NoSuchObjectException)
+	return ok
+}
+
+// ignoreNotFound returns nil if the error means that the object doesn't exist
+// and the original error otherwise.
+func ignoreNotFound(err error) error {
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func init() {
+	replicateCmd.Flags().String(optSource, "", "source metastore host[:port]")
+	replicateCmd.Flags().String(optTarget, "", "target metastore host[:port]")
+	replicateCmd.Flags().StringSliceP(optDbName, "d", nil, "databases to replicate (default all)")
+	replicateCmd.Flags().String(optCheckpoint, defaultCheckpointFile, "checkpoint file")
+	replicateCmd.Flags().Duration(optInterval, 10*time.Second, "interval between notification polls")
+	replicateCmd.Flags().Int32(optBatchSize, 1000, "maximum number of events fetched at once")
+	replicateCmd.Flags().Bool(optOnce, false, "exit once all available events are applied")
+	replicateCmd.Flags().Bool(optSkipErrors, false, "log and skip events which can't be applied")
+	replicateCmd.Flags().StringArray(optRewriteLocation, nil,
+		"rewrite source location prefix, as old=new")
+	rootCmd.AddCommand(replicateCmd)
+}
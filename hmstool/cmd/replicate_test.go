@@ -0,0 +1,103 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+)
+
+// fakeSource is replicationSource with fixed current event ID
+type fakeSource struct {
+	*fakeCatalog
+	fakeNotifications
+}
+
+// renameEvent returns ALTER_TABLE event renaming the table the way HMS reports it,
+// with the new database and table names.
+func renameEvent(t *testing.T, id int64, before *hive_metastore.Table,
+	after *hive_metastore.Table) *hive_metastore.NotificationEvent {
+	message := fmt.Sprintf(`{"tableObjBeforeJson":%q,"tableObjAfterJson":%q}`,
+		thriftJSON(t, before), thriftJSON(t, after))
+	return &hive_metastore.NotificationEvent{EventId: id, EventType: eventAlterTable,
+		DbName: &after.DbName, TableName: &after.TableName, Message: message}
+}
+
+func TestReplicateRename(t *testing.T) {
+	orders, ordersParts := deltaTestTable("orders", "1", "2")
+	items, _ := deltaTestTable("items")
+	catalog := &fakeCatalog{
+		databases: map[string]*hmsclient.Database{"sales": {Name: "sales"}, "archive": {Name: "archive"},
+			"tmp": {Name: "tmp"}},
+		tables: map[string]map[string]*hive_metastore.Table{
+			"sales": {"orders": orders, "items": items}},
+		partitions: map[string][]*hive_metastore.Partition{"sales.orders": ordersParts},
+	}
+	target := newFakeTarget()
+	r := &replicator{
+		source:    &fakeSource{catalog, fakeNotifications(10)},
+		target:    target,
+		databases: stringSet([]string{"sales"}),
+	}
+	eventID, err := r.bootstrap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eventID != 10 || len(target.tables) != 2 || len(target.partitions) != 2 {
+		t.Fatalf("unexpected bootstrap at event %d: tables %v, partitions %v",
+			eventID, target.tables, target.partitions)
+	}
+
+	// Source after the renames
+	allOrders := *orders
+	allOrders.TableName = "all_orders"
+	archived := *items
+	archived.DbName = "archive"
+	staging := &hive_metastore.Table{DbName: "tmp", TableName: "staging"}
+	published := *staging
+	published.DbName = "sales"
+	catalog.tables = map[string]map[string]*hive_metastore.Table{
+		"sales":   {"all_orders": &allOrders, "staging": &published},
+		"archive": {"items": &archived},
+	}
+	events := []*hive_metastore.NotificationEvent{
+		renameEvent(t, 11, orders, &allOrders),
+		renameEvent(t, 12, items, &archived),
+		renameEvent(t, 13, staging, &published),
+	}
+	for _, event := range events {
+		if err = r.apply(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var tables []string
+	for name := range target.tables {
+		tables = append(tables, name)
+	}
+	sort.Strings(tables)
+	expected := []string{"sales.all_orders", "sales.staging"}
+	if !reflect.DeepEqual(tables, expected) {
+		t.Errorf("expected tables %v, got %v", expected, tables)
+	}
+	if _, ok := target.partitions["sales.all_orders/1"]; !ok || len(target.partitions) != 2 {
+		t.Errorf("partitions should be renamed with the table, got %v", target.partitions)
+	}
+}
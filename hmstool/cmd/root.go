@@ -68,6 +68,14 @@ All examples assume that HMS_HOST point to correct metastore. For example:
 	$ hmstool table list -d default
 	default.tbl1
 	default.mydb
+
+Output format can be selected with --format. Most commands support json, yaml,
+table, csv, template and jsonpath formats. Template and JSONPath expressions are
+applied to each object separately:
+
+	$ hmstool table show default.tbl1 --format table
+	$ hmstool table show default.tbl1 --template '{{.DbName}}.{{.TableName}} {{.Sd.Location}}'
+	$ hmstool db list -l --jsonpath '{.location}'
 `,
 }
 
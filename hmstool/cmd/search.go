@@ -0,0 +1,390 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+	"github.com/gobwas/glob"
+	"github.com/spf13/cobra"
+)
+
+const (
+	optColumn        = "column"
+	optColumnType    = "column-type"
+	optParam         = "param"
+	optTableOwner    = "table-owner"
+	optLocation      = "location"
+	optCreatedAfter  = "created-after"
+	optCreatedBefore = "created-before"
+	optRegex         = "regex"
+
+	defaultSearchBatch = 100
+)
+
+var searchCmd = &cobra.Command{
+	Use:   "search",
+	Short: "search tables and columns across databases",
+	Run:   searchCatalog,
+	Long: `Search tables and columns matching all given predicates.
+
+Predicates:
+
+    --column          column name pattern
+    --column-type     column type pattern
+    --param           table parameter key=value, value may be a pattern;
+                      key alone matches tables having the parameter
+    --table-owner     table owner pattern
+    --table-type      table type (managed, external, view)
+    --location        table location prefix
+    --created-after   tables created at or after the given time
+    --created-before  tables created before the given time
+
+Patterns are globs, or regular expressions when --regex is set. Times are given as
+YYYY-MM-DD, RFC3339 or seconds since epoch.
+
+When column predicates are used, matching columns (including partition keys) are
+printed as db.table.column, otherwise matching tables are printed as db.table.
+
+All databases are searched unless databases are specified with -d. Databases are
+searched concurrently by --workers workers, each using its own metastore connection.
+Tables are fetched in batches of --batch-size.
+
+Examples:
+
+    hmstool search --column ssn
+    hmstool search --column '*_id' --column-type bigint -d sales
+    hmstool search --location hdfs://nn:8020/data/raw
+    hmstool search --param EXTERNAL=TRUE --table-owner etl --created-after 2018-10-01
+    hmstool search --regex --column '^(email|phone)$' --format json
+`,
+}
+
+// stringMatcher matches strings with glob or regular expression
+type stringMatcher interface {
+	Match(s string) bool
+}
+
+type regexpMatcher struct {
+	*regexp.Regexp
+}
+
+func (r regexpMatcher) Match(s string) bool {
+	return r.MatchString(s)
+}
+
+// paramPredicate matches table parameter. A nil value matches any value.
+type paramPredicate struct {
+	key   string
+	value stringMatcher
+}
+
+// searchQuery is a set of predicates which should all match
+type searchQuery struct {
+	column        stringMatcher
+	columnType    stringMatcher
+	owner         stringMatcher
+	params        []paramPredicate
+	tableTypes    map[string]bool
+	location      string
+	createdAfter  int64
+	createdBefore int64
+}
+
+// searchResult is a matching table or column
+type searchResult struct {
+	Name       string `json:"name"`
+	Type       string `json:"type,omitempty"`
+	TableType  string `json:"tableType"`
+	Owner      string `json:"owner,omitempty"`
+	Location   string `json:"location,omitempty"`
+	CreateTime int32  `json:"createTime,omitempty"`
+}
+
+var searchColumns = []column{
+	{"NAME", func(item interface{}) string { return item.(*searchResult).Name }},
+	{"TYPE", func(item interface{}) string { return item.(*searchResult).Type }},
+	{"TABLE TYPE", func(item interface{}) string { return item.(*searchResult).TableType }},
+	{"OWNER", func(item interface{}) string { return item.(*searchResult).Owner }},
+	{"LOCATION", func(item interface{}) string { return item.(*searchResult).Location }},
+}
+
+// searchSource is the part of the metastore client used for search
+type searchSource interface {
+	GetAllDatabases() ([]string, error)
+	GetAllTables(dbName string) ([]string, error)
+	GetTableObjects(dbName string, tableNames []string) ([]*hive_metastore.Table, error)
+}
+
+func searchCatalog(cmd *cobra.Command, _ []string) {
+	query, err := newSearchQuery(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+	workers, _ := cmd.Flags().GetInt(optWorkers)
+	client, err := getClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+	// Thrift clients can't be used concurrently, so each worker uses its own clone
+	sources := []searchSource{client}
+	for len(sources) < workers {
+		c, err := client.Clone()
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer c.Close()
+		sources = append(sources, c)
+	}
+
+	dbNames, _ := cmd.Flags().GetStringSlice(optDbName)
+	batch, _ := cmd.Flags().GetInt(optBatchSize)
+	results, err := query.search(sources, dbNames, batch)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(results) == 0 {
+		log.Fatal("no matches found")
+	}
+	items := make([]interface{}, len(results))
+	for i, r := range results {
+		items[i] = r
+	}
+	data := &displayData{object: results, sections: []displaySection{{items: items, columns: searchColumns}}}
+	if err = display(cmd, data, formatTable); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// newSearchQuery creates query from command flags
+func newSearchQuery(cmd *cobra.Command) (*searchQuery, error) {
+	useRegex, _ := cmd.Flags().GetBool(optRegex)
+	compile := func(pattern string) (stringMatcher, error) {
+		if pattern == "" {
+			return nil, nil
+		}
+		if useRegex {
+			r, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression %q: %v", pattern, err)
+			}
+			return regexpMatcher{r}, nil
+		}
+		g, err := glob.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+		return g, nil
+	}
+
+	q := &searchQuery{tableTypes: make(map[string]bool)}
+	var err error
+	for opt, matcher := range map[string]*stringMatcher{
+		optColumn:     &q.column,
+		optColumnType: &q.columnType,
+		optTableOwner: &q.owner,
+	} {
+		pattern, _ := cmd.Flags().GetString(opt)
+		if *matcher, err = compile(pattern); err != nil {
+			return nil, fmt.Errorf("--%s: %v", opt, err)
+		}
+	}
+	params, _ := cmd.Flags().GetStringArray(optParam)
+	for _, p := range params {
+		kv := strings.SplitN(p, "=", 2)
+		predicate := paramPredicate{key: kv[0]}
+		if len(kv) == 2 {
+			if predicate.value, err = compile(kv[1]); err != nil {
+				return nil, fmt.Errorf("--%s: %v", optParam, err)
+			}
+		}
+		q.params = append(q.params, predicate)
+	}
+	tableTypes, _ := cmd.Flags().GetStringSlice(optTableType)
+	for _, t := range tableTypes {
+		typeName, ok := tableTypeNames[strings.ToLower(t)]
+		if !ok {
+			typeName = strings.ToUpper(t)
+		}
+		q.tableTypes[typeName] = true
+	}
+	q.location, _ = cmd.Flags().GetString(optLocation)
+	for opt, value := range map[string]*int64{
+		optCreatedAfter:  &q.createdAfter,
+		optCreatedBefore: &q.createdBefore,
+	} {
+		s, _ := cmd.Flags().GetString(opt)
+		if s == "" {
+			continue
+		}
+		if *value, err = parseSearchTime(s); err != nil {
+			return nil, fmt.Errorf("--%s: %v", opt, err)
+		}
+	}
+	return q, nil
+}
+
+// parseSearchTime parses time as date, RFC3339 time or seconds since epoch
+func parseSearchTime(s string) (int64, error) {
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return seconds, nil
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Unix(), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid time %q", s)
+}
+
+// search runs the query against all tables of the given databases, or all
+// databases if none are given. Databases are searched concurrently, one per client.
+// Results are sorted by name.
+func (q *searchQuery) search(clients []searchSource, dbNames []string,
+	batch int) ([]*searchResult, error) {
+	if len(dbNames) == 0 {
+		var err error
+		if dbNames, err = clients[0].GetAllDatabases(); err != nil {
+			return nil, fmt.Errorf("failed to get databases: %v", err)
+		}
+	}
+	if batch < 1 {
+		batch = defaultSearchBatch
+	}
+	var (
+		lock    sync.Mutex
+		results []*searchResult
+	)
+	err := runWorkers(len(clients), len(dbNames), func(w int, i int) error {
+		client, dbName := clients[w], dbNames[i]
+		tableNames, err := client.GetAllTables(dbName)
+		if err != nil {
+			return fmt.Errorf("failed to get tables for %s: %v", dbName, err)
+		}
+		var found []*searchResult
+		for start := 0; start < len(tableNames); start += batch {
+			end := start + batch
+			if end > len(tableNames) {
+				end = len(tableNames)
+			}
+			tables, err := client.GetTableObjects(dbName, tableNames[start:end])
+			if err != nil {
+				return fmt.Errorf("failed to get tables for %s: %v", dbName, err)
+			}
+			for _, table := range tables {
+				found = append(found, q.match(table)...)
+			}
+		}
+		lock.Lock()
+		results = append(results, found...)
+		lock.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return results, nil
+}
+
+// match returns matching table or columns of the table
+func (q *searchQuery) match(table *hive_metastore.Table) []*searchResult {
+	if !q.matchTable(table) {
+		return nil
+	}
+	result := searchResult{
+		Name:       table.DbName + "." + table.TableName,
+		TableType:  table.TableType,
+		Owner:      table.Owner,
+		Location:   sdLocation(table.Sd),
+		CreateTime: table.CreateTime,
+	}
+	if q.column == nil && q.columnType == nil {
+		return []*searchResult{&result}
+	}
+	var columns []*hive_metastore.FieldSchema
+	if table.Sd != nil {
+		columns = append(columns, table.Sd.Cols...)
+	}
+	columns = append(columns, table.PartitionKeys...)
+	var results []*searchResult
+	for _, col := range columns {
+		if (q.column != nil && !q.column.Match(col.Name)) ||
+			(q.columnType != nil && !q.columnType.Match(col.Type)) {
+			continue
+		}
+		r := result
+		r.Name = result.Name + "." + col.Name
+		r.Type = col.Type
+		results = append(results, &r)
+	}
+	return results
+}
+
+// matchTable returns true if table level predicates match the table
+func (q *searchQuery) matchTable(table *hive_metastore.Table) bool {
+	if len(q.tableTypes) != 0 && !q.tableTypes[table.TableType] {
+		return false
+	}
+	if q.owner != nil && !q.owner.Match(table.Owner) {
+		return false
+	}
+	if q.location != "" && !isSubLocation(sdLocation(table.Sd), q.location) {
+		return false
+	}
+	if q.createdAfter != 0 && int64(table.CreateTime) < q.createdAfter {
+		return false
+	}
+	if q.createdBefore != 0 && int64(table.CreateTime) >= q.createdBefore {
+		return false
+	}
+	for _, p := range q.params {
+		value, ok := table.Parameters[p.key]
+		if !ok || (p.value != nil && !p.value.Match(value)) {
+			return false
+		}
+	}
+	return true
+}
+
+// addSearchFlags adds search predicate flags to the command
+func addSearchFlags(cmd *cobra.Command) {
+	cmd.Flags().String(optColumn, "", "column name pattern")
+	cmd.Flags().String(optColumnType, "", "column type pattern")
+	cmd.Flags().StringArray(optParam, nil, "table parameter key=value, may be repeated")
+	cmd.Flags().String(optTableOwner, "", "table owner pattern")
+	cmd.Flags().StringSlice(optTableType, nil, "table types (managed, external, view)")
+	cmd.Flags().String(optLocation, "", "table location prefix")
+	cmd.Flags().String(optCreatedAfter, "", "tables created at or after the time")
+	cmd.Flags().String(optCreatedBefore, "", "tables created before the time")
+	cmd.Flags().Bool(optRegex, false, "patterns are regular expressions instead of globs")
+}
+
+func init() {
+	searchCmd.Flags().StringSliceP(optDbName, "d", nil, "databases to search, all if not specified")
+	addSearchFlags(searchCmd)
+	searchCmd.Flags().Int(optWorkers, 8, "number of databases searched concurrently")
+	searchCmd.Flags().Int(optBatchSize, defaultSearchBatch, "number of tables fetched per request")
+	rootCmd.AddCommand(searchCmd)
+}
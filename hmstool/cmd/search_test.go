@@ -0,0 +1,96 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+	"github.com/spf13/cobra"
+)
+
+func (f *fakeCatalog) GetTableObjects(dbName string, tableNames []string) ([]*hive_metastore.Table, error) {
+	var tables []*hive_metastore.Table
+	for _, name := range tableNames {
+		if table, ok := f.tables[dbName][name]; ok {
+			tables = append(tables, table)
+		}
+	}
+	return tables, nil
+}
+
+func TestSearch(t *testing.T) {
+	newTable := func(db, name, owner, location string, created int32, cols ...string) *hive_metastore.Table {
+		table := &hive_metastore.Table{DbName: db, TableName: name, Owner: owner, CreateTime: created,
+			TableType: hmsclient.TableTypeManaged.String(), Parameters: map[string]string{},
+			Sd: &hive_metastore.StorageDescriptor{Location: location}}
+		for i := 0; i < len(cols); i += 2 {
+			table.Sd.Cols = append(table.Sd.Cols, &hive_metastore.FieldSchema{Name: cols[i], Type: cols[i+1]})
+		}
+		return table
+	}
+	customers := newTable("sales", "customers", "etl", "hdfs://nn/data/raw/customers", 1538352000,
+		"id", "bigint", "ssn", "string", "email", "string")
+	customers.Parameters["EXTERNAL"] = "TRUE"
+	customers.TableType = hmsclient.TableTypeExternal.String()
+	orders := newTable("sales", "orders", "etl", "hdfs://nn/warehouse/sales.db/orders", 1541030400,
+		"order_id", "bigint", "customer_id", "bigint")
+	orders.PartitionKeys = []*hive_metastore.FieldSchema{{Name: "ds", Type: "string"}}
+	people := newTable("hr", "people", "hr", "hdfs://nn/data/raw2/people", 1538352000,
+		"ssn", "string", "name", "string")
+	catalog := &fakeCatalog{tables: map[string]map[string]*hive_metastore.Table{
+		"sales": {"customers": customers, "orders": orders},
+		"hr":    {"people": people},
+	}}
+
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"--column", "ssn"}, []string{"hr.people.ssn", "sales.customers.ssn"}},
+		{[]string{"--column", "*_id", "--column-type", "bigint"},
+			[]string{"sales.orders.customer_id", "sales.orders.order_id"}},
+		{[]string{"--regex", "--column", "^(ds|email)$"}, []string{"sales.customers.email", "sales.orders.ds"}},
+		{[]string{"--location", "hdfs://nn/data/raw"}, []string{"sales.customers"}},
+		{[]string{"--param", "EXTERNAL=T*"}, []string{"sales.customers"}},
+		{[]string{"--table-owner", "etl", "--table-type", "managed"}, []string{"sales.orders"}},
+		{[]string{"--created-after", "2018-10-15"}, []string{"sales.orders"}},
+		{[]string{"--created-before", "2018-10-15", "--column", "name"}, []string{"hr.people.name"}},
+	}
+	for _, test := range tests {
+		cmd := &cobra.Command{}
+		addSearchFlags(cmd)
+		if err := cmd.ParseFlags(test.args); err != nil {
+			t.Fatal(err)
+		}
+		q, err := newSearchQuery(cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := q.search([]searchSource{catalog, catalog}, []string{"hr", "sales"}, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, r := range results {
+			names = append(names, r.Name)
+		}
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("%v: expected %v, got %v", test.args, test.expected, names)
+		}
+	}
+}
@@ -63,7 +63,7 @@ func showTables(cmd *cobra.Command, args []string) {
 	if listFiles {
 		displayTableFiles(tables)
 	} else {
-		displayObject(&HmsObject{Tables: tables})
+		displayObject(cmd, &HmsObject{Tables: tables})
 	}
 }
 
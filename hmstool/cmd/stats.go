@@ -0,0 +1,337 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+	"github.com/akolb1/gometastore/hmstool/hmsutil"
+	"github.com/spf13/cobra"
+)
+
+const (
+	paramNumRows             = "numRows"
+	paramStatsGenerated      = "STATS_GENERATED"
+	paramColumnStatsAccurate = "COLUMN_STATS_ACCURATE"
+
+	statsGeneratedTask = "TASK"
+	basicStatsKey      = "BASIC_STATS"
+	columnStatsKey     = "COLUMN_STATS"
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "statistics operations",
+}
+
+var statsRefreshCmd = &cobra.Command{
+	Use:   "refresh",
+	Short: "recompute basic statistics from storage",
+	Run:   refreshStats,
+	Long: `Recompute basic statistics of a table or its partitions from storage.
+
+The numFiles and totalSize parameters are computed from the file system listing,
+ignoring hidden files the same way as Hive does. The numRows parameter is read from
+ORC and Parquet file footers. When some files are not readable ORC or Parquet files,
+numRows is left unchanged and basic statistics are marked as inaccurate.
+
+The results are written back with STATS_GENERATED set to TASK and
+COLUMN_STATS_ACCURATE updated. Column statistics are marked inaccurate when
+basic statistics change. Tables and partitions with empty or missing locations are
+reported and skipped, their statistics are left unchanged.
+
+For partitioned tables statistics of partitions are refreshed. Partitions can be
+selected with a server-side filter using --partitions.
+
+Examples:
+
+    hmstool stats refresh default.customers
+    hmstool stats refresh sales.orders --partitions "ds >= '2018-10-01'"
+    hmstool stats refresh sales.orders --dry-run
+`,
+}
+
+// statsTarget is the part of the metastore client used to refresh statistics
+type statsTarget interface {
+	exportSource
+	AlterTable(dbName string, tableName string, table *hive_metastore.Table) error
+	AlterPartitions(dbName string, tableName string, partitions []*hive_metastore.Partition) error
+}
+
+// basicStats are statistics computed from storage
+type basicStats struct {
+	Name      string `json:"name"`
+	Location  string `json:"location"`
+	Files     int64  `json:"numFiles"`
+	Bytes     int64  `json:"totalSize"`
+	Rows      int64  `json:"numRows"`
+	RowsKnown bool   `json:"numRowsKnown"`
+	Missing   bool   `json:"missing,omitempty"` // Location is empty or doesn't exist, statistics are not updated
+	Updated   bool   `json:"updated"`
+}
+
+var statsColumns = []column{
+	{"NAME", func(item interface{}) string { return item.(*basicStats).Name }},
+	{"FILES", func(item interface{}) string { return fmt.Sprint(item.(*basicStats).Files) }},
+	{"SIZE", func(item interface{}) string { return formatBytes(item.(*basicStats).Bytes) }},
+	{"ROWS", func(item interface{}) string {
+		s := item.(*basicStats)
+		if !s.RowsKnown {
+			return "-"
+		}
+		return fmt.Sprint(s.Rows)
+	}},
+	{"UPDATED", func(item interface{}) string {
+		s := item.(*basicStats)
+		if s.Missing {
+			return "missing location"
+		}
+		return strconv.FormatBool(s.Updated)
+	}},
+}
+
+func refreshStats(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		log.Fatal("table name should be specified")
+	}
+	dbName, tableName := getDbTableName(cmd, args[0])
+	if dbName == "" {
+		log.Fatal("missing database name")
+	}
+	client, err := getClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+
+	filter, _ := cmd.Flags().GetString(optPartitions)
+	workers, _ := cmd.Flags().GetInt(optWorkers)
+	dryRun, _ := cmd.Flags().GetBool(optDryRun)
+	stats, err := statsRefresh(client, dbName, tableName, filter, workers, dryRun)
+	if err != nil {
+		log.Fatal(err)
+	}
+	items := make([]interface{}, len(stats))
+	for i, s := range stats {
+		items[i] = s
+	}
+	data := &displayData{object: stats, sections: []displaySection{{items: items, columns: statsColumns}}}
+	if err = display(cmd, data, formatTable); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// statsRefresh recomputes statistics of the table or its partitions selected by
+// filter and writes changed statistics back unless dryRun is set.
+func statsRefresh(client statsTarget, dbName string, tableName string,
+	filter string, workers int, dryRun bool) ([]*basicStats, error) {
+	table, err := client.GetTable(dbName, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get table %s.%s: %v", dbName, tableName, err)
+	}
+	if table.TableType == hmsclient.TableTypeView.String() {
+		return nil, fmt.Errorf("%s.%s is a view", dbName, tableName)
+	}
+	name := dbName + "." + tableName
+
+	if len(table.PartitionKeys) == 0 {
+		if filter != "" {
+			return nil, fmt.Errorf("table %s is not partitioned", name)
+		}
+		stats := &basicStats{Name: name, Location: sdLocation(table.Sd)}
+		if err = stats.compute(); err != nil {
+			return nil, err
+		}
+		if table.Parameters == nil {
+			table.Parameters = make(map[string]string)
+		}
+		stats.Updated = !stats.Missing && stats.apply(table.Parameters)
+		if stats.Updated && !dryRun {
+			if err = client.AlterTable(dbName, tableName, table); err != nil {
+				return nil, fmt.Errorf("failed to update statistics of %s: %v", name, err)
+			}
+		}
+		return []*basicStats{stats}, nil
+	}
+
+	var partitions []*hive_metastore.Partition
+	if filter != "" {
+		names, err := client.GetPartitionNamesByFilter(dbName, tableName, filter, -1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get partitions for %s: %v", name, err)
+		}
+		if partitions, err = partitionsByNames(client, dbName, tableName, names); err != nil {
+			return nil, err
+		}
+	} else if partitions, err = tablePartitions(client, dbName, tableName); err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(table.PartitionKeys))
+	for i, k := range table.PartitionKeys {
+		keys[i] = k.Name
+	}
+	stats := make([]*basicStats, len(partitions))
+	for i, p := range partitions {
+		stats[i] = &basicStats{Name: name + "/" + hmsclient.MakePartName(keys, p.Values), Location: sdLocation(p.Sd)}
+	}
+	err = runParallel(workers, len(stats), func(i int) error {
+		return stats[i].compute()
+	})
+	if err != nil {
+		return nil, err
+	}
+	var changed []*hive_metastore.Partition
+	for i, p := range partitions {
+		if stats[i].Missing {
+			continue
+		}
+		if p.Parameters == nil {
+			p.Parameters = make(map[string]string)
+		}
+		if stats[i].Updated = stats[i].apply(p.Parameters); stats[i].Updated {
+			changed = append(changed, p)
+		}
+	}
+	if dryRun {
+		return stats, nil
+	}
+	for start := 0; start < len(changed); start += maxParts {
+		end := start + maxParts
+		if end > len(changed) {
+			end = len(changed)
+		}
+		if err = client.AlterPartitions(dbName, tableName, changed[start:end]); err != nil {
+			return nil, fmt.Errorf("failed to update statistics of %s partitions: %v", name, err)
+		}
+	}
+	return stats, nil
+}
+
+// compute walks the location and computes statistics. Row counts are read from
+// file footers, if any file can't be read the row count is unknown.
+func (s *basicStats) compute() error {
+	if s.Location == "" {
+		log.Printf("skipping %s: no location", s.Name)
+		s.Missing = true
+		return nil
+	}
+	s.RowsKnown = true
+	fs, err := hmsutil.GetFileSystem(s.Location)
+	if err != nil {
+		return fmt.Errorf("%s: %v", s.Name, err)
+	}
+	err = fs.Walk(s.Location, func(info hmsutil.FileInfo) error {
+		if isHidden(info.Name) {
+			if info.IsDir {
+				return hmsutil.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir {
+			return nil
+		}
+		s.Files++
+		s.Bytes += info.Size
+		if !s.RowsKnown {
+			return nil
+		}
+		rows, err := fileRowCount(fs, info)
+		if err != nil {
+			if err != hmsutil.ErrUnknownFormat {
+				log.Printf("can't read row count from %s: %v", info.Path, err)
+			}
+			s.RowsKnown = false
+			return nil
+		}
+		s.Rows += rows
+		return nil
+	})
+	if os.IsNotExist(err) {
+		// Missing location is reported rather than treated as empty
+		log.Printf("skipping %s: location %s does not exist", s.Name, s.Location)
+		s.Files, s.Bytes, s.Rows, s.RowsKnown = 0, 0, 0, false
+		s.Missing = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to walk %s for %s: %v", s.Location, s.Name, err)
+	}
+	return nil
+}
+
+func fileRowCount(fs hmsutil.FileSystem, info hmsutil.FileInfo) (int64, error) {
+	f, err := fs.Open(info.Path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return hmsutil.RowCount(f, info.Size)
+}
+
+// apply sets statistics parameters and returns true if parameters changed
+func (s *basicStats) apply(params map[string]string) bool {
+	old := make(map[string]string, len(params))
+	for k, v := range params {
+		old[k] = v
+	}
+	dataChanged := params[paramNumFiles] != fmt.Sprint(s.Files) ||
+		params[paramTotalSize] != fmt.Sprint(s.Bytes) ||
+		(s.RowsKnown && params[paramNumRows] != fmt.Sprint(s.Rows))
+	params[paramNumFiles] = fmt.Sprint(s.Files)
+	params[paramTotalSize] = fmt.Sprint(s.Bytes)
+	if s.RowsKnown {
+		params[paramNumRows] = fmt.Sprint(s.Rows)
+	}
+	params[paramStatsGenerated] = statsGeneratedTask
+
+	// COLUMN_STATS_ACCURATE is JSON like {"BASIC_STATS":"true","COLUMN_STATS":{"id":"true"}}
+	accurate := make(map[string]interface{})
+	if value := params[paramColumnStatsAccurate]; value != "" {
+		if err := json.Unmarshal([]byte(value), &accurate); err != nil {
+			accurate = make(map[string]interface{})
+		}
+	}
+	if dataChanged {
+		delete(accurate, columnStatsKey)
+	}
+	if s.RowsKnown {
+		accurate[basicStatsKey] = "true"
+	} else {
+		delete(accurate, basicStatsKey)
+	}
+	if len(accurate) == 0 {
+		delete(params, paramColumnStatsAccurate)
+	} else {
+		b, _ := json.Marshal(accurate)
+		params[paramColumnStatsAccurate] = string(b)
+	}
+	return !reflect.DeepEqual(old, params)
+}
+
+func init() {
+	statsRefreshCmd.Flags().StringP(optDbName, "d", "", "database name")
+	statsRefreshCmd.Flags().String(optPartitions, "", "server-side filter selecting partitions")
+	statsRefreshCmd.Flags().Int(optWorkers, 8, "number of locations processed concurrently")
+	statsRefreshCmd.Flags().Bool(optDryRun, false, "only show statistics, don't update HMS")
+	statsCmd.AddCommand(statsRefreshCmd)
+	rootCmd.AddCommand(statsCmd)
+}
@@ -0,0 +1,136 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+)
+
+func (f *fakeCatalog) AlterTable(dbName string, tableName string, table *hive_metastore.Table) error {
+	f.tables[dbName][tableName] = table
+	return nil
+}
+
+func (f *fakeCatalog) AlterPartitions(dbName string, tableName string,
+	partitions []*hive_metastore.Partition) error {
+	// Partitions are altered in place
+	return nil
+}
+
+// uncompressedORC returns minimal ORC file with the given number of rows
+func uncompressedORC(rows byte) []byte {
+	footer := []byte{6 << 3, rows}                      // numberOfRows
+	ps := []byte{1 << 3, byte(len(footer)), 2 << 3, 0}  // footerLength, compression NONE
+	ps = append(ps, 0x82, 0xf4, 0x03, 3, 'O', 'R', 'C') // magic, field 8000
+	data := append([]byte("ORC...stripes..."), footer...)
+	data = append(data, ps...)
+	return append(data, byte(len(ps)))
+}
+
+func TestStatsRefresh(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"orders/ds=1/part-0.orc": uncompressedORC(10),
+		"orders/ds=1/part-1.orc": uncompressedORC(5),
+		"orders/ds=1/_SUCCESS":   nil,
+		"orders/ds=2/part-0.txt": []byte("1,2\n3,4\n"),
+		"items/part-0.orc":       uncompressedORC(7),
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	location := "file://" + filepath.ToSlash(dir)
+	orders, ordersParts := deltaTestTable("orders", "1", "2", "3", "4")
+	for _, p := range ordersParts {
+		p.Sd.Location = location + "/orders/ds=" + p.Values[0]
+		p.Parameters = map[string]string{paramNumFiles: "1", paramTotalSize: "1", paramNumRows: "100",
+			paramColumnStatsAccurate: `{"BASIC_STATS":"true","COLUMN_STATS":{"id":"true"}}`}
+	}
+	ordersParts[3].Sd.Location = ""
+	items := &hive_metastore.Table{DbName: "sales", TableName: "items",
+		Sd: &hive_metastore.StorageDescriptor{Location: location + "/items"}}
+	catalog := &fakeCatalog{
+		tables:     map[string]map[string]*hive_metastore.Table{"sales": {"orders": orders, "items": items}},
+		partitions: map[string][]*hive_metastore.Partition{"sales.orders": ordersParts},
+	}
+
+	stats, err := statsRefresh(catalog, "sales", "items", "", 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := catalog.tables["sales"]["items"].Parameters
+	if !stats[0].Updated || params[paramNumRows] != "7" || params[paramNumFiles] != "1" ||
+		params[paramStatsGenerated] != statsGeneratedTask ||
+		params[paramColumnStatsAccurate] != `{"BASIC_STATS":"true"}` {
+		t.Errorf("unexpected table parameters %v", params)
+	}
+	if stats, _ = statsRefresh(catalog, "sales", "items", "", 1, false); stats[0].Updated {
+		t.Error("second refresh should not change statistics")
+	}
+
+	// Filter selects partitions to refresh
+	if stats, err = statsRefresh(catalog, "sales", "orders", `ds = "1"`, 2, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || ordersParts[1].Parameters[paramTotalSize] != "1" {
+		t.Errorf("only ds=1 should be refreshed, got %d partitions", len(stats))
+	}
+
+	if _, err = statsRefresh(catalog, "sales", "orders", "", 2, false); err != nil {
+		t.Fatal(err)
+	}
+	p1, p2 := ordersParts[0].Parameters, ordersParts[1].Parameters
+	if p1[paramNumFiles] != "2" || p1[paramNumRows] != "15" ||
+		p1[paramColumnStatsAccurate] != `{"BASIC_STATS":"true"}` {
+		t.Errorf("unexpected parameters of ds=1: %v", p1)
+	}
+	// Text file has unknown row count, so numRows is kept and stats are inaccurate
+	if p2[paramNumFiles] != "1" || p2[paramTotalSize] != "8" || p2[paramNumRows] != "100" {
+		t.Errorf("unexpected parameters of ds=2: %v", p2)
+	}
+	if _, ok := p2[paramColumnStatsAccurate]; ok {
+		t.Errorf("expected %s to be removed for ds=2: %v", paramColumnStatsAccurate, p2)
+	}
+
+	// Missing and empty locations are reported and their statistics are left unchanged
+	for _, p := range ordersParts[2:] {
+		if params := p.Parameters; params[paramNumFiles] != "1" || params[paramTotalSize] != "1" ||
+			params[paramNumRows] != "100" || params[paramColumnStatsAccurate] == "" {
+			t.Errorf("statistics of ds=%s should not change: %v", p.Values[0], params)
+		}
+	}
+	stats, _ = statsRefresh(catalog, "sales", "orders", `ds = "3"`, 1, false)
+	if len(stats) != 1 || !stats[0].Missing || stats[0].Updated {
+		t.Errorf("ds=3 should be reported as missing, got %+v", stats)
+	}
+	catalog.tables["sales"]["items"].Sd.Location = location + "/gone"
+	if stats, err = statsRefresh(catalog, "sales", "items", "", 1, false); err != nil {
+		t.Fatal(err)
+	}
+	if !stats[0].Missing || stats[0].Updated || params[paramNumRows] != "7" {
+		t.Errorf("missing table location should not change statistics: %+v %v", stats[0], params)
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/akolb1/gometastore/hmsclient"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+)
+
+const (
+	formatNDJSON = "ndjson"
+
+	kindSnapshot = "snapshot"
+
+	// Partition batches buffered for each table during streaming import
+	streamBatches = 2
+)
+
+// ndjsonPrefix is the beginning of every NDJSON record
+var ndjsonPrefix = []byte(`{"kind":`)
+
+// streamRecord is a single line of NDJSON export. Exactly one of the objects is set
+// according to the record kind.
+type streamRecord struct {
+	Kind      string                    `json:"kind"`
+	Snapshot  *SnapshotInfo             `json:"snapshot,omitempty"`
+	Database  *hmsclient.Database       `json:"database,omitempty"`
+	Table     *hive_metastore.Table     `json:"table,omitempty"`
+	Partition *hive_metastore.Partition `json:"partition,omitempty"`
+	Tombstone *Tombstone                `json:"tombstone,omitempty"`
+}
+
+// exportSink receives exported objects
+type exportSink interface {
+	setSnapshot(info *SnapshotInfo) error
+	addDatabase(db *hmsclient.Database) error
+	addTable(table *hive_metastore.Table) error
+	addPartitions(partitions []*hive_metastore.Partition) error
+	addTombstone(t *Tombstone) error
+}
+
+func (hmsObject *HmsObject) setSnapshot(info *SnapshotInfo) error {
+	hmsObject.Snapshot = info
+	return nil
+}
+
+func (hmsObject *HmsObject) addTombstone(t *Tombstone) error {
+	hmsObject.Tombstones = append(hmsObject.Tombstones, t)
+	return nil
+}
+
+func (hmsObject *HmsObject) addDatabase(db *hmsclient.Database) error {
+	hmsObject.Databases = append(hmsObject.Databases, db)
+	return nil
+}
+
+func (hmsObject *HmsObject) addTable(table *hive_metastore.Table) error {
+	hmsObject.Tables = append(hmsObject.Tables, table)
+	return nil
+}
+
+func (hmsObject *HmsObject) addPartitions(partitions []*hive_metastore.Partition) error {
+	hmsObject.Partitions = append(hmsObject.Partitions, partitions...)
+	return nil
+}
+
+// recordWriter writes exported objects as NDJSON records
+type recordWriter struct {
+	encoder *json.Encoder
+}
+
+func newRecordWriter(w io.Writer) *recordWriter {
+	return &recordWriter{encoder: json.NewEncoder(w)}
+}
+
+// setSnapshot writes snapshot record. It is written both at the beginning of the stream
+// and at the end, when the ID of the last event is known.
+func (rw *recordWriter) setSnapshot(info *SnapshotInfo) error {
+	return rw.encoder.Encode(&streamRecord{Kind: kindSnapshot, Snapshot: info})
+}
+
+func (rw *recordWriter) addTombstone(t *Tombstone) error {
+	return rw.encoder.Encode(&streamRecord{Kind: kindTombstone, Tombstone: t})
+}
+
+func (rw *recordWriter) addDatabase(db *hmsclient.Database) error {
+	return rw.encoder.Encode(&streamRecord{Kind: kindDatabase, Database: db})
+}
+
+func (rw *recordWriter) addTable(table *hive_metastore.Table) error {
+	return rw.encoder.Encode(&streamRecord{Kind: kindTable, Table: table})
+}
+
+func (rw *recordWriter) addPartitions(partitions []*hive_metastore.Partition) error {
+	for _, p := range partitions {
+		if err := rw.encoder.Encode(&streamRecord{Kind: kindPartition, Partition: p}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isNDJSON returns true if the data looks like NDJSON export.
+func isNDJSON(r *bufio.Reader) bool {
+	// Short data is returned with an error which doesn't matter here
+	data, _ := r.Peek(512)
+	return bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), ndjsonPrefix)
+}
+
+// importStream imports NDJSON records. Databases are imported as they are read,
+// tables are imported by workers while partitions are fed to workers in batches,
+// so only a few batches are kept in memory.
+//
+// Partitions are expected to follow their table, as written by export. Partitions of
+// tables which are not in the stream are added to existing tables. Tombstones are
+// applied as they are read, export writes them before all other objects.
+func (im *importer) importStream(r io.Reader) error {
+	if err := im.start(); err != nil {
+		return err
+	}
+	// Delta is recognized by the leading snapshot record before workers start
+	decoder := json.NewDecoder(r)
+	record := new(streamRecord)
+	if err := decoder.Decode(record); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return fmt.Errorf("invalid record 1: %v", err)
+	}
+	if record.Kind == kindSnapshot && record.Snapshot != nil && record.Snapshot.Delta {
+		im.delta = true
+	}
+
+	jobs := make(chan *tableJob)
+	var wg sync.WaitGroup
+	if err := im.startWorkers(jobs, &wg); err != nil {
+		return err
+	}
+	defer wg.Wait()
+	defer close(jobs)
+
+	var job *tableJob
+	var batch []*hive_metastore.Partition
+	finishJob := func() {
+		if job == nil {
+			return
+		}
+		if len(batch) != 0 {
+			job.batches <- batch
+		}
+		close(job.batches)
+		job, batch = nil, nil
+	}
+	defer finishJob()
+
+	for line := 1; ; line++ {
+		if line > 1 {
+			record = new(streamRecord)
+			if err := decoder.Decode(record); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return fmt.Errorf("invalid record %d: %v", line, err)
+			}
+		}
+		switch {
+		case record.Kind == kindSnapshot:
+			// Snapshot is written both before and after objects, only the leading
+			// record matters for import.
+		case record.Kind == kindTombstone && record.Tombstone != nil:
+			im.applyTombstone(record.Tombstone)
+		case record.Kind == kindDatabase && record.Database != nil:
+			im.importDatabase(record.Database)
+		case record.Kind == kindTable && record.Table != nil:
+			finishJob()
+			job = newTableJob(record.Table.DbName, record.Table.TableName, record.Table, streamBatches)
+			jobs <- job
+		case record.Kind == kindPartition && record.Partition != nil:
+			p := record.Partition
+			if job == nil || job.dbName != p.DbName || job.tableName != p.TableName {
+				finishJob()
+				job = newTableJob(p.DbName, p.TableName, nil, streamBatches)
+				jobs <- job
+			}
+			batch = append(batch, p)
+			if len(batch) >= im.opts.batchSize {
+				job.batches <- batch
+				batch = nil
+			}
+		default:
+			return fmt.Errorf("invalid record %d: unknown kind %q", line, record.Kind)
+		}
+	}
+}
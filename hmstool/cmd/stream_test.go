@@ -0,0 +1,81 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+)
+
+// writeDump writes test dump in the given format, compressed according to the file name
+func writeDump(t *testing.T, fileName string, format string) {
+	w, err := createOutput(fileName, compressionFromName(fileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hms := testDump()
+	if format == formatNDJSON {
+		rw := newRecordWriter(w)
+		rw.addDatabase(hms.Databases[0])
+		for _, table := range hms.Tables {
+			rw.addTable(table)
+			for _, p := range hms.Partitions {
+				if p.TableName == table.TableName {
+					rw.addPartitions([]*hive_metastore.Partition{p})
+				}
+			}
+		}
+	} else {
+		json.NewEncoder(w).Encode(hms)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportFileFormats(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		fileName string
+		format   string
+	}{
+		{"dump.json", formatJSON},
+		{"dump.json.gz", formatJSON},
+		{"dump.ndjson", formatNDJSON},
+		{"dump.ndjson.gz", formatNDJSON},
+		{"dump.ndjson.zst", formatNDJSON},
+	}
+	for _, test := range tests {
+		if got := formatFromName(test.fileName); got != test.format {
+			t.Errorf("%s: expected format %s, got %s", test.fileName, test.format, got)
+		}
+		fileName := filepath.Join(dir, test.fileName)
+		writeDump(t, fileName, test.format)
+		target := newFakeTarget()
+		im := newTestImporter(t, target, fileName+journalSuffix, conflictSkip)
+		if err := im.importFile(fileName); err != nil {
+			t.Fatalf("%s: %v", test.fileName, err)
+		}
+		checkCounts(t, im.report, kindDatabase, map[string]int{resultCreated: 1})
+		checkCounts(t, im.report, kindTable, map[string]int{resultCreated: 2})
+		checkCounts(t, im.report, kindPartition, map[string]int{resultCreated: 10})
+		if len(target.partitions) != 10 {
+			t.Errorf("%s: expected 10 partitions, got %d", test.fileName, len(target.partitions))
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"log"
+	"strings"
+
+	"github.com/akolb1/gometastore/hmsclient/ddl"
+	"github.com/akolb1/gometastore/hmsclient/thrift/gen-go/hive_metastore"
+	"github.com/spf13/cobra"
+)
+
+const (
+	optWithPartitions = "with-partitions"
+)
+
+var tableDdlCmd = &cobra.Command{
+	Use:   "ddl",
+	Short: "Show table DDL",
+	Run:   showTableDdl,
+	Long: `Show HiveQL statements that can be used to re-create tables or views,
+similar to SHOW CREATE TABLE. With --with-partitions flag ALTER TABLE ADD PARTITION
+statements are added for all table partitions.
+
+Example:
+
+    hmstool table ddl default.customers default.web_logs
+    hmstool table ddl -d default customers --with-partitions -o customers.sql
+`,
+}
+
+func showTableDdl(cmd *cobra.Command, args []string) {
+	client, err := getClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+	if len(args) == 0 {
+		if table, _ := cmd.Flags().GetString(optTableName); table != "" {
+			args = []string{table}
+		}
+	}
+	withPartitions, _ := cmd.Flags().GetBool(optWithPartitions)
+	hmsObject := new(HmsObject)
+	for _, arg := range args {
+		dbName, tableName := getDbTableName(cmd, arg)
+		if err = exportTable(client, hmsObject, dbName, tableName, withPartitions, nil); err != nil {
+			log.Fatal(err)
+		}
+	}
+	displayText(renderSQL(hmsObject))
+}
+
+// renderSQL converts HMS objects to HiveQL script. Databases go first, followed by tables,
+// each table followed by its partitions.
+func renderSQL(hmsObject *HmsObject) string {
+	var b strings.Builder
+	for _, db := range hmsObject.Databases {
+		b.WriteString(ddl.CreateDatabase(db))
+		b.WriteString("\n")
+	}
+	partitions := make(map[string][]*hive_metastore.Partition)
+	for _, p := range hmsObject.Partitions {
+		name := p.DbName + "." + p.TableName
+		partitions[name] = append(partitions[name], p)
+	}
+	for _, table := range hmsObject.Tables {
+		b.WriteString(ddl.CreateTable(table))
+		if parts := partitions[table.DbName+"."+table.TableName]; len(parts) != 0 {
+			b.WriteString(ddl.AddPartitions(table, parts))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func init() {
+	tableDdlCmd.Flags().Bool(optWithPartitions, false, "include partitions")
+	tablesCmd.AddCommand(tableDdlCmd)
+}
@@ -44,17 +44,23 @@ and server-side filtering is done by 'select command'.
 
 var tableDropCmd = &cobra.Command{
 	Use:   "drop",
-	Short: "drop table",
+	Short: "drop tables",
 	Run:   dropTable,
-	Long: `drop Give table. The table can be specified with '-t' flag or as the single argument.
-The database can be specified with '-d' flag or iwth the table name which can be of the form
-'dbName.tableName'.
+	Long: `Drop tables matching the given patterns together with their data.
+
+The table can be specified with '-t' flag or as arguments. The database can be specified
+with '-d' flag or with the table name which can be of the form 'dbName.tableName'.
+Both database and table names may be glob patterns. The list of matching tables is shown
+and tables are dropped after confirmation, use --yes to skip confirmation or --dry-run
+to only show matching tables. The command fails when confirmation is refused.
 
     Example:
 
   hmstool table drop default.foo
   hmstool table drop -d default foo
   hmstool table drop -d default -t foo
+  hmstool table drop -d staging 'tmp_*'
+  hmstool table drop 'scratch_*.*' --yes
 `,
 }
 
@@ -75,29 +81,21 @@ func getDbTableName(cmd *cobra.Command, arg string) (dbName string, tableName st
 }
 
 func dropTable(cmd *cobra.Command, args []string) {
-	client, err := getClient()
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer client.Close()
-	for _, tableName := range args {
-		dbName, tableName := getDbTableName(cmd, tableName)
-		if dbName == "" {
-			log.Fatalln("missing database name")
-		}
+	patterns := args
+	if len(patterns) == 0 {
+		tableName, _ := cmd.Flags().GetString(optTableName)
 		if tableName == "" {
 			log.Fatalln("missing table name")
 		}
-		err = client.DropTable(dbName, tableName, true)
-		if err != nil {
-			log.Fatalf("failed to drop table %s.%s: %v\n", dbName, tableName, err)
-		}
+		patterns = []string{tableName}
 	}
+	bulkTables(cmd, patterns, "drop", dropTableOp)
 }
 
 func init() {
 	tablesCmd.AddCommand(showPartitionsCmd)
 	tablesCmd.AddCommand(showPartitionCmd)
+	addBulkFlags(tableDropCmd)
 	tablesCmd.AddCommand(tableDropCmd)
 	rootCmd.AddCommand(tablesCmd)
 
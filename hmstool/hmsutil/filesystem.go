@@ -0,0 +1,178 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hmsutil
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileInfo describes a file or a directory
+type FileInfo struct {
+	Name    string    // Base name of the file
+	Path    string    // Full location of the file, including scheme and host
+	Size    int64     // Size in bytes, zero for directories
+	ModTime time.Time // Modification time
+	IsDir   bool
+}
+
+// WalkFunc is called by Walk for each file and directory. If the function returns
+// SkipDir for a directory, Walk skips the directory contents. Any other error stops
+// the walk.
+type WalkFunc func(info FileInfo) error
+
+// SkipDir is returned by WalkFunc to skip the directory
+var SkipDir = filepath.SkipDir
+
+// FileSystem is a file system holding table and partition data.
+// All locations are full URIs, like hdfs://host:port/path or file:///path.
+type FileSystem interface {
+	// List returns files and directories in the given directory sorted by name
+	List(location string) ([]FileInfo, error)
+	// Stat returns information about a single file or directory
+	Stat(location string) (FileInfo, error)
+	// Walk calls fn for every file and directory below the location,
+	// in lexical order. The location itself is not passed to fn.
+	Walk(location string, fn WalkFunc) error
+	// RemoveAll removes the file or directory with all its contents
+	RemoveAll(location string) error
+	// Open opens the file for random access reads
+	Open(location string) (File, error)
+}
+
+// File is an open file
+type File interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// FileSystemFactory creates file system for the given location. File systems are
+// cached by scheme and host, so the factory is called once for each host.
+type FileSystemFactory func(u *url.URL) (FileSystem, error)
+
+var (
+	registryLock sync.Mutex
+	factories    = make(map[string]FileSystemFactory)
+	fileSystems  = make(map[string]FileSystem)
+)
+
+// RegisterFileSystem registers file system factory for the URI scheme.
+// Registering a scheme again replaces the previous factory.
+func RegisterFileSystem(scheme string, factory FileSystemFactory) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	scheme = strings.ToLower(scheme)
+	factories[scheme] = factory
+	// Forget file systems created by the old factory
+	for key := range fileSystems {
+		if strings.HasPrefix(key, scheme+"://") {
+			delete(fileSystems, key)
+		}
+	}
+}
+
+// GetFileSystem returns file system for the location. Locations without scheme
+// are assumed to be on HDFS.
+func GetFileSystem(location string) (FileSystem, error) {
+	scheme, host, _ := splitLocation(location)
+	scheme = strings.ToLower(scheme)
+	if scheme == "" {
+		scheme = "hdfs"
+	}
+	u := &url.URL{Scheme: scheme, Host: host}
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	key := scheme + "://" + host
+	if fs, ok := fileSystems[key]; ok {
+		return fs, nil
+	}
+	factory, ok := factories[scheme]
+	if !ok {
+		return nil, fmt.Errorf("unsupported file system %s in %s", scheme, location)
+	}
+	fs, err := factory(u)
+	if err != nil {
+		return nil, err
+	}
+	fileSystems[key] = fs
+	return fs, nil
+}
+
+// List files in the given location
+func ListFiles(location string) ([]string, error) {
+	return listNames(location, false)
+}
+
+// ListDirectories returns names of subdirectories in the given location
+func ListDirectories(location string) ([]string, error) {
+	return listNames(location, true)
+}
+
+func listNames(location string, dirs bool) ([]string, error) {
+	fs, err := GetFileSystem(location)
+	if err != nil {
+		return nil, err
+	}
+	files, err := fs.List(location)
+	if err != nil {
+		return nil, err
+	}
+	result := []string{}
+	for _, file := range files {
+		if file.IsDir == dirs {
+			result = append(result, file.Name)
+		}
+	}
+	return result, nil
+}
+
+// joinLocation appends name to the location. Names are used as is, without escaping.
+func joinLocation(location string, name string) string {
+	return strings.TrimSuffix(location, "/") + "/" + name
+}
+
+// sortFiles sorts files by name
+func sortFiles(files []FileInfo) {
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+}
+
+// walkTree implements Walk for file systems with real directories using List
+func walkTree(fs FileSystem, location string, fn WalkFunc) error {
+	files, err := fs.List(location)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		err = fn(file)
+		if file.IsDir {
+			if err == SkipDir {
+				continue
+			}
+			if err == nil {
+				err = walkTree(fs, file.Path, fn)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package hmsutil
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLocalFileSystem(t *testing.T) {
+	dir := t.TempDir()
+	for _, d := range []string{"ds=1", "ds=2/hr=00"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.FromSlash(d)), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, size := range map[string]int{"ds=1/a": 3, "ds=2/hr=00/b": 5, "c": 7} {
+		if err := ioutil.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	location := "file://" + filepath.ToSlash(dir)
+	fs, err := GetFileSystem(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var walked []string
+	var total int64
+	err = fs.Walk(location, func(info FileInfo) error {
+		walked = append(walked, strings.TrimPrefix(info.Path, location+"/"))
+		total += info.Size
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"c", "ds=1", "ds=1/a", "ds=2", "ds=2/hr=00", "ds=2/hr=00/b"}
+	if !reflect.DeepEqual(walked, expected) {
+		t.Errorf("expected walk %v, got %v", expected, walked)
+	}
+	if total != 15 {
+		t.Errorf("expected total size 15, got %d", total)
+	}
+
+	dirs, err := ListDirectories(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dirs, []string{"ds=1", "ds=2"}) {
+		t.Errorf("unexpected directories %v", dirs)
+	}
+	files, err := ListFiles(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(files, []string{"c"}) {
+		t.Errorf("unexpected files %v", files)
+	}
+	info, err := fs.Stat(location + "/ds=1/a")
+	if err != nil || info.Size != 3 || info.IsDir {
+		t.Errorf("unexpected stat result %+v, %v", info, err)
+	}
+}
+
+func TestLocalEscapedNames(t *testing.T) {
+	// Partition directories contain escaped values which should not be decoded
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "ds=a%3Ab", "h=1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "ds=a%3Ab", "h=1", "f"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	location := "file://" + filepath.ToSlash(dir)
+	fs, err := GetFileSystem(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var walked []string
+	err = fs.Walk(location, func(info FileInfo) error {
+		walked = append(walked, strings.TrimPrefix(info.Path, location+"/"))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"ds=a%3Ab", "ds=a%3Ab/h=1", "ds=a%3Ab/h=1/f"}
+	if !reflect.DeepEqual(walked, expected) {
+		t.Errorf("expected walk %v, got %v", expected, walked)
+	}
+	if info, err := fs.Stat(location + "/ds=a%3Ab/h=1/f"); err != nil || info.Size != 4 {
+		t.Errorf("unexpected stat result %+v, %v", info, err)
+	}
+}
+
+func TestFileSystemRegistry(t *testing.T) {
+	if _, err := GetFileSystem("abfs://container@account/path"); err == nil {
+		t.Error("expected error for unknown scheme")
+	}
+	var lock sync.Mutex
+	created := make(map[string]int)
+	RegisterFileSystem("test", func(u *url.URL) (FileSystem, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		created[u.Host]++
+		return localFileSystem{}, nil
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			if _, err := GetFileSystem("TEST://" + host + "/path"); err != nil {
+				t.Error(err)
+			}
+		}([]string{"a", "b"}[i%2])
+	}
+	wg.Wait()
+	if !reflect.DeepEqual(created, map[string]int{"a": 1, "b": 1}) {
+		t.Errorf("expected one file system per host, got %v", created)
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hmsutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	parquetMagic = "PAR1"
+	orcMagic     = "ORC"
+
+	// Field numbers of row count in file footers
+	parquetNumRowsField = 3 // FileMetaData.num_rows
+	orcNumRowsField     = 6 // Footer.numberOfRows
+
+	// ORC PostScript fields
+	orcFooterLengthField = 1
+	orcCompressionField  = 2
+	orcMagicField        = 8000
+
+	// ORC compression kinds
+	orcNone   = 0
+	orcZlib   = 1
+	orcSnappy = 2
+	orcZstd   = 5
+)
+
+// ErrUnknownFormat is returned by RowCount for files which are neither ORC nor Parquet
+var ErrUnknownFormat = errors.New("unknown file format")
+
+// RowCount returns number of rows in ORC or Parquet file, read from the file footer.
+// It returns ErrUnknownFormat for files in other formats.
+func RowCount(f File, size int64) (int64, error) {
+	if size < int64(len(parquetMagic)) {
+		return 0, ErrUnknownFormat
+	}
+	head := make([]byte, len(parquetMagic))
+	if _, err := f.ReadAt(head, 0); err != nil {
+		return 0, err
+	}
+	switch {
+	case string(head) == parquetMagic:
+		return parquetRowCount(f, size)
+	case string(head[:len(orcMagic)]) == orcMagic:
+		return orcRowCount(f, size)
+	}
+	return 0, ErrUnknownFormat
+}
+
+// readTail reads length bytes ending at the given offset
+func readTail(f File, end int64, length int64) ([]byte, error) {
+	if length < 0 || length > end {
+		return nil, fmt.Errorf("invalid footer length %d", length)
+	}
+	b := make([]byte, length)
+	if _, err := f.ReadAt(b, end-length); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// parquetRowCount reads num_rows from Parquet FileMetaData. The file ends with
+// Thrift-encoded metadata, 4-byte metadata length and magic.
+func parquetRowCount(f File, size int64) (int64, error) {
+	tail, err := readTail(f, size, 8)
+	if err != nil {
+		return 0, err
+	}
+	if string(tail[4:]) != parquetMagic {
+		return 0, fmt.Errorf("invalid Parquet file: missing footer magic")
+	}
+	footer, err := readTail(f, size-8, int64(binary.LittleEndian.Uint32(tail[:4])))
+	if err != nil {
+		return 0, fmt.Errorf("invalid Parquet file: %v", err)
+	}
+	buf := thrift.NewTMemoryBufferLen(len(footer))
+	buf.Write(footer)
+	protocol := thrift.NewTCompactProtocol(buf)
+	ctx := context.Background()
+	if _, err = protocol.ReadStructBegin(ctx); err != nil {
+		return 0, err
+	}
+	for {
+		_, fieldType, id, err := protocol.ReadFieldBegin(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("invalid Parquet footer: %v", err)
+		}
+		if fieldType == thrift.STOP {
+			return 0, fmt.Errorf("invalid Parquet footer: missing num_rows")
+		}
+		if id == parquetNumRowsField && fieldType == thrift.I64 {
+			return protocol.ReadI64(ctx)
+		}
+		if err = thrift.SkipDefaultDepth(ctx, protocol, fieldType); err != nil {
+			return 0, fmt.Errorf("invalid Parquet footer: %v", err)
+		}
+		if err = protocol.ReadFieldEnd(ctx); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// orcRowCount reads numberOfRows from ORC footer. The file ends with protobuf
+// encoded footer, postscript and a single byte with postscript length.
+// The postscript is never compressed, the footer is compressed with the file codec.
+func orcRowCount(f File, size int64) (int64, error) {
+	last, err := readTail(f, size, 1)
+	if err != nil {
+		return 0, err
+	}
+	psLength := int64(last[0])
+	ps, err := readTail(f, size-1, psLength)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ORC file: %v", err)
+	}
+	postscript, err := protoFields(ps)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ORC postscript: %v", err)
+	}
+	if string(postscript[orcMagicField].bytes) != orcMagic {
+		return 0, fmt.Errorf("invalid ORC file: missing postscript magic")
+	}
+	footer, err := readTail(f, size-1-psLength, int64(postscript[orcFooterLengthField].varint))
+	if err != nil {
+		return 0, fmt.Errorf("invalid ORC file: %v", err)
+	}
+	footer, err = orcDecompress(footer, postscript[orcCompressionField].varint)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ORC footer: %v", err)
+	}
+	fields, err := protoFields(footer)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ORC footer: %v", err)
+	}
+	return int64(fields[orcNumRowsField].varint), nil
+}
+
+// orcDecompress decompresses ORC stream. Compressed streams consist of chunks,
+// each with 3-byte header holding chunk length and a flag for uncompressed chunks.
+func orcDecompress(data []byte, compression uint64) ([]byte, error) {
+	if compression == orcNone {
+		return data, nil
+	}
+	var result []byte
+	for len(data) != 0 {
+		if len(data) < 3 {
+			return nil, fmt.Errorf("truncated chunk header")
+		}
+		header := int(data[0]) | int(data[1])<<8 | int(data[2])<<16
+		length := header >> 1
+		data = data[3:]
+		if length > len(data) {
+			return nil, fmt.Errorf("truncated chunk")
+		}
+		chunk := data[:length]
+		data = data[length:]
+		if header&1 == 1 {
+			result = append(result, chunk...)
+			continue
+		}
+		var err error
+		switch compression {
+		case orcZlib:
+			chunk, err = ioutil.ReadAll(flate.NewReader(bytes.NewReader(chunk)))
+		case orcSnappy:
+			chunk, err = snappy.Decode(nil, chunk)
+		case orcZstd:
+			var decoder *zstd.Decoder
+			if decoder, err = zstd.NewReader(nil); err == nil {
+				chunk, err = decoder.DecodeAll(chunk, nil)
+				decoder.Close()
+			}
+		default:
+			return nil, fmt.Errorf("unsupported compression kind %d", compression)
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, chunk...)
+	}
+	return result, nil
+}
+
+// protoField is a value of protobuf field, either varint or length-delimited bytes
+type protoField struct {
+	varint uint64
+	bytes  []byte
+}
+
+// protoFields decodes top-level fields of protobuf message. Fixed-size fields
+// are skipped, for repeated fields the last value is kept.
+func protoFields(data []byte) (map[uint64]protoField, error) {
+	fields := make(map[uint64]protoField)
+	for len(data) != 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid field key")
+		}
+		data = data[n:]
+		field := key >> 3
+		switch key & 7 {
+		case 0: // varint
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return nil, fmt.Errorf("invalid varint in field %d", field)
+			}
+			fields[field] = protoField{varint: v}
+			data = data[n:]
+		case 1: // fixed64
+			if len(data) < 8 {
+				return nil, fmt.Errorf("truncated field %d", field)
+			}
+			data = data[8:]
+		case 2: // length-delimited
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return nil, fmt.Errorf("truncated field %d", field)
+			}
+			fields[field] = protoField{bytes: data[n : n+int(length)]}
+			data = data[n+int(length):]
+		case 5: // fixed32
+			if len(data) < 4 {
+				return nil, fmt.Errorf("truncated field %d", field)
+			}
+			data = data[4:]
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d in field %d", key&7, field)
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,116 @@
+package hmsutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/klauspost/compress/flate"
+)
+
+type memFile struct {
+	*bytes.Reader
+}
+
+func (memFile) Close() error { return nil }
+
+// parquetFile returns minimal Parquet file with FileMetaData holding version,
+// schema and row count.
+func parquetFile(t *testing.T, rows int64) []byte {
+	ctx := context.Background()
+	buf := thrift.NewTMemoryBuffer()
+	p := thrift.NewTCompactProtocol(buf)
+	p.WriteStructBegin(ctx, "FileMetaData")
+	p.WriteFieldBegin(ctx, "version", thrift.I32, 1)
+	p.WriteI32(ctx, 1)
+	p.WriteFieldEnd(ctx)
+	p.WriteFieldBegin(ctx, "schema", thrift.LIST, 2)
+	p.WriteListBegin(ctx, thrift.STRUCT, 1)
+	p.WriteStructBegin(ctx, "SchemaElement")
+	p.WriteFieldBegin(ctx, "name", thrift.STRING, 4)
+	p.WriteString(ctx, "schema")
+	p.WriteFieldEnd(ctx)
+	p.WriteFieldStop(ctx)
+	p.WriteStructEnd(ctx)
+	p.WriteListEnd(ctx)
+	p.WriteFieldEnd(ctx)
+	p.WriteFieldBegin(ctx, "num_rows", thrift.I64, 3)
+	p.WriteI64(ctx, rows)
+	p.WriteFieldEnd(ctx)
+	p.WriteFieldStop(ctx)
+	p.WriteStructEnd(ctx)
+	if err := p.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	footer := buf.Bytes()
+	var file bytes.Buffer
+	file.WriteString("PAR1")
+	file.WriteString("column data")
+	file.Write(footer)
+	binary.Write(&file, binary.LittleEndian, uint32(len(footer)))
+	file.WriteString("PAR1")
+	return file.Bytes()
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return append(b, buf[:binary.PutUvarint(buf, v)]...)
+}
+
+// orcFile returns minimal ORC file with zlib-compressed footer
+func orcFile(t *testing.T, rows uint64) []byte {
+	varint := func(b []byte, field uint64, v uint64) []byte {
+		b = appendUvarint(b, field<<3)
+		return appendUvarint(b, v)
+	}
+	bytesField := func(b []byte, field uint64, v []byte) []byte {
+		b = appendUvarint(b, field<<3|2)
+		b = appendUvarint(b, uint64(len(v)))
+		return append(b, v...)
+	}
+	var footer []byte
+	footer = varint(footer, 1, 3)                         // headerLength
+	footer = bytesField(footer, 4, []byte{0x08, 0x0c})    // types
+	footer = append(footer, 0x39, 1, 2, 3, 4, 5, 6, 7, 8) // field 7, fixed64
+	footer = varint(footer, orcNumRowsField, rows)        // numberOfRows
+	var compressed bytes.Buffer
+	w, _ := flate.NewWriter(&compressed, flate.BestCompression)
+	w.Write(footer)
+	w.Close()
+	header := compressed.Len() << 1
+	chunk := append([]byte{byte(header), byte(header >> 8), byte(header >> 16)}, compressed.Bytes()...)
+
+	var ps []byte
+	ps = varint(ps, orcFooterLengthField, uint64(len(chunk)))
+	ps = varint(ps, orcCompressionField, orcZlib)
+	ps = varint(ps, 3, 262144)
+	ps = bytesField(ps, orcMagicField, []byte(orcMagic))
+
+	var file bytes.Buffer
+	file.WriteString("ORC")
+	file.WriteString("stripe data")
+	file.Write(chunk)
+	file.Write(ps)
+	file.WriteByte(byte(len(ps)))
+	return file.Bytes()
+}
+
+func TestRowCount(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"parquet": parquetFile(t, 12345),
+		"orc":     orcFile(t, 12345),
+	} {
+		rows, err := RowCount(memFile{bytes.NewReader(data)}, int64(len(data)))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if rows != 12345 {
+			t.Errorf("%s: expected 12345 rows, got %d", name, rows)
+		}
+	}
+	text := []byte("a,b,c\n")
+	if _, err := RowCount(memFile{bytes.NewReader(text)}, int64(len(text))); err != ErrUnknownFormat {
+		t.Errorf("expected unknown format for text file, got %v", err)
+	}
+}
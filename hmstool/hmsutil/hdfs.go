@@ -1,39 +1,71 @@
 package hmsutil
 
 import (
+	"net/url"
+
 	"github.com/colinmarc/hdfs"
 )
 
-var connections map[string]*hdfs.Client
+// hdfsFileSystem is HDFS accessed through a single name node
+type hdfsFileSystem struct {
+	client *hdfs.Client
+}
 
-// List files in the given location
-func ListFiles(location string) ([]string, error) {
-	hostPort, path, err := GetHostLocation(location)
+func (fs *hdfsFileSystem) List(location string) ([]FileInfo, error) {
+	_, path, err := GetHostLocation(location)
 	if err != nil {
 		return nil, err
 	}
-	client, ok := connections[hostPort]
-	if !ok {
-		client, err = hdfs.New(hostPort)
-		if err != nil {
-			return nil, err
-		}
-		connections[hostPort] = client
-	}
-	files, err := client.ReadDir(path)
+	files, err := fs.client.ReadDir(path)
 	if err != nil {
 		return nil, err
 	}
-	result := []string{}
-	for _, file := range files {
-		// Skip directories
-		if !file.IsDir() {
-			result = append(result, file.Name())
-		}
+	result := make([]FileInfo, len(files))
+	for i, file := range files {
+		result[i] = toFileInfo(joinLocation(location, file.Name()), file)
 	}
+	sortFiles(result)
 	return result, nil
 }
 
+func (fs *hdfsFileSystem) Stat(location string) (FileInfo, error) {
+	_, path, err := GetHostLocation(location)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	info, err := fs.client.Stat(path)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return toFileInfo(location, info), nil
+}
+
+func (fs *hdfsFileSystem) Walk(location string, fn WalkFunc) error {
+	return walkTree(fs, location, fn)
+}
+
+func (fs *hdfsFileSystem) RemoveAll(location string) error {
+	_, path, err := GetHostLocation(location)
+	if err != nil {
+		return err
+	}
+	return fs.client.Remove(path)
+}
+
+func (fs *hdfsFileSystem) Open(location string) (File, error) {
+	_, path, err := GetHostLocation(location)
+	if err != nil {
+		return nil, err
+	}
+	return fs.client.Open(path)
+}
+
 func init() {
-	connections = make(map[string]*hdfs.Client)
+	RegisterFileSystem("hdfs", func(u *url.URL) (FileSystem, error) {
+		client, err := hdfs.New(u.Host)
+		if err != nil {
+			return nil, err
+		}
+		return &hdfsFileSystem{client: client}, nil
+	})
 }
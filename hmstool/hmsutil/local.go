@@ -0,0 +1,83 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hmsutil
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// localFileSystem is the local file system, used for file:// locations
+type localFileSystem struct{}
+
+// localPath returns local path for the file:// location
+func localPath(location string) string {
+	_, _, path := splitLocation(location)
+	return filepath.FromSlash(path)
+}
+
+func (localFileSystem) List(location string) ([]FileInfo, error) {
+	files, err := ioutil.ReadDir(localPath(location))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]FileInfo, len(files))
+	for i, file := range files {
+		result[i] = toFileInfo(joinLocation(location, file.Name()), file)
+	}
+	return result, nil
+}
+
+func (localFileSystem) Stat(location string) (FileInfo, error) {
+	info, err := os.Stat(localPath(location))
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return toFileInfo(location, info), nil
+}
+
+func (fs localFileSystem) Walk(location string, fn WalkFunc) error {
+	return walkTree(fs, location, fn)
+}
+
+func (localFileSystem) RemoveAll(location string) error {
+	return os.RemoveAll(localPath(location))
+}
+
+func (localFileSystem) Open(location string) (File, error) {
+	return os.Open(localPath(location))
+}
+
+// toFileInfo converts os.FileInfo to FileInfo
+func toFileInfo(location string, info os.FileInfo) FileInfo {
+	result := FileInfo{
+		Name:    info.Name(),
+		Path:    location,
+		ModTime: info.ModTime(),
+		IsDir:   info.IsDir(),
+	}
+	if !result.IsDir {
+		result.Size = info.Size()
+	}
+	return result
+}
+
+func init() {
+	RegisterFileSystem("file", func(*url.URL) (FileSystem, error) {
+		return localFileSystem{}, nil
+	})
+}
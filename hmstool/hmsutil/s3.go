@@ -0,0 +1,522 @@
+// Copyright © 2018 Alex Kolbasov
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hmsutil
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3DefaultRegion = "us-east-1"
+	s3EmptyHash     = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	s3TimeFormat    = "20060102T150405Z"
+)
+
+// S3Config describes connection to S3 or S3-compatible object store
+type S3Config struct {
+	// Endpoint is the URL of S3-compatible service, like http://localhost:9000.
+	// Buckets are accessed with path-style requests when endpoint is set.
+	// When it is empty, AWS S3 is used with virtual-hosted style requests.
+	Endpoint     string
+	Region       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Client       *http.Client
+}
+
+// S3ConfigFromEnv returns S3 configuration from the standard AWS environment
+// variables AWS_ENDPOINT_URL, AWS_REGION, AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY
+// and AWS_SESSION_TOKEN. Requests are not signed when there are no credentials.
+func S3ConfigFromEnv() S3Config {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	return S3Config{
+		Endpoint:     os.Getenv("AWS_ENDPOINT_URL"),
+		Region:       region,
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// s3FileSystem is a single S3 bucket. Object stores have no directories, so
+// directories are derived from object key prefixes separated by '/'.
+type s3FileSystem struct {
+	bucket string
+	config S3Config
+	base   *url.URL // URL of the bucket
+	client *http.Client
+}
+
+// NewS3FileSystem returns file system for the bucket
+func NewS3FileSystem(bucket string, config S3Config) (FileSystem, error) {
+	if config.Region == "" {
+		config.Region = s3DefaultRegion
+	}
+	fs := &s3FileSystem{bucket: bucket, config: config, client: config.Client}
+	if fs.client == nil {
+		fs.client = http.DefaultClient
+	}
+	var err error
+	if config.Endpoint != "" {
+		fs.base, err = url.Parse(strings.TrimSuffix(config.Endpoint, "/") + "/" + bucket)
+	} else {
+		fs.base, err = url.Parse(fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, config.Region))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint %s: %v", config.Endpoint, err)
+	}
+	return fs, nil
+}
+
+// s3ListResult is the response of ListObjectsV2
+type s3ListResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key          string
+		LastModified time.Time
+		Size         int64
+	}
+	CommonPrefixes []struct {
+		Prefix string
+	}
+}
+
+// s3Error is the error response of S3
+type s3Error struct {
+	Code    string
+	Message string
+}
+
+// objectKey returns the object key for the location
+func objectKey(location string) string {
+	_, _, path := splitLocation(location)
+	return strings.TrimPrefix(path, "/")
+}
+
+// dirPrefix returns the key prefix of objects in the directory
+func dirPrefix(key string) string {
+	if key == "" || strings.HasSuffix(key, "/") {
+		return key
+	}
+	return key + "/"
+}
+
+func (fs *s3FileSystem) List(location string) ([]FileInfo, error) {
+	key := objectKey(location)
+	prefix := dirPrefix(key)
+	var result []FileInfo
+	err := fs.list(prefix, "/", 0, func(r *s3ListResult) {
+		for _, p := range r.CommonPrefixes {
+			name := strings.TrimSuffix(strings.TrimPrefix(p.Prefix, prefix), "/")
+			result = append(result, FileInfo{Name: name, Path: joinLocation(location, name), IsDir: true})
+		}
+		for _, c := range r.Contents {
+			name := strings.TrimPrefix(c.Key, prefix)
+			if name == "" {
+				// Directory marker
+				continue
+			}
+			result = append(result, FileInfo{Name: name, Path: joinLocation(location, name),
+				Size: c.Size, ModTime: c.LastModified})
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %v", location, err)
+	}
+	if len(result) == 0 {
+		// Empty directories don't exist in object stores, report missing ones
+		if _, err = fs.Stat(location); err != nil {
+			return nil, err
+		}
+	}
+	sortFiles(result)
+	return result, nil
+}
+
+func (fs *s3FileSystem) Stat(location string) (FileInfo, error) {
+	key := objectKey(location)
+	name := path.Base(strings.TrimSuffix(key, "/"))
+	if key != "" && !strings.HasSuffix(key, "/") {
+		resp, err := fs.do("HEAD", key, nil, nil)
+		if err != nil {
+			return FileInfo{}, fmt.Errorf("failed to stat %s: %v", location, err)
+		}
+		resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusOK:
+			info := FileInfo{Name: name, Path: location, Size: resp.ContentLength}
+			info.ModTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+			return info, nil
+		case http.StatusNotFound:
+		default:
+			return FileInfo{}, fmt.Errorf("failed to stat %s: %s", location, resp.Status)
+		}
+	}
+	// Check whether this is a directory
+	exists := false
+	err := fs.list(dirPrefix(key), "/", 1, func(r *s3ListResult) {
+		exists = exists || len(r.Contents) != 0 || len(r.CommonPrefixes) != 0
+	})
+	if err != nil {
+		return FileInfo{}, fmt.Errorf("failed to stat %s: %v", location, err)
+	}
+	if !exists && key != "" {
+		return FileInfo{}, &os.PathError{Op: "stat", Path: location, Err: os.ErrNotExist}
+	}
+	return FileInfo{Name: name, Path: location, IsDir: true}, nil
+}
+
+// Walk lists all objects below the location with a single listing and reports
+// directories before their contents.
+func (fs *s3FileSystem) Walk(location string, fn WalkFunc) error {
+	key := objectKey(location)
+	prefix := dirPrefix(key)
+	var objects []FileInfo
+	err := fs.list(prefix, "", 0, func(r *s3ListResult) {
+		for _, c := range r.Contents {
+			name := strings.TrimPrefix(c.Key, prefix)
+			if name == "" {
+				continue
+			}
+			objects = append(objects, FileInfo{Name: name, Size: c.Size, ModTime: c.LastModified})
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %v", location, err)
+	}
+	if len(objects) == 0 {
+		_, err = fs.Stat(location)
+		return err
+	}
+	// Sort by path components, so that directory contents follow the directory
+	sort.Slice(objects, func(i, j int) bool {
+		return strings.Replace(objects[i].Name, "/", "\x00", -1) <
+			strings.Replace(objects[j].Name, "/", "\x00", -1)
+	})
+	seen := make(map[string]bool)
+	var skipped []string
+	for _, object := range objects {
+		relative := strings.TrimSuffix(object.Name, "/")
+		if isSkipped(relative, skipped) {
+			continue
+		}
+		parts := strings.Split(relative, "/")
+		// Report parent directories first
+		dir := ""
+		skip := false
+		for _, part := range parts[:len(parts)-1] {
+			dir = path.Join(dir, part)
+			if seen[dir] {
+				continue
+			}
+			seen[dir] = true
+			err = fn(FileInfo{Name: part, Path: joinLocation(location, dir), IsDir: true})
+			if err == SkipDir {
+				skipped = append(skipped, dir)
+				skip = true
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if skip {
+			continue
+		}
+		if strings.HasSuffix(object.Name, "/") {
+			// Directory marker
+			if !seen[relative] {
+				seen[relative] = true
+				err = fn(FileInfo{Name: parts[len(parts)-1], Path: joinLocation(location, relative), IsDir: true})
+				if err == SkipDir {
+					skipped = append(skipped, relative)
+					continue
+				}
+			}
+		} else {
+			object.Name = parts[len(parts)-1]
+			object.Path = joinLocation(location, relative)
+			err = fn(object)
+		}
+		if err != nil && err != SkipDir {
+			return err
+		}
+	}
+	return nil
+}
+
+// s3Object is an object read with ranged GET requests
+type s3Object struct {
+	fs  *s3FileSystem
+	key string
+}
+
+func (fs *s3FileSystem) Open(location string) (File, error) {
+	return &s3Object{fs: fs, key: objectKey(location)}, nil
+}
+
+func (o *s3Object) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1)}}
+	resp, err := o.fs.do("GET", o.key, nil, header)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent, http.StatusOK:
+	case http.StatusNotFound:
+		return 0, &os.PathError{Op: "read", Path: o.key, Err: os.ErrNotExist}
+	case http.StatusRequestedRangeNotSatisfiable:
+		return 0, io.EOF
+	default:
+		return 0, fmt.Errorf("failed to read %s: %s", o.key, resp.Status)
+	}
+	if resp.StatusCode == http.StatusOK && off > 0 {
+		// Range is ignored, skip to the offset
+		if _, err = io.CopyN(ioutil.Discard, resp.Body, off); err != nil {
+			return 0, err
+		}
+	}
+	n, err := io.ReadFull(resp.Body, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (o *s3Object) Close() error {
+	return nil
+}
+
+// RemoveAll deletes the object and all objects with the directory prefix
+func (fs *s3FileSystem) RemoveAll(location string) error {
+	key := objectKey(location)
+	if strings.Trim(key, "/") == "" {
+		return fmt.Errorf("refusing to remove the whole bucket %s", fs.bucket)
+	}
+	keys := []string{}
+	if !strings.HasSuffix(key, "/") {
+		keys = append(keys, key)
+	}
+	err := fs.list(dirPrefix(key), "", 0, func(r *s3ListResult) {
+		for _, c := range r.Contents {
+			keys = append(keys, c.Key)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %v", location, err)
+	}
+	for _, k := range keys {
+		resp, err := fs.do("DELETE", k, nil, nil)
+		if err != nil {
+			return fmt.Errorf("failed to delete %s: %v", k, err)
+		}
+		resp.Body.Close()
+		// Deleting missing object succeeds in S3, but not necessarily in compatible stores
+		if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK &&
+			resp.StatusCode != http.StatusNotFound {
+			return fmt.Errorf("failed to delete %s: %s", k, resp.Status)
+		}
+	}
+	return nil
+}
+
+// isSkipped returns true if the name is inside one of skipped directories
+func isSkipped(name string, skipped []string) bool {
+	for _, dir := range skipped {
+		if strings.HasPrefix(name, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// list calls ListObjectsV2 for the prefix and calls fn for each page of results.
+// Non-zero maxKeys limits the listing to a single page.
+func (fs *s3FileSystem) list(prefix string, delimiter string, maxKeys int,
+	fn func(r *s3ListResult)) error {
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if delimiter != "" {
+			query.Set("delimiter", delimiter)
+		}
+		if maxKeys != 0 {
+			query.Set("max-keys", strconv.Itoa(maxKeys))
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := fs.do("GET", "", query, nil)
+		if err != nil {
+			return err
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			var s3err s3Error
+			if xml.Unmarshal(body, &s3err) == nil && s3err.Code != "" {
+				return fmt.Errorf("%s: %s", s3err.Code, s3err.Message)
+			}
+			return fmt.Errorf("bucket %s: %s", fs.bucket, resp.Status)
+		}
+		result := new(s3ListResult)
+		if err = xml.Unmarshal(body, result); err != nil {
+			return fmt.Errorf("invalid listing of bucket %s: %v", fs.bucket, err)
+		}
+		fn(result)
+		if !result.IsTruncated || maxKeys != 0 {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// do sends request for the object key in the bucket. Extra headers are not signed.
+func (fs *s3FileSystem) do(method string, key string, query url.Values,
+	header http.Header) (*http.Response, error) {
+	u := *fs.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+	u.RawPath = s3Escape(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	fs.sign(req, time.Now().UTC())
+	return fs.client.Do(req)
+}
+
+// sign signs request with AWS Signature Version 4
+func (fs *s3FileSystem) sign(req *http.Request, now time.Time) {
+	if fs.config.AccessKey == "" {
+		return
+	}
+	amzDate := now.Format(s3TimeFormat)
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", s3EmptyHash)
+	if fs.config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", fs.config.SessionToken)
+	}
+	headers := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	values := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": s3EmptyHash,
+		"x-amz-date":           amzDate,
+	}
+	if fs.config.SessionToken != "" {
+		headers = append(headers, "x-amz-security-token")
+		values["x-amz-security-token"] = fs.config.SessionToken
+	}
+	var canonicalHeaders strings.Builder
+	for _, h := range headers {
+		canonicalHeaders.WriteString(h + ":" + values[h] + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		s3EmptyHash,
+	}, "\n")
+	scope := date + "/" + fs.config.Region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+	key := hmacSHA256([]byte("AWS4"+fs.config.SecretKey), date)
+	key = hmacSHA256(key, fs.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		fs.config.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery encodes query parameters sorted by name as required by signature V4
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape percent-encodes everything except unreserved characters. Slash is
+// encoded only when encodeSlash is true.
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func init() {
+	factory := func(u *url.URL) (FileSystem, error) {
+		return NewS3FileSystem(u.Host, S3ConfigFromEnv())
+	}
+	for _, scheme := range []string{"s3", "s3a", "s3n"} {
+		RegisterFileSystem(scheme, factory)
+	}
+}
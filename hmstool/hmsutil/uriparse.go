@@ -15,15 +15,43 @@
 package hmsutil
 
 import (
-	"fmt"
-	"net/url"
+	"strings"
 )
 
 // GetHostLocation splits HDFS URI into host:port part and location part.
+// The location part is returned as is, see splitLocation.
 func GetHostLocation(uri string) (host string, path string, err error) {
-	u, err := url.Parse(uri)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to parse %s: %v", uri, err)
+	_, host, path = splitLocation(uri)
+	return host, path, nil
+}
+
+// splitLocation splits location into scheme, authority and path. Locations are
+// Hadoop paths rather than URLs, so unlike url.Parse it doesn't decode %XX
+// sequences: partition directories like ds=a%3Ab are named with escaped values.
+func splitLocation(location string) (scheme string, host string, path string) {
+	path = location
+	if i := strings.Index(path, ":"); i > 0 && isScheme(path[:i]) {
+		scheme, path = path[:i], path[i+1:]
+	}
+	if strings.HasPrefix(path, "//") {
+		host = path[2:]
+		path = ""
+		if i := strings.Index(host, "/"); i >= 0 {
+			host, path = host[:i], host[i:]
+		}
+	}
+	return scheme, host, path
+}
+
+// isScheme returns true if s is a valid URI scheme
+func isScheme(s string) bool {
+	for i, c := range s {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case i > 0 && ('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return false
+		}
 	}
-	return u.Host, u.Path, nil
+	return true
 }
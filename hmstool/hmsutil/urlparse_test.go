@@ -26,6 +26,24 @@ func TestGetHostLocation(t *testing.T) {
 	}
 }
 
+func TestSplitLocation(t *testing.T) {
+	tests := []struct {
+		location, scheme, host, path string
+	}{
+		{"hdfs://nn:8020/warehouse/t/ds=a%3Ab", "hdfs", "nn:8020", "/warehouse/t/ds=a%3Ab"},
+		{"file:///tmp/t/ds=100%", "file", "", "/tmp/t/ds=100%"},
+		{"s3a://bucket", "s3a", "bucket", ""},
+		{"/warehouse/t", "", "", "/warehouse/t"},
+	}
+	for _, test := range tests {
+		scheme, host, path := splitLocation(test.location)
+		if scheme != test.scheme || host != test.host || path != test.path {
+			t.Errorf("%s: expected %q %q %q, got %q %q %q", test.location,
+				test.scheme, test.host, test.path, scheme, host, path)
+		}
+	}
+}
+
 func ExampleGetHostLocation() {
 	uri := fmt.Sprintf("%s://%s%s", scheme, hostPort, location)
 	host, loc, _ := GetHostLocation(uri)
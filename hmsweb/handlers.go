@@ -20,6 +20,7 @@ import (
 	"log"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -252,13 +253,17 @@ func tableCreate(w http.ResponseWriter, r *http.Request) {
 		tbl.Parameters["ULID"] = getULID()
 	}
 
-	table := hmsclient.NewTableBuilder(dbName, tableName).
+	tb := hmsclient.NewTableBuilder(dbName, tableName).
 		WithOwner(tbl.Owner).
 		WithColumns(tbl.Columns).
 		WithLocation(tbl.Location).
 		WithPartitionKeys(tbl.Partitions).
-		WithParameters(tbl.Parameters).
-		Build()
+		WithParameters(tbl.Parameters)
+	if err = tb.Validate(); err != nil {
+		showError(w, http.StatusBadRequest, err)
+		return
+	}
+	table := tb.Build()
 
 	log.Println("Creating table " + spew.Sdump(table))
 	err = client.CreateTable(table)
@@ -314,9 +319,8 @@ func partitionsList(w http.ResponseWriter, r *http.Request) {
 	if !compact {
 		pList := make([]string, len(partitions))
 		for i, t := range partitions {
-			fixed := strings.Replace(t, "/", ",", -1)
-			url := r.URL
-			pList[i] = r.Host + url.Path + fixed
+			fixed := url.PathEscape(webPartName(t))
+			pList[i] = r.Host + r.URL.Path + fixed
 		}
 		partitions = pList
 	}
@@ -372,7 +376,11 @@ func partitionShow(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	dbName := vars[paramDbName]
 	tableName := vars[paramTblName]
-	partName := strings.Replace(vars[paramPartName], ",", "/", -1)
+	partName, err := partNameFromWeb(vars[paramPartName])
+	if err != nil {
+		showError(w, http.StatusBadRequest, err)
+		return
+	}
 	partition, err := client.GetPartitionByName(dbName, tableName, partName)
 	if err != nil {
 		showError(w, http.StatusBadRequest, err)
@@ -429,9 +437,29 @@ func partitionDrop(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	dbName := vars[paramDbName]
 	tableName := vars[paramTblName]
-	partName := strings.Replace(vars[paramPartName], ",", "/", -1)
+	partName, err := partNameFromWeb(vars[paramPartName])
+	if err != nil {
+		showError(w, http.StatusBadRequest, err)
+		return
+	}
 	log.Printf("Dropping partition %s.%s/%s. deleteData = %v\n", dbName, tableName, partName, deleteData)
 	if _, err = client.DropPartitionByName(dbName, tableName, partName, deleteData); err != nil {
 		showError(w, http.StatusBadRequest, err)
 	}
 }
+
+// webPartName converts partition name to the form used in URLs. Since URL path
+// elements can't contain slashes, name components are separated by commas and
+// commas within values are escaped.
+func webPartName(name string) string {
+	return strings.Replace(strings.Replace(name, ",", "%2C", -1), "/", ",", -1)
+}
+
+// partNameFromWeb converts partition name from URL back to the HMS form.
+func partNameFromWeb(name string) (string, error) {
+	keys, values, err := hmsclient.ParsePartName(strings.Replace(name, ",", "/", -1))
+	if err != nil {
+		return "", err
+	}
+	return hmsclient.MakePartName(keys, values), nil
+}